@@ -4,10 +4,15 @@ import (
 	"context"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lichuan0620/secret-keeper-backend/cmd/queue/service"
+	"github.com/lichuan0620/secret-keeper-backend/internal/leader"
 	"github.com/lichuan0620/secret-keeper-backend/internal/queue"
+	"github.com/lichuan0620/secret-keeper-backend/internal/shard"
+	"github.com/lichuan0620/secret-keeper-backend/internal/store"
 	"github.com/lichuan0620/secret-keeper-backend/pkg/mongo"
 	"github.com/lichuan0620/secret-keeper-backend/pkg/telemetry"
 	"github.com/lichuan0620/secret-keeper-backend/pkg/telemetry/log"
@@ -23,6 +28,14 @@ func Command(ctx context.Context) *cobra.Command {
 		MongoEndpoint          string
 		ListenAddress          string
 		TelemetryListenAddress string
+		DequeueStrategy        string
+		SnapshotDir            string
+		SnapshotInterval       time.Duration
+		SyncMode               string
+		Shards                 int
+		ShardIndex             int
+		LeaderElection         bool
+		LeaseDuration          time.Duration
 	)
 	cmd := cobra.Command{
 		Use:   component,
@@ -32,11 +45,71 @@ func Command(ctx context.Context) *cobra.Command {
 	flags.StringVar(&MongoEndpoint, "mongodb-endpoint", os.Getenv("MONGODB_ENDPOINT"), "address to the MongoDB service")
 	flags.StringVar(&ListenAddress, "listen-address", os.Getenv("LISTEN_ADDRESS"), "address to listen to for HTTP requests")
 	flags.StringVar(&TelemetryListenAddress, "telemetry-listen-address", os.Getenv("TELEMETRY_LISTEN_ADDRESS"), "address to listen to for telemetry requests")
+	flags.StringVar(&DequeueStrategy, "dequeue-strategy", queue.DefaultStrategy, "strategy choosing which Box to hand out; one of lru, weighted-emoji, fresh-first and uniform")
+	flags.StringVar(&SnapshotDir, "snapshot-dir", os.Getenv("SNAPSHOT_DIR"), "directory to persist the queue state to for fast restarts; nothing is persisted if empty")
+	flags.DurationVar(&SnapshotInterval, "snapshot-interval", 5*time.Minute, "how often the queue state is snapshotted")
+	flags.StringVar(&SyncMode, "sync-mode", queue.SyncModePush, "how the queue learns about changed Boxes; push relies on the Sync calls of the servers, change-stream tails the MongoDB change stream, which requires a replica set")
+	flags.IntVar(&Shards, "shards", 1, "number of queue shards the Boxes are split between")
+	flags.IntVar(&ShardIndex, "shard-index", -1, "index of this queue among the shards; taken from the ordinal suffix of the host name, as given to StatefulSet Pods, modulo the number of shards if negative")
+	flags.BoolVar(&LeaderElection, "leader-election", false, "run several replicas of each shard, of which only the elected leader hands out Boxes while the others stand by")
+	flags.DurationVar(&LeaseDuration, "leader-lease-duration", leader.DefaultLeaseDuration, "how long the leader keeps its lease without renewing it; a standby takes over within this duration after the leader is gone")
 	cmd.RunE = func(_ *cobra.Command, _ []string) error {
-		if err := mongo.Init(MongoEndpoint); err != nil {
+		partition, err := buildPartition(Shards, ShardIndex)
+		if err != nil {
+			return err
+		}
+		strategy, err := queue.StrategyByName(DequeueStrategy)
+		if err != nil {
+			return errors.Wrap(err, "invalid dequeue strategy")
+		}
+		if err = mongo.Init(MongoEndpoint); err != nil {
 			return errors.Wrap(err, "initialize MongoDB connection")
 		}
-		q := queue.New()
+		bs := store.NewMongoBoxStore()
+		opts := queue.Options{
+			Strategy:         strategy,
+			SnapshotDir:      SnapshotDir,
+			SnapshotInterval: SnapshotInterval,
+			Partition:        partition,
+		}
+		switch SyncMode {
+		case queue.SyncModePush:
+		case queue.SyncModeChangeStream:
+			opts.Watcher = bs.(store.BoxWatcher)
+			opts.Checkpoints = store.NewMongoCheckpointStore()
+		default:
+			return errors.Errorf("invalid sync mode %q", SyncMode)
+		}
+		// the elector and the queue refer to each other; the elector only calls back once running
+		var (
+			q       queue.Interface
+			elector *leader.Elector
+		)
+		if LeaderElection {
+			hostname, err := os.Hostname()
+			if err != nil {
+				return errors.Wrap(err, "get host name")
+			}
+			opts.Replica = hostname
+			lease := component
+			if partition != nil {
+				lease += "-" + strconv.Itoa(partition.Shard)
+			}
+			elector = leader.New(store.NewMongoLeaseStore(), lease, hostname, &leader.Options{
+				LeaseDuration: LeaseDuration,
+				// catch up on what the previous leader has done since the last resync
+				OnElected: func() {
+					if err := q.Resync(false); err != nil {
+						log.New().Error(err, "resync on election")
+					}
+				},
+				Eligible: func() bool {
+					return q.Ready()
+				},
+			})
+			opts.Leader = elector
+		}
+		q = queue.New(bs, &opts)
 		handler, err := service.Build(q)
 		if err != nil {
 			return errors.Wrap(err, "build service handler")
@@ -57,6 +130,15 @@ func Command(ctx context.Context) *cobra.Command {
 			}
 			return errors.New("queue is not ready")
 		})
+		if elector != nil {
+			// reported separately from the readiness, which is probed with ?exclude=leader
+			telemetryServer.SetHealthCheck("leader", func(_ *http.Request) error {
+				if elector.IsLeader() {
+					return nil
+				}
+				return errors.New("not the leader")
+			})
+		}
 		eg, egCtx := errgroup.WithContext(ctx)
 		eg.Go(func() error {
 			return errors.Wrap(telemetryServer.Start(egCtx), "serve telemetry")
@@ -65,6 +147,12 @@ func Command(ctx context.Context) *cobra.Command {
 			q.Run(egCtx.Done())
 			return nil
 		})
+		if elector != nil {
+			eg.Go(func() error {
+				elector.Run(egCtx.Done())
+				return nil
+			})
+		}
 		eg.Go(func() error {
 			if err = server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 				return errors.Wrap(err, "serve HTTP")
@@ -82,3 +170,30 @@ func Command(ctx context.Context) *cobra.Command {
 	}
 	return &cmd
 }
+
+// buildPartition returns the Partition of this shard, or nil if the queue is not sharded.
+func buildPartition(shards, index int) (*shard.Partition, error) {
+	if shards < 1 {
+		return nil, errors.Errorf("invalid number of shards %d", shards)
+	}
+	if shards == 1 {
+		return nil, nil
+	}
+	if index < 0 {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, errors.Wrap(err, "get host name")
+		}
+		ordinal, err := strconv.Atoi(hostname[strings.LastIndex(hostname, "-")+1:])
+		if err != nil {
+			return nil, errors.Errorf("no shard index in host name %s", hostname)
+		}
+		// the replicas of a shard are the Pods whose ordinals differ by a multiple of shards
+		index = ordinal % shards
+	}
+	if index >= shards {
+		return nil, errors.Errorf("shard index %d out of range [0, %d)", index, shards)
+	}
+	log.New().Info("queue sharded", "shard", index, "shards", shards)
+	return &shard.Partition{Ring: shard.NewRing(shards), Shard: index}, nil
+}
@@ -2,25 +2,77 @@ package service
 
 import (
 	"context"
+	"errors"
 
+	"github.com/lichuan0620/secret-keeper-backend/internal/queue"
 	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
 	"github.com/lichuan0620/secret-keeper-backend/pkg/service/standard"
 	"github.com/lichuan0620/secret-keeper-backend/pkg/telemetry/log"
 )
 
 func Sync(ctx context.Context, req *models.SyncRequest) (models.SyncResponse, standard.Error) {
-	GetQueue(ctx).Sync(models.QueueItem{
-		Id:    req.Id,
-		Score: req.Score,
-	})
+	GetQueue(ctx).Sync(models.QueueItem(*req))
 	return models.SyncResponse{}, nil
 }
 
-func Dequeue(ctx context.Context) (*models.DequeueResponse, standard.Error) {
-	id, err := GetQueue(ctx).Dequeue()
-	if err != nil {
+func Dequeue(ctx context.Context, viewerID, strategy string) (*models.DequeueResponse, standard.Error) {
+	id, err := GetQueue(ctx).Dequeue(queue.DequeueOptions{ViewerId: viewerID, Strategy: strategy})
+	if errors.Is(err, queue.ErrUnknownStrategy) {
+		return nil, standard.InvalidParameter("Strategy")
+	} else if err == queue.ErrNoData {
+		return nil, standard.ResourceNotFound("Box")
+	} else if err == queue.ErrNotLeader {
+		return nil, standard.ServiceUnavailable()
+	} else if err != nil {
 		log.FromContext(ctx).Error(err, "dequeue Box")
 		return nil, standard.InternalServiceError()
 	}
 	return &models.DequeueResponse{Id: id}, nil
 }
+
+// DequeueBatch hands out up to Count Boxes at once; see queue.Type.DequeueBatch.
+func DequeueBatch(ctx context.Context, req *models.DequeueBatchRequest) (*models.DequeueBatchResponse, standard.Error) {
+	ids, err := GetQueue(ctx).DequeueBatch(queue.DequeueOptions{Strategy: req.Strategy}, req.Count)
+	if errors.Is(err, queue.ErrUnknownStrategy) {
+		return nil, standard.InvalidParameter("Strategy")
+	} else if err == queue.ErrNoData {
+		return nil, standard.ResourceNotFound("Box")
+	} else if err == queue.ErrNotLeader {
+		return nil, standard.ServiceUnavailable()
+	} else if err != nil {
+		log.FromContext(ctx).Error(err, "dequeue Boxes")
+		return nil, standard.InternalServiceError()
+	}
+	return &models.DequeueBatchResponse{Ids: ids}, nil
+}
+
+func RecordViews(ctx context.Context, req *models.RecordViewsRequest) (models.RecordViewsResponse, standard.Error) {
+	if err := GetQueue(ctx).RecordViews(req.Views); err == queue.ErrNotLeader {
+		return models.RecordViewsResponse{}, standard.ServiceUnavailable()
+	} else if err != nil {
+		log.FromContext(ctx).Error(err, "record views")
+		return models.RecordViewsResponse{}, standard.InternalServiceError()
+	}
+	return models.RecordViewsResponse{}, nil
+}
+
+func Remove(ctx context.Context, req *models.RemoveRequest) (models.RemoveResponse, standard.Error) {
+	GetQueue(ctx).Remove(req.Id)
+	return models.RemoveResponse{}, nil
+}
+
+// Health succeeds if the queue hands out Boxes, so that clients can tell when it is back.
+func Health(ctx context.Context) (models.HealthResponse, standard.Error) {
+	if !GetQueue(ctx).Serving() {
+		return models.HealthResponse{}, standard.ServiceUnavailable()
+	}
+	return models.HealthResponse{}, nil
+}
+
+func Resync(ctx context.Context, req *models.ResyncRequest) (models.ResyncResponse, standard.Error) {
+	if err := GetQueue(ctx).Resync(req.Full); err != nil {
+		log.FromContext(ctx).Error(err, "resync queue")
+		return models.ResyncResponse{}, standard.InternalServiceError()
+	}
+	return models.ResyncResponse{}, nil
+}
@@ -12,6 +12,12 @@ import (
 )
 
 func Build(q queue.Interface) (http.Handler, error) {
+	return NewBuilder(q).Build()
+}
+
+// NewBuilder returns the Builder with the Actions of the queue service registered; the queue
+// client is generated from it.
+func NewBuilder(q queue.Interface) *service.Builder {
 	logger := log.New().WithName("handlers")
 	return (&service.Builder{
 		GlobalMiddlewares: []servicemodel.Middleware{
@@ -24,18 +30,31 @@ func Build(q queue.Interface) (http.Handler, error) {
 		},
 		Middlewares: []servicemodel.Middleware{WithQueue(q)},
 		Actions: []servicemodel.Action{
+			service.TypedAction("Sync", Sync),
 			{
-				Name: "Sync",
-				Parameters: []servicemodel.Parameter{{
-					Source: servicemodel.ParameterSourceBody,
-					Name:   "body",
-				}},
-				Handler: Sync,
+				Name: "Dequeue",
+				Parameters: []servicemodel.Parameter{
+					{
+						Source:  servicemodel.ParameterSourceQuery,
+						Name:    "ViewerId",
+						Default: "",
+					},
+					{
+						Source:  servicemodel.ParameterSourceQuery,
+						Name:    "Strategy",
+						Default: "",
+					},
+				},
+				Handler: Dequeue,
 			},
+			service.TypedAction("DequeueBatch", DequeueBatch),
+			service.TypedAction("RecordViews", RecordViews),
+			service.TypedAction("Remove", Remove),
+			service.TypedAction("Resync", Resync),
 			{
-				Name:    "Dequeue",
-				Handler: Dequeue,
+				Name:    "Health",
+				Handler: Health,
 			},
 		},
-	}).Build()
+	})
 }
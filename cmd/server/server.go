@@ -2,12 +2,17 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/lichuan0620/secret-keeper-backend/cmd/server/service"
+	"github.com/lichuan0620/secret-keeper-backend/internal/moderation"
+	"github.com/lichuan0620/secret-keeper-backend/internal/queue"
 	"github.com/lichuan0620/secret-keeper-backend/internal/queueclient"
+	"github.com/lichuan0620/secret-keeper-backend/internal/store"
 	"github.com/lichuan0620/secret-keeper-backend/pkg/mongo"
 	"github.com/lichuan0620/secret-keeper-backend/pkg/network"
 	"github.com/lichuan0620/secret-keeper-backend/pkg/telemetry"
@@ -25,6 +30,15 @@ func Command(ctx context.Context) *cobra.Command {
 		QueueEndpoint          string
 		ListenAddress          string
 		TelemetryListenAddress string
+		InMemory               bool
+		ModerationConfig       string
+		ReportHideThreshold    uint
+		AdminToken             string
+		QueueSyncMode          string
+		QueuePrefetch          int
+		QueueTimeout           time.Duration
+		QueueRetries           int
+		DegradedFallback       bool
 	)
 	cmd := cobra.Command{
 		Use:   component,
@@ -32,19 +46,105 @@ func Command(ctx context.Context) *cobra.Command {
 	}
 	flags := cmd.PersistentFlags()
 	flags.StringVar(&MongoEndpoint, "mongodb-endpoint", os.Getenv("MONGODB_ENDPOINT"), "address to the MongoDB service")
-	flags.StringVar(&QueueEndpoint, "queue-endpoint", os.Getenv("QUEUE_ENDPOINT"), "address to the secret-keeper queue service")
+	flags.StringVar(&QueueEndpoint, "queue-endpoint", os.Getenv("QUEUE_ENDPOINT"), "address to the secret-keeper queue service; a comma-separated list of the shards, in order, if the queue is sharded, each of which may be a |-separated list of replicas")
 	flags.StringVar(&ListenAddress, "listen-address", os.Getenv("LISTEN_ADDRESS"), "address to listen to for HTTP requests")
 	flags.StringVar(&TelemetryListenAddress, "telemetry-listen-address", os.Getenv("TELEMETRY_LISTEN_ADDRESS"), "address to listen to for telemetry requests")
+	flags.BoolVar(&InMemory, "in-memory", false, "use in-memory storage and an embedded queue instead of MongoDB and the queue service; for local development only")
+	flags.StringVar(&ModerationConfig, "moderation-config", os.Getenv("MODERATION_CONFIG"), "path to the JSON file configuring content moderation filters; no filter is applied if empty")
+	flags.UintVar(&ReportHideThreshold, "report-hide-threshold", 5, "number of reports after which a Box is hidden; 0 disables automatic hiding")
+	flags.StringVar(&AdminToken, "admin-token", os.Getenv("ADMIN_TOKEN"), "bearer token required by the admin actions; they are disabled if empty")
+	flags.StringVar(&QueueSyncMode, "queue-sync-mode", queue.SyncModePush, "sync mode of the queue service; Sync calls are skipped if it is change-stream")
+	flags.IntVar(&QueuePrefetch, "queue-prefetch", 0, "number of Boxes taken from the queue and loaded ahead of time to serve ViewBox from memory; views are then reported to the queue asynchronously, and the Boxes a viewer has recently seen are only skipped if they were served by the same server instance; 0 takes them one at a time")
+	flags.DurationVar(&QueueTimeout, "queue-timeout", 3*time.Second, "timeout of every attempt of a queue service call")
+	flags.IntVar(&QueueRetries, "queue-retries", 2, "number of retries of the idempotent queue service calls after failures; failed Sync calls are retried from the outbox afterwards in the push sync mode")
+	flags.BoolVar(&DegradedFallback, "degraded-fallback", true, "serve ViewBox from the least recently viewed Boxes in the store while the queue service is unavailable, flagging the responses as degraded, until its health check succeeds again")
 	cmd.RunE = func(_ *cobra.Command, _ []string) error {
-		if err := mongo.Init(MongoEndpoint); err != nil {
-			return errors.Wrap(err, "initialize MongoDB connection")
+		var moderator *moderation.Moderator
+		if ModerationConfig != "" {
+			config, err := moderation.LoadConfig(ModerationConfig)
+			if err != nil {
+				return err
+			}
+			if moderator, err = config.Build(); err != nil {
+				return errors.Wrap(err, "invalid moderation config")
+			}
 		}
-		url, err := network.ParseEndpoint(QueueEndpoint, "http")
-		if err != nil {
-			return errors.Wrap(err, "invalid queue endpoint")
+		var (
+			qc queueclient.Interface
+			ob *queueclient.Outbox
+			bs store.BoxStore
+			rs store.ReplyStore
+			ps store.ReportStore
+			q  queue.Interface
+		)
+		if InMemory {
+			bs = store.NewMemoryBoxStore()
+			rs = store.NewMemoryReplyStore()
+			ps = store.NewMemoryReportStore()
+			q = queue.New(bs, nil)
+			qc = queueclient.NewLocal(q)
+		} else {
+			if err := mongo.Init(MongoEndpoint); err != nil {
+				return errors.Wrap(err, "initialize MongoDB connection")
+			}
+			clientOpts := queueclient.Options{Timeout: QueueTimeout, Retries: QueueRetries}
+			if QueueRetries == 0 {
+				clientOpts.Retries = -1
+			}
+			var shards []queueclient.Interface
+			for _, shardEndpoint := range strings.Split(QueueEndpoint, ",") {
+				var replicas []queueclient.Interface
+				for _, endpoint := range strings.Split(shardEndpoint, "|") {
+					url, err := network.ParseEndpoint(strings.TrimSpace(endpoint), "http")
+					if err != nil {
+						return errors.Wrap(err, "invalid queue endpoint")
+					}
+					replicas = append(replicas, queueclient.New(url.String(), &clientOpts))
+				}
+				if len(replicas) == 1 {
+					shards = append(shards, replicas[0])
+				} else {
+					shards = append(shards, queueclient.NewReplicated(replicas))
+				}
+			}
+			qc = shards[0]
+			if len(shards) > 1 {
+				qc = queueclient.NewSharded(shards)
+			}
+			switch QueueSyncMode {
+			case queue.SyncModePush:
+				ob = queueclient.NewOutbox(qc, store.NewMongoOutboxStore())
+				qc = ob
+			case queue.SyncModeChangeStream:
+				qc = queueclient.WithoutSync(qc)
+			default:
+				return errors.Errorf("invalid queue sync mode %q", QueueSyncMode)
+			}
+			bs = store.NewMongoBoxStore()
+			rs = store.NewMongoReplyStore()
+			ps = store.NewMongoReportStore()
+		}
+		var prefetcher *queueclient.Prefetcher
+		if QueuePrefetch > 0 {
+			prefetcher = queueclient.NewPrefetcher(qc, bs, &queueclient.PrefetchOptions{Size: QueuePrefetch})
+			qc = prefetcher
 		}
-		qc := queueclient.New(url.String())
-		handler, err := service.Build(qc)
+		var degraded *service.Degraded
+		if DegradedFallback {
+			degraded = service.NewDegraded(qc)
+		}
+		handler, err := service.Build(&service.Options{
+			QueueClient: qc,
+			Prefetcher:  prefetcher,
+			Degraded:    degraded,
+			Boxes:       bs,
+			Replies:     rs,
+			Reports:     ps,
+			Moderator:   moderator,
+
+			ReportHideThreshold: ReportHideThreshold,
+			AdminToken:          AdminToken,
+		})
 		if err != nil {
 			return errors.Wrap(err, "build service handler")
 		}
@@ -62,6 +162,32 @@ func Command(ctx context.Context) *cobra.Command {
 		eg.Go(func() error {
 			return errors.Wrap(telemetryServer.Start(egCtx), "serve telemetry")
 		})
+		if q != nil {
+			eg.Go(func() error {
+				q.Run(egCtx.Done())
+				return nil
+			})
+		}
+		if ob != nil {
+			eg.Go(func() error {
+				ob.Run(egCtx.Done())
+				return nil
+			})
+		}
+		if degraded != nil {
+			eg.Go(func() error {
+				degraded.Run(egCtx.Done())
+				return nil
+			})
+		}
+		// the views are reported one last time once the HTTP server is done with the requests
+		stopPrefetcher := make(chan struct{})
+		if prefetcher != nil {
+			eg.Go(func() error {
+				prefetcher.Run(stopPrefetcher)
+				return nil
+			})
+		}
 		eg.Go(func() error {
 			if err = server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 				return errors.Wrap(err, "serve HTTP")
@@ -72,10 +198,25 @@ func Command(ctx context.Context) *cobra.Command {
 			<-egCtx.Done()
 			gracefulCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 			defer cancel()
+			defer close(stopPrefetcher)
 			return errors.Wrap(server.Shutdown(gracefulCtx), "HTTP server graceful shutdown")
 		})
 		log.New().Info(component + " running")
 		return eg.Wait()
 	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "openapi",
+		Short: "Print the OpenAPI document of the server API",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			doc, err := service.OpenAPI()
+			if err != nil {
+				return errors.Wrap(err, "generate OpenAPI document")
+			}
+			encoder := json.NewEncoder(cmd.OutOrStdout())
+			encoder.SetEscapeHTML(false)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(doc)
+		},
+	})
 	return &cmd
 }
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/lichuan0620/secret-keeper-backend/internal/store"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/standard"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/telemetry/log"
+)
+
+const defaultListBoxesLimit = 20
+
+func ListBoxes(ctx context.Context, req *models.ListBoxesRequest) (*models.ListBoxesResponse, standard.Error) {
+	if req.CreatedAfter != nil && req.CreatedBefore != nil && !req.CreatedAfter.Before(*req.CreatedBefore) {
+		return nil, standard.InvalidParameter("CreatedBefore")
+	}
+	if req.MinEmojiCount > 0 && req.Emoji == "" {
+		return nil, standard.MissingParameter("Emoji")
+	}
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultListBoxesLimit
+	}
+	boxes, err := GetBoxStore(ctx).List(ctx, &store.BoxFilter{
+		CreatedAfter:  req.CreatedAfter,
+		CreatedBefore: req.CreatedBefore,
+		Status:        req.Status,
+		Emoji:         req.Emoji,
+		MinEmojiCount: req.MinEmojiCount,
+	}, req.Offset, limit)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "unexpected database error")
+		return nil, standard.InternalServiceError()
+	}
+	if boxes == nil {
+		boxes = []models.Box{}
+	}
+	return &models.ListBoxesResponse{Boxes: boxes}, nil
+}
+
+func GetBox(ctx context.Context, req *models.GetBoxRequest) (*models.GetBoxResponse, standard.Error) {
+	box, stdErr := getBox(ctx, req.Id)
+	if stdErr != nil {
+		return nil, stdErr
+	}
+	return (*models.GetBoxResponse)(box), nil
+}
+
+func HideBox(ctx context.Context, req *models.HideBoxRequest) (*models.HideBoxResponse, standard.Error) {
+	box, stdErr := hideBox(ctx, req.Id)
+	if stdErr != nil {
+		return nil, stdErr
+	}
+	return (*models.HideBoxResponse)(box), nil
+}
+
+// UnhideBox approves a Box, whatever its status was. The report statistics are reset so that the
+// Box is not hidden again by the reports that have already been reviewed.
+func UnhideBox(ctx context.Context, req *models.UnhideBoxRequest) (*models.UnhideBoxResponse, standard.Error) {
+	status := models.BoxStatusApproved
+	box, stdErr := updateBoxStatus(ctx, req.Id, &store.BoxUpdate{Status: &status, ClearReports: true})
+	if stdErr != nil {
+		return nil, stdErr
+	}
+	if !box.Expired(time.Now()) && !box.Exhausted() {
+		if err := GetQueueClient(ctx).Sync(ctx, (*models.SyncRequest)(models.NewQueueItem(box))); err != nil {
+			log.FromContext(ctx).Error(err, "sync unhidden Box", "id", box.Id)
+		}
+	}
+	return (*models.UnhideBoxResponse)(box), nil
+}
+
+func PurgeBox(ctx context.Context, req *models.PurgeBoxRequest) (models.PurgeBoxResponse, standard.Error) {
+	if err := deleteBox(ctx, req.Id); err != nil {
+		return models.PurgeBoxResponse{}, err
+	}
+	log.FromContext(ctx).Info("Box purged", "id", req.Id)
+	return models.PurgeBoxResponse{}, nil
+}
+
+func getBox(ctx context.Context, id string) (*models.Box, standard.Error) {
+	box, err := GetBoxStore(ctx).Get(ctx, id)
+	if err != nil {
+		if err == store.ErrNotFound {
+			return nil, standard.ResourceNotFound(id)
+		}
+		log.FromContext(ctx).Error(err, "unexpected database error")
+		return nil, standard.InternalServiceError()
+	}
+	return box, nil
+}
+
+// hideBox takes a Box down and removes it from the queue.
+func hideBox(ctx context.Context, id string) (*models.Box, standard.Error) {
+	status := models.BoxStatusHidden
+	box, stdErr := updateBoxStatus(ctx, id, &store.BoxUpdate{Status: &status})
+	if stdErr != nil {
+		return nil, stdErr
+	}
+	if err := GetQueueClient(ctx).Remove(ctx, &models.RemoveRequest{Id: id}); err != nil {
+		// ViewBox skips hidden Boxes, and the next resync drops it from the queue anyway
+		log.FromContext(ctx).Error(err, "remove hidden Box from queue", "id", id)
+	}
+	return box, nil
+}
+
+func updateBoxStatus(ctx context.Context, id string, update *store.BoxUpdate) (*models.Box, standard.Error) {
+	box, err := GetBoxStore(ctx).Update(ctx, id, update)
+	if err != nil {
+		if err == store.ErrNotFound {
+			return nil, standard.ResourceNotFound(id)
+		}
+		log.FromContext(ctx).Error(err, "unexpected database error")
+		return nil, standard.InternalServiceError()
+	}
+	log.FromContext(ctx).Info("Box status changed", "id", id, "status", box.Status)
+	return box, nil
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/lichuan0620/secret-keeper-backend/internal/queueclient"
+	"github.com/lichuan0620/secret-keeper-backend/internal/store"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/standard"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/telemetry/log"
+)
+
+const (
+	// fallbackCandidates is the number of least recently viewed Boxes a fallback view picks from
+	// at random, so that concurrent viewers do not all get the same Box.
+	fallbackCandidates = 20
+	// healthCheckInterval is how often the health of the queue is checked in degraded mode.
+	healthCheckInterval = 5 * time.Second
+)
+
+// Degraded keeps ViewBox working while the queue is unavailable. Once a call to the queue fails,
+// ViewBox serves the least recently viewed Boxes from the store instead and flags its responses
+// as degraded, until the health check of the queue succeeds again.
+type Degraded struct {
+	qc     queueclient.Interface
+	active int32
+	logger logr.Logger
+}
+
+// NewDegraded returns a Degraded checking the health of the queue through qc.
+func NewDegraded(qc queueclient.Interface) *Degraded {
+	return &Degraded{
+		qc:     qc,
+		logger: log.New().WithName("degraded"),
+	}
+}
+
+// Active tells if ViewBox skips the queue.
+func (d *Degraded) Active() bool {
+	return atomic.LoadInt32(&d.active) == 1
+}
+
+// enter switches to the degraded mode after the queue has failed with err.
+func (d *Degraded) enter(err error) {
+	if atomic.CompareAndSwapInt32(&d.active, 0, 1) {
+		d.logger.Error(err, "queue is unavailable, serving Boxes from the store")
+	}
+}
+
+// Run checks the health of the queue periodically in degraded mode, and leaves it once the queue
+// is healthy, until stopCh is closed.
+func (d *Degraded) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			if d.Active() {
+				d.check(context.Background())
+			}
+		}
+	}
+}
+
+func (d *Degraded) check(ctx context.Context) {
+	if err := d.qc.Health(ctx); err != nil {
+		d.logger.V(log.LevelExtended).Info("queue still unavailable", "error", err.Error())
+		return
+	}
+	if atomic.CompareAndSwapInt32(&d.active, 1, 0) {
+		d.logger.Info("queue is back, leaving degraded mode")
+	}
+}
+
+// viewFallback serves ViewBox from the store: it picks one of the least recently viewed Boxes at
+// random and records the view directly, from where the queue picks it up with its next resync.
+func viewFallback(ctx context.Context) (*models.ViewBoxResponse, standard.Error) {
+	logger := log.FromContext(ctx)
+	bs := GetBoxStore(ctx)
+	boxes, err := bs.ListLeastRecentlyViewed(ctx, fallbackCandidates)
+	if err != nil {
+		logger.Error(err, "unexpected database error")
+		return nil, standard.InternalServiceError()
+	}
+	if len(boxes) == 0 {
+		logger.Error(nil, "no available Box in the store")
+		return nil, standard.InternalServiceError()
+	}
+	box := &boxes[rand.Intn(len(boxes))]
+	now := time.Now()
+	if err = bs.MarkViewed(ctx, []store.BoxViews{{Id: box.Id, Count: 1, LastViewed: now}}); err != nil {
+		// the Box is served all the same; only its view is not counted
+		logger.Error(err, "mark Box viewed", "id", box.Id)
+	}
+	box.Views++
+	box.LastViewed = &now
+	box.ReportCount, box.ReportReasons = 0, nil
+	service.MarkDegraded(ctx)
+	return (*models.ViewBoxResponse)(box), nil
+}
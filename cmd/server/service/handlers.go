@@ -4,15 +4,21 @@ import (
 	"context"
 	"time"
 
-	"github.com/globalsign/mgo"
-	"github.com/globalsign/mgo/bson"
 	"github.com/google/uuid"
+	"github.com/lichuan0620/secret-keeper-backend/internal/moderation"
+	"github.com/lichuan0620/secret-keeper-backend/internal/queueclient"
+	"github.com/lichuan0620/secret-keeper-backend/internal/store"
 	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
-	"github.com/lichuan0620/secret-keeper-backend/pkg/mongo"
 	"github.com/lichuan0620/secret-keeper-backend/pkg/service/standard"
 	"github.com/lichuan0620/secret-keeper-backend/pkg/telemetry/log"
 )
 
+// HeaderViewerID carries an anonymous viewer ID; ViewBox avoids handing out Boxes the same viewer
+// has recently seen. It is optional.
+const HeaderViewerID = "X-Viewer-Id"
+
+const maxViewerIDSize = 128
+
 var location *time.Location
 
 func init() {
@@ -21,76 +27,236 @@ func init() {
 
 func CreateBox(ctx context.Context, req *models.CreateBoxRequest) (*models.CreateBoxResponse, standard.Error) {
 	logger := log.FromContext(ctx)
-	if req.Body == "" {
-		return nil, standard.InvalidParameter("Body")
-	}
-	db := mongo.DB()
-	defer db.Session.Close()
 	now := time.Now().In(location)
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		return nil, standard.InvalidParameter("ExpiresAt")
+	}
+	result := GetModerator(ctx).Moderate(req.Body)
+	if result.Action == moderation.ActionReject {
+		return nil, contentRejected(result)
+	}
 	box := models.Box{
 		Id:         uuid.New().String(),
 		CreatedAt:  &now,
 		Body:       req.Body,
 		LastViewed: &now,
+		ExpiresAt:  req.ExpiresAt,
+		MaxViews:   req.MaxViews,
+		Status:     moderatedStatus(result),
 	}
-	if err := db.C(mongo.CollectionBox).Insert(&box); err != nil {
+	token, tokenHash, err := newManagementToken()
+	if err != nil {
+		logger.Error(err, "generate management token")
+		return nil, standard.InternalServiceError()
+	}
+	box.TokenHash = tokenHash
+	if err = GetBoxStore(ctx).Create(ctx, &box); err != nil {
 		logger.Error(err, "unexpected database error")
 		return nil, standard.InternalServiceError()
 	}
+	if !box.Approved() {
+		return &models.CreateBoxResponse{
+			Box:             box,
+			ManagementToken: token,
+		}, nil
+	}
 	qc := GetQueueClient(ctx)
 	go func() {
-		if err := qc.Sync(context.TODO(), &models.SyncRequest{
-			Id:    box.Id,
-			Score: now.UnixNano(),
-		}); err != nil {
+		if err := qc.Sync(context.TODO(), (*models.SyncRequest)(models.NewQueueItem(&box))); err != nil {
 			logger.Error(err, "sync created Box")
 		}
 	}()
-	return (*models.CreateBoxResponse)(&box), nil
+	return &models.CreateBoxResponse{
+		Box:             box,
+		ManagementToken: token,
+	}, nil
 }
 
-func AddBoxEmoji(ctx context.Context, req *models.AddBoxEmojiRequest) (*models.AddBoxEmojiResponse, standard.Error) {
-	db := mongo.DB()
-	defer db.Session.Close()
-	if len(req.EmojiFeedbacks) > 0 {
-		incOpt := make(bson.M, len(req.EmojiFeedbacks))
-		for k, v := range req.EmojiFeedbacks {
-			incOpt["EmojiFeedbacks."+k] = v
+func UpdateBox(ctx context.Context, req *models.UpdateBoxRequest) (*models.UpdateBoxResponse, standard.Error) {
+	logger := log.FromContext(ctx)
+	box, stdErr := authorizeManagement(ctx, req.Id, req.ManagementToken)
+	if stdErr != nil {
+		return nil, stdErr
+	}
+	result := GetModerator(ctx).Moderate(req.Body)
+	if result.Action == moderation.ActionReject {
+		return nil, contentRejected(result)
+	}
+	update := store.BoxUpdate{Body: &req.Body}
+	wasApproved := box.Approved()
+	if wasApproved || box.Status == models.BoxStatusPending {
+		status := moderatedStatus(result)
+		update.Status = &status
+	}
+	box, err := GetBoxStore(ctx).Update(ctx, req.Id, &update)
+	if err != nil {
+		if err == store.ErrNotFound {
+			return nil, standard.ResourceNotFound(req.Id)
 		}
-		if err := db.C(mongo.CollectionBox).UpdateId(req.Id, bson.M{"$inc": incOpt}); err != nil {
-			if err == mgo.ErrNotFound {
-				return nil, standard.ResourceNotFound(req.Id)
-			}
-			log.FromContext(ctx).Error(err, "unexpected database error")
-			return nil, standard.InternalServiceError()
+		logger.Error(err, "unexpected database error")
+		return nil, standard.InternalServiceError()
+	}
+	qc := GetQueueClient(ctx)
+	if isApproved := box.Approved(); wasApproved && !isApproved {
+		if err = qc.Remove(ctx, &models.RemoveRequest{Id: box.Id}); err != nil {
+			logger.Error(err, "remove Box pending review from queue", "id", box.Id)
 		}
+	} else if !wasApproved && isApproved {
+		if err = qc.Sync(ctx, (*models.SyncRequest)(models.NewQueueItem(box))); err != nil {
+			logger.Error(err, "sync approved Box", "id", box.Id)
+		}
+	}
+	return (*models.UpdateBoxResponse)(box), nil
+}
+
+func DeleteBox(ctx context.Context, req *models.DeleteBoxRequest) (models.DeleteBoxResponse, standard.Error) {
+	if _, err := authorizeManagement(ctx, req.Id, req.ManagementToken); err != nil {
+		return models.DeleteBoxResponse{}, err
+	}
+	if err := deleteBox(ctx, req.Id); err != nil {
+		return models.DeleteBoxResponse{}, err
+	}
+	return models.DeleteBoxResponse{}, nil
+}
+
+// deleteBox removes a Box along with its Replies and Reports, and takes it out of the queue.
+func deleteBox(ctx context.Context, id string) standard.Error {
+	logger := log.FromContext(ctx)
+	if err := GetBoxStore(ctx).Delete(ctx, id); err != nil {
+		if err == store.ErrNotFound {
+			return standard.ResourceNotFound(id)
+		}
+		logger.Error(err, "unexpected database error")
+		return standard.InternalServiceError()
+	}
+	if err := GetReplyStore(ctx).DeleteByBox(ctx, id); err != nil {
+		logger.Error(err, "delete Replies of deleted Box", "id", id)
 	}
-	var box models.Box
-	if err := db.C(mongo.CollectionBox).FindId(req.Id).One(&box); err != nil {
-		if err == mgo.ErrNotFound {
+	if err := GetReportStore(ctx).DeleteByBox(ctx, id); err != nil {
+		logger.Error(err, "delete Reports of deleted Box", "id", id)
+	}
+	if err := GetQueueClient(ctx).Remove(ctx, &models.RemoveRequest{Id: id}); err != nil {
+		// the next resync drops the Box from the queue anyway, and ViewBox skips Boxes that no
+		// longer exist in the meantime
+		logger.Error(err, "remove deleted Box from queue", "id", id)
+	}
+	return nil
+}
+
+// authorizeManagement checks the management token against the stored Box and returns the Box.
+func authorizeManagement(ctx context.Context, id, token string) (*models.Box, standard.Error) {
+	box, err := GetBoxStore(ctx).Get(ctx, id)
+	if err != nil {
+		if err == store.ErrNotFound {
+			return nil, standard.ResourceNotFound(id)
+		}
+		log.FromContext(ctx).Error(err, "unexpected database error")
+		return nil, standard.InternalServiceError()
+	}
+	if !verifyManagementToken(box, token) {
+		return nil, standard.InvalidAuthorization()
+	}
+	return box, nil
+}
+
+func moderatedStatus(result moderation.Result) models.BoxStatus {
+	switch result.Action {
+	case moderation.ActionReject:
+		return models.BoxStatusRejected
+	case moderation.ActionReview:
+		return models.BoxStatusPending
+	default:
+		return models.BoxStatusApproved
+	}
+}
+
+func contentRejected(result moderation.Result) standard.Error {
+	return standard.ContentRejected(result.Reason).SetData(map[string]string{
+		"Filter": result.Filter,
+	})
+}
+
+func AddBoxEmoji(ctx context.Context, req *models.AddBoxEmojiRequest) (*models.AddBoxEmojiResponse, standard.Error) {
+	box, err := GetBoxStore(ctx).AddEmoji(ctx, req.Id, req.EmojiFeedbacks)
+	if err != nil {
+		if err == store.ErrNotFound {
 			return nil, standard.ResourceNotFound(req.Id)
 		}
 		log.FromContext(ctx).Error(err, "unexpected database error")
 		return nil, standard.InternalServiceError()
 	}
+	if box.Approved() && len(req.EmojiFeedbacks) > 0 {
+		// keep the engagement known to the queue up to date for the weighted strategies
+		logger, qc := log.FromContext(ctx), GetQueueClient(ctx)
+		go func() {
+			if err := qc.Sync(context.TODO(), (*models.SyncRequest)(models.NewQueueItem(box))); err != nil {
+				logger.Error(err, "sync Box engagement", "id", box.Id)
+			}
+		}()
+	}
 	return &models.AddBoxEmojiResponse{
 		Id:             req.Id,
 		EmojiFeedbacks: box.EmojiFeedbacks,
 	}, nil
 }
 
-func ViewBox(ctx context.Context) (*models.ViewBoxResponse, standard.Error) {
-	resp, err := GetQueueClient(ctx).Dequeue(ctx)
-	if err != nil {
-		log.FromContext(ctx).Error(err, "view item from queue")
-		return nil, standard.InternalServiceError()
+func ViewBox(ctx context.Context, viewerID string) (*models.ViewBoxResponse, standard.Error) {
+	// the queue never hands out expired or exhausted Boxes, but its view of a Box can lag behind
+	// the database, e.g. a Box being removed by the TTL index; retry a few times in such cases
+	const attempts = 3
+	logger := log.FromContext(ctx)
+	degraded := GetDegraded(ctx)
+	if degraded != nil && degraded.Active() {
+		return viewFallback(ctx)
 	}
-	db := mongo.DB()
-	defer db.Session.Close()
-	var box models.Box
-	if err = db.C(mongo.CollectionBox).FindId(resp.Id).One(&box); err != nil {
-		log.FromContext(ctx).Error(err, "unexpected database error", "id", resp.Id)
-		return nil, standard.InternalServiceError()
+	for i := 0; i < attempts; i++ {
+		if p := GetPrefetcher(ctx); p != nil {
+			// a prefetched Box is checked for availability when taken from the pool, which comes
+			// up empty if a whole batch turns out unavailable
+			box, err := p.View(ctx, viewerID)
+			if err == queueclient.ErrNoData {
+				logger.V(log.LevelExtended).Info("no available prefetched Box")
+				continue
+			} else if err != nil {
+				if degraded != nil {
+					degraded.enter(err)
+					return viewFallback(ctx)
+				}
+				logger.Error(err, "view prefetched Box")
+				return nil, standard.InternalServiceError()
+			}
+			box.ReportCount, box.ReportReasons = 0, nil
+			return (*models.ViewBoxResponse)(box), nil
+		}
+		resp, err := GetQueueClient(ctx).Dequeue(ctx, &models.DequeueRequest{ViewerId: viewerID})
+		if err != nil {
+			// an empty queue is no reason for the fallback
+			if degraded != nil && err != queueclient.ErrNoData {
+				degraded.enter(err)
+				return viewFallback(ctx)
+			}
+			logger.Error(err, "view item from queue")
+			return nil, standard.InternalServiceError()
+		}
+		box, err := GetBoxStore(ctx).Get(ctx, resp.Id)
+		if err != nil {
+			if err == store.ErrNotFound {
+				logger.V(log.LevelExtended).Info("dequeued Box no longer exists", "id", resp.Id)
+				continue
+			}
+			logger.Error(err, "unexpected database error", "id", resp.Id)
+			return nil, standard.InternalServiceError()
+		}
+		// the view just handed out may already be written to the store, so a Box at its MaxViews
+		// is still available here
+		if box.Expired(time.Now()) || (box.MaxViews > 0 && box.Views > box.MaxViews) || !box.Approved() {
+			logger.V(log.LevelExtended).Info("dequeued Box is no longer available", "id", resp.Id)
+			continue
+		}
+		// report statistics are only meant for operators
+		box.ReportCount, box.ReportReasons = 0, nil
+		return (*models.ViewBoxResponse)(box), nil
 	}
-	return (*models.ViewBoxResponse)(&box), nil
+	logger.Error(nil, "no available Box after retries", "attempts", attempts)
+	return nil, standard.InternalServiceError()
 }
@@ -3,11 +3,22 @@ package service
 import (
 	"context"
 
+	"github.com/lichuan0620/secret-keeper-backend/internal/moderation"
 	"github.com/lichuan0620/secret-keeper-backend/internal/queueclient"
+	"github.com/lichuan0620/secret-keeper-backend/internal/store"
 	servicemodel "github.com/lichuan0620/secret-keeper-backend/pkg/service/model"
 )
 
-var contextKeyQueueClient interface{} = new(byte)
+var (
+	contextKeyQueueClient interface{} = new(byte)
+	contextKeyPrefetcher  interface{} = new(byte)
+	contextKeyDegraded    interface{} = new(byte)
+	contextKeyBoxStore    interface{} = new(byte)
+	contextKeyReplyStore  interface{} = new(byte)
+	contextKeyModerator   interface{} = new(byte)
+	contextKeyReportStore interface{} = new(byte)
+	contextKeyHideLimit   interface{} = new(byte)
+)
 
 func WithQueueClient(qc queueclient.Interface) servicemodel.Middleware {
 	return func(ctx context.Context, f func(context.Context)) {
@@ -18,3 +29,77 @@ func WithQueueClient(qc queueclient.Interface) servicemodel.Middleware {
 func GetQueueClient(ctx context.Context) queueclient.Interface {
 	return ctx.Value(contextKeyQueueClient).(queueclient.Interface)
 }
+
+func WithPrefetcher(p *queueclient.Prefetcher) servicemodel.Middleware {
+	return func(ctx context.Context, f func(context.Context)) {
+		f(context.WithValue(ctx, contextKeyPrefetcher, p))
+	}
+}
+
+// GetPrefetcher returns the Prefetcher, or nil if Boxes are not prefetched.
+func GetPrefetcher(ctx context.Context) *queueclient.Prefetcher {
+	return ctx.Value(contextKeyPrefetcher).(*queueclient.Prefetcher)
+}
+
+func WithDegraded(d *Degraded) servicemodel.Middleware {
+	return func(ctx context.Context, f func(context.Context)) {
+		f(context.WithValue(ctx, contextKeyDegraded, d))
+	}
+}
+
+// GetDegraded returns the Degraded, or nil if ViewBox fails while the queue is unavailable.
+func GetDegraded(ctx context.Context) *Degraded {
+	return ctx.Value(contextKeyDegraded).(*Degraded)
+}
+
+func WithBoxStore(bs store.BoxStore) servicemodel.Middleware {
+	return func(ctx context.Context, f func(context.Context)) {
+		f(context.WithValue(ctx, contextKeyBoxStore, bs))
+	}
+}
+
+func GetBoxStore(ctx context.Context) store.BoxStore {
+	return ctx.Value(contextKeyBoxStore).(store.BoxStore)
+}
+
+func WithReplyStore(rs store.ReplyStore) servicemodel.Middleware {
+	return func(ctx context.Context, f func(context.Context)) {
+		f(context.WithValue(ctx, contextKeyReplyStore, rs))
+	}
+}
+
+func GetReplyStore(ctx context.Context) store.ReplyStore {
+	return ctx.Value(contextKeyReplyStore).(store.ReplyStore)
+}
+
+func WithModerator(m *moderation.Moderator) servicemodel.Middleware {
+	return func(ctx context.Context, f func(context.Context)) {
+		f(context.WithValue(ctx, contextKeyModerator, m))
+	}
+}
+
+func GetModerator(ctx context.Context) *moderation.Moderator {
+	return ctx.Value(contextKeyModerator).(*moderation.Moderator)
+}
+
+func WithReportStore(rs store.ReportStore) servicemodel.Middleware {
+	return func(ctx context.Context, f func(context.Context)) {
+		f(context.WithValue(ctx, contextKeyReportStore, rs))
+	}
+}
+
+func GetReportStore(ctx context.Context) store.ReportStore {
+	return ctx.Value(contextKeyReportStore).(store.ReportStore)
+}
+
+// WithReportHideThreshold sets the number of reports after which a Box is hidden; 0 disables
+// automatic hiding.
+func WithReportHideThreshold(threshold uint) servicemodel.Middleware {
+	return func(ctx context.Context, f func(context.Context)) {
+		f(context.WithValue(ctx, contextKeyHideLimit, threshold))
+	}
+}
+
+func GetReportHideThreshold(ctx context.Context) uint {
+	return ctx.Value(contextKeyHideLimit).(uint)
+}
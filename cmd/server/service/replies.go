@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lichuan0620/secret-keeper-backend/internal/store"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/standard"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/telemetry/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	maxRepliesPerBox = 1000
+
+	defaultListRepliesLimit = 20
+)
+
+func CreateReply(ctx context.Context, req *models.CreateReplyRequest) (*models.CreateReplyResponse, standard.Error) {
+	logger := log.FromContext(ctx)
+	bs, rs := GetBoxStore(ctx), GetReplyStore(ctx)
+	box, err := bs.Get(ctx, req.BoxId)
+	if err != nil {
+		if err == store.ErrNotFound {
+			return nil, standard.ResourceNotFound(req.BoxId)
+		}
+		logger.Error(err, "unexpected database error")
+		return nil, standard.InternalServiceError()
+	}
+	if box.Expired(time.Now()) || !box.Approved() {
+		return nil, standard.ResourceNotFound(req.BoxId)
+	}
+	if req.ParentId != "" {
+		parent, err := rs.Get(ctx, req.ParentId)
+		if err != nil && err != store.ErrNotFound {
+			logger.Error(err, "unexpected database error")
+			return nil, standard.InternalServiceError()
+		}
+		if parent == nil || parent.BoxId != req.BoxId {
+			return nil, standard.InvalidParameter("ParentId")
+		}
+	}
+	if err = bs.IncrementReplyCount(ctx, req.BoxId, maxRepliesPerBox); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			return nil, standard.ResourceNotFound(req.BoxId)
+		case store.ErrLimitExceeded:
+			return nil, standard.ExceededLimit("RepliesPerBox")
+		}
+		logger.Error(err, "unexpected database error")
+		return nil, standard.InternalServiceError()
+	}
+	now := time.Now().In(location)
+	reply := models.Reply{
+		Id:        uuid.New().String(),
+		BoxId:     req.BoxId,
+		ParentId:  req.ParentId,
+		CreatedAt: &now,
+		Body:      req.Body,
+	}
+	if err = rs.Create(ctx, &reply); err != nil {
+		logger.Error(err, "unexpected database error")
+		if err = bs.DecrementReplyCount(ctx, req.BoxId); err != nil {
+			logger.Error(err, "revert Box reply count", "id", req.BoxId)
+		}
+		return nil, standard.InternalServiceError()
+	}
+	return (*models.CreateReplyResponse)(&reply), nil
+}
+
+func ListReplies(ctx context.Context, req *models.ListRepliesRequest) (*models.ListRepliesResponse, standard.Error) {
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultListRepliesLimit
+	}
+	var after *store.ReplyCursor
+	if req.Cursor != "" {
+		cursor, err := decodeReplyCursor(req.Cursor)
+		if err != nil {
+			return nil, standard.MalformedParameter("Cursor")
+		}
+		after = cursor
+	}
+	// fetch one extra Reply to tell if there is a next page
+	replies, err := GetReplyStore(ctx).List(ctx, req.BoxId, req.ParentId, after, limit+1)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "unexpected database error")
+		return nil, standard.InternalServiceError()
+	}
+	resp := models.ListRepliesResponse{Replies: replies}
+	if len(replies) > limit {
+		resp.Replies = replies[:limit]
+		resp.NextCursor = encodeReplyCursor(&replies[limit-1])
+	}
+	if resp.Replies == nil {
+		resp.Replies = []models.Reply{}
+	}
+	return &resp, nil
+}
+
+func encodeReplyCursor(reply *models.Reply) string {
+	return base64.RawURLEncoding.EncodeToString(
+		[]byte(strconv.FormatInt(reply.CreatedAt.UnixNano(), 10) + ":" + reply.Id),
+	)
+}
+
+func decodeReplyCursor(cursor string) (*store.ReplyCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, errors.New("invalid cursor format")
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &store.ReplyCursor{
+		CreatedAt: time.Unix(0, nanos),
+		Id:        parts[1],
+	}, nil
+}
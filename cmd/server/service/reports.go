@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/lichuan0620/secret-keeper-backend/internal/store"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/standard"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/telemetry/log"
+)
+
+const (
+	// HeaderReporterFingerprint identifies the reporter of a Box; every reporter is only counted
+	// once per Box.
+	HeaderReporterFingerprint = "X-Reporter-Fingerprint"
+
+	defaultReportedBoxesLimit  = 20
+	maxReporterFingerprintSize = 256
+)
+
+func ReportBox(ctx context.Context, fingerprint string, req *models.ReportBoxRequest) (*models.ReportBoxResponse, standard.Error) {
+	logger := log.FromContext(ctx)
+	bs := GetBoxStore(ctx)
+	if _, err := bs.Get(ctx, req.Id); err != nil {
+		if err == store.ErrNotFound {
+			return nil, standard.ResourceNotFound(req.Id)
+		}
+		logger.Error(err, "unexpected database error")
+		return nil, standard.InternalServiceError()
+	}
+	now := time.Now().In(location)
+	err := GetReportStore(ctx).Create(ctx, &models.Report{
+		Id:        reportID(req.Id, fingerprint),
+		BoxId:     req.Id,
+		Reason:    req.Reason,
+		Comment:   req.Comment,
+		CreatedAt: &now,
+	})
+	if err == store.ErrDuplicated {
+		// reporting the same Box again is not an error, it is just not counted
+		return &models.ReportBoxResponse{}, nil
+	} else if err != nil {
+		logger.Error(err, "unexpected database error")
+		return nil, standard.InternalServiceError()
+	}
+	box, err := bs.AddReport(ctx, req.Id, req.Reason)
+	if err != nil {
+		if err == store.ErrNotFound {
+			return nil, standard.ResourceNotFound(req.Id)
+		}
+		logger.Error(err, "unexpected database error")
+		return nil, standard.InternalServiceError()
+	}
+	if threshold := GetReportHideThreshold(ctx); threshold > 0 && box.ReportCount >= threshold && box.Approved() {
+		hideReportedBox(ctx, box)
+	}
+	return &models.ReportBoxResponse{}, nil
+}
+
+// hideReportedBox takes a Box that has been reported too many times down until an operator
+// looks at it.
+func hideReportedBox(ctx context.Context, box *models.Box) {
+	if _, stdErr := hideBox(ctx, box.Id); stdErr == nil {
+		log.FromContext(ctx).Info("reported Box hidden", "id", box.Id, "reports", box.ReportCount)
+	}
+}
+
+func ListReportedBoxes(
+	ctx context.Context, req *models.ListReportedBoxesRequest,
+) (*models.ListReportedBoxesResponse, standard.Error) {
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultReportedBoxesLimit
+	}
+	boxes, err := GetBoxStore(ctx).ListReported(ctx, req.MinReportCount, req.Offset, limit)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "unexpected database error")
+		return nil, standard.InternalServiceError()
+	}
+	if boxes == nil {
+		boxes = []models.Box{}
+	}
+	return &models.ListReportedBoxesResponse{Boxes: boxes}, nil
+}
+
+// reportID derives the Report ID from the Box and the reporter so that the store can deduplicate
+// Reports without keeping the raw fingerprint.
+func reportID(boxID, fingerprint string) string {
+	sum := sha256.Sum256([]byte(boxID + "\x00" + fingerprint))
+	return hex.EncodeToString(sum[:])
+}
@@ -4,51 +4,138 @@ import (
 	"net/http"
 	"reflect"
 	"runtime"
+	"strconv"
 	"strings"
 
+	"github.com/lichuan0620/secret-keeper-backend/internal/moderation"
 	"github.com/lichuan0620/secret-keeper-backend/internal/queueclient"
+	"github.com/lichuan0620/secret-keeper-backend/internal/store"
 	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
 	"github.com/lichuan0620/secret-keeper-backend/pkg/service"
 	"github.com/lichuan0620/secret-keeper-backend/pkg/service/middlewares"
 	servicemodel "github.com/lichuan0620/secret-keeper-backend/pkg/service/model"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/openapi"
 	"github.com/lichuan0620/secret-keeper-backend/pkg/telemetry/log"
 )
 
-func Build(qc queueclient.Interface) (http.Handler, error) {
+// Options are the dependencies of the server handlers.
+type Options struct {
+	QueueClient queueclient.Interface
+	Boxes       store.BoxStore
+	Replies     store.ReplyStore
+	Reports     store.ReportStore
+	// Prefetcher serves ViewBox from Boxes loaded ahead of time; nil takes Boxes from the queue
+	// one at a time. It should also be the QueueClient so that changed Boxes leave its pool.
+	Prefetcher *queueclient.Prefetcher
+	// Degraded serves ViewBox from the Box store while the queue is unavailable; nil fails
+	// ViewBox instead.
+	Degraded *Degraded
+	// Moderator checks submitted content; nil allows everything.
+	Moderator *moderation.Moderator
+	// ReportHideThreshold is the number of reports after which a Box is hidden; 0 disables
+	// automatic hiding.
+	ReportHideThreshold uint
+	// AdminToken protects the admin Actions; they reject every request if it is empty.
+	AdminToken string
+}
+
+func Build(opts *Options) (http.Handler, error) {
+	return NewBuilder(opts).Build()
+}
+
+// NewBuilder returns the Builder with the Actions of the server registered; the client in
+// pkg/client is generated from it.
+func NewBuilder(opts *Options) *service.Builder {
 	logger := log.New().WithName("handlers")
-	return (&service.Builder{
+	mutator := func(action *servicemodel.Action) {
+		action.Version = models.Version
+	}
+	dependencies := []servicemodel.Middleware{
+		WithQueueClient(opts.QueueClient),
+		WithPrefetcher(opts.Prefetcher),
+		WithDegraded(opts.Degraded),
+		WithBoxStore(opts.Boxes),
+		WithReplyStore(opts.Replies),
+		WithReportStore(opts.Reports),
+		WithModerator(opts.Moderator),
+		WithReportHideThreshold(opts.ReportHideThreshold),
+	}
+	builder := &service.Builder{
 		GlobalMiddlewares: []servicemodel.Middleware{
 			middlewares.WithLogger(logger),
 			middlewares.RequestLog(logger),
 		},
-	}).AddActionGroup(servicemodel.ActionGroup{
-		Mutator: func(action *servicemodel.Action) {
-			action.Version = models.Version
+		Batch: &service.BatchOptions{
+			Version: models.Version,
 		},
-		Middlewares: []servicemodel.Middleware{WithQueueClient(qc)},
+	}
+	return builder.AddActionGroup(servicemodel.ActionGroup{
+		Mutator:     mutator,
+		Middlewares: dependencies,
 		Actions: []servicemodel.Action{
 			buildStandardActionFromHandler(CreateBox),
+			buildStandardActionFromHandler(UpdateBox),
+			buildStandardActionFromHandler(DeleteBox),
 			buildStandardActionFromHandler(AddBoxEmoji),
+			buildStandardActionFromHandler(CreateReply),
+			buildStandardActionFromHandler(ListReplies),
 			{
-				Name:    "ViewBox",
+				Name: "ViewBox",
+				Parameters: []servicemodel.Parameter{{
+					Source:   servicemodel.ParameterSourceHeader,
+					Name:     HeaderViewerID,
+					Default:  "",
+					Validate: "max=" + strconv.Itoa(maxViewerIDSize),
+				}},
 				Handler: ViewBox,
 			},
+			{
+				Name: "ReportBox",
+				Parameters: []servicemodel.Parameter{
+					{
+						Source:   servicemodel.ParameterSourceHeader,
+						Name:     HeaderReporterFingerprint,
+						Validate: "max=" + strconv.Itoa(maxReporterFingerprintSize),
+					},
+					{
+						Source: servicemodel.ParameterSourceBody,
+						Name:   "Body",
+					},
+				},
+				Handler: ReportBox,
+			},
 		},
-	}).Build()
+	}, servicemodel.ActionGroup{
+		Mutator:     mutator,
+		Middlewares: append([]servicemodel.Middleware{middlewares.BearerToken(opts.AdminToken)}, dependencies...),
+		Actions: []servicemodel.Action{
+			buildStandardActionFromHandler(ListBoxes),
+			buildStandardActionFromHandler(ListReportedBoxes),
+			buildStandardActionFromHandler(GetBox),
+			buildStandardActionFromHandler(HideBox),
+			buildStandardActionFromHandler(UnhideBox),
+			buildStandardActionFromHandler(PurgeBox),
+		},
+	}, servicemodel.ActionGroup{
+		Mutator: mutator,
+		Actions: []servicemodel.Action{
+			openapi.NewAction(builder, openAPIOptions),
+		},
+	})
 }
 
-func buildStandardActionFromHandler(handler interface{}) servicemodel.Action {
-	handlerV := reflect.ValueOf(handler)
-	if handlerV.Kind() != reflect.Func {
-		panic("handler must be a function")
-	}
-	slice := strings.Split(runtime.FuncForPC(handlerV.Pointer()).Name(), ".")
-	return servicemodel.Action{
-		Name: slice[len(slice)-1],
-		Parameters: []servicemodel.Parameter{{
-			Source: servicemodel.ParameterSourceBody,
-			Name:   "Body",
-		}},
-		Handler: handler,
-	}
+var openAPIOptions = &openapi.Options{
+	Title:       "Secret Keeper",
+	Description: "The API of the Secret Keeper server. The admin Actions require the admin token as a bearer token.",
+}
+
+// OpenAPI returns the OpenAPI document of the server API, which is also served by the
+// DescribeAPI Action.
+func OpenAPI() (*openapi.Document, error) {
+	return openapi.Generate(NewBuilder(&Options{}).Actions(), openAPIOptions)
+}
+
+func buildStandardActionFromHandler[Req, Resp any](handler service.TypedHandler[Req, Resp]) servicemodel.Action {
+	slice := strings.Split(runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name(), ".")
+	return service.TypedAction(slice[len(slice)-1], handler)
 }
@@ -1,9 +1,578 @@
 package service
 
-import "testing"
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lichuan0620/secret-keeper-backend/internal/moderation"
+	"github.com/lichuan0620/secret-keeper-backend/internal/queue"
+	"github.com/lichuan0620/secret-keeper-backend/internal/queueclient"
+	"github.com/lichuan0620/secret-keeper-backend/internal/store"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service"
+	servicemodel "github.com/lichuan0620/secret-keeper-backend/pkg/service/model"
+)
 
 func TestBuild(t *testing.T) {
-	if _, err := Build(nil); err != nil {
+	if _, err := Build(&Options{}); err != nil {
 		t.Error(err)
 	}
 }
+
+func TestInMemory(t *testing.T) {
+	handler := newTestHandler(t, &Options{})
+	created := createBox(t, handler, "hello")
+	var viewed models.ViewBoxResponse
+	waitFor(t, func() bool {
+		return call(handler, "ViewBox", nil, &viewed) == http.StatusOK
+	})
+	if viewed.Id != created.Id || viewed.Body != "hello" {
+		t.Fatalf("expecting Box %s; got %+v", created.Id, viewed)
+	}
+	for _, tc := range []struct {
+		ViewerID     string
+		ExpectStatus int
+	}{
+		{ViewerID: "viewer", ExpectStatus: http.StatusOK},
+		{ViewerID: strings.Repeat("x", maxViewerIDSize+1), ExpectStatus: http.StatusBadRequest},
+	} {
+		header := http.Header{HeaderViewerID: []string{tc.ViewerID}}
+		if code := callWithHeader(handler, "ViewBox", header, nil, nil); code != tc.ExpectStatus {
+			t.Fatalf("view Box as %q: expecting status %d; got %d", tc.ViewerID, tc.ExpectStatus, code)
+		}
+	}
+
+	var batch servicemodel.BatchResponse
+	if code := call(handler, service.BatchActionName, &servicemodel.BatchRequest{
+		Entries: []servicemodel.BatchEntry{
+			{Action: "ViewBox"},
+			{Action: "AddBoxEmoji", Body: &models.AddBoxEmojiRequest{Id: created.Id, EmojiFeedbacks: map[string]uint{"smile": 1}}},
+			{Action: "ListBoxes", Body: &models.ListBoxesRequest{}},
+		},
+	}, &batch); code != http.StatusOK {
+		t.Fatalf("batch: expecting status %d; got %d", http.StatusOK, code)
+	}
+	for i, expectCode := range []string{"", "", "InvalidAuthorization"} {
+		resp, code := batch.Responses[i], ""
+		if resp.Error != nil {
+			code = resp.Error.Code
+		}
+		if code != expectCode {
+			t.Fatalf("batch entry %s: expecting error %q; got %+v", resp.Metadata.Action, expectCode, resp.Error)
+		}
+	}
+}
+
+func TestViewPrefetched(t *testing.T) {
+	bs := store.NewMemoryBoxStore()
+	prefetcher := queueclient.NewPrefetcher(queueclient.NewLocal(newTestQueue(t, bs)), bs, nil)
+	handler := newTestHandler(t, &Options{QueueClient: prefetcher, Boxes: bs, Prefetcher: prefetcher})
+	created := createBox(t, handler, "hello")
+	var viewed models.ViewBoxResponse
+	waitFor(t, func() bool {
+		return call(handler, "ViewBox", nil, &viewed) == http.StatusOK
+	})
+	if viewed.Id != created.Id || viewed.Views != 1 {
+		t.Fatalf("expecting the first view of Box %s; got %+v", created.Id, viewed)
+	}
+	// the deleted Box leaves the pool along with the queue
+	req := &models.DeleteBoxRequest{Id: created.Id, ManagementToken: created.ManagementToken}
+	if code := call(handler, "DeleteBox", req, nil); code != http.StatusOK {
+		t.Fatalf("delete Box: expecting status %d; got %d", http.StatusOK, code)
+	}
+	if code := call(handler, "ViewBox", nil, nil); code == http.StatusOK {
+		t.Fatal("expecting the deleted Box not to be viewed")
+	}
+}
+
+// failingQueue fails Dequeue and Health with err unless it is nil.
+type failingQueue struct {
+	queueclient.Interface
+	err error
+}
+
+func (f *failingQueue) Dequeue(ctx context.Context, req *models.DequeueRequest) (*models.DequeueResponse, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.Interface.Dequeue(ctx, req)
+}
+
+func (f *failingQueue) Health(ctx context.Context) error {
+	if f.err != nil {
+		return f.err
+	}
+	return f.Interface.Health(ctx)
+}
+
+func TestViewDegraded(t *testing.T) {
+	bs := store.NewMemoryBoxStore()
+	qc := &failingQueue{Interface: queueclient.NewLocal(newTestQueue(t, bs)), err: errors.New("unavailable")}
+	degraded := NewDegraded(qc)
+	handler := newTestHandler(t, &Options{QueueClient: qc, Boxes: bs, Degraded: degraded})
+	created := createBox(t, handler, "hello")
+	view := func() {
+		var viewed models.ViewBoxResponse
+		resp := servicemodel.Response{Result: &viewed}
+		if code := callForResponse(handler, "ViewBox", nil, &resp); code != http.StatusOK {
+			t.Fatalf("view Box: expecting status %d; got %d", http.StatusOK, code)
+		}
+		if viewed.Id != created.Id || !resp.Metadata.Degraded {
+			t.Fatalf("expecting a degraded view of Box %s; got %+v, %+v", created.Id, viewed, resp.Metadata)
+		}
+	}
+	view()
+	if box, _ := bs.Get(context.Background(), created.Id); box.Views != 1 {
+		t.Fatalf("expecting the fallback view to be recorded; got %d views", box.Views)
+	}
+	degraded.check(context.Background())
+	if !degraded.Active() {
+		t.Fatal("expecting the degraded mode while the queue fails")
+	}
+	view()
+
+	qc.err = nil
+	degraded.check(context.Background())
+	if degraded.Active() {
+		t.Fatal("expecting the degraded mode to end once the queue is healthy")
+	}
+	var resp servicemodel.Response
+	waitFor(t, func() bool {
+		return callForResponse(handler, "ViewBox", nil, &resp) == http.StatusOK
+	})
+	if resp.Metadata.Degraded {
+		t.Fatal("expecting the Box to come from the queue")
+	}
+}
+
+func TestManageBox(t *testing.T) {
+	bs := store.NewMemoryBoxStore()
+	q := newTestQueue(t, bs)
+	handler := newTestHandler(t, &Options{QueueClient: queueclient.NewLocal(q), Boxes: bs})
+	created := createBox(t, handler, "hello")
+	if created.ManagementToken == "" {
+		t.Fatal("expecting a management token")
+	}
+	waitFor(t, func() bool {
+		return call(handler, "ViewBox", nil, nil) == http.StatusOK
+	})
+
+	for _, tc := range []struct {
+		Action       string
+		Request      interface{}
+		ExpectStatus int
+	}{
+		{
+			Action:       "UpdateBox",
+			Request:      &models.UpdateBoxRequest{ManagementToken: created.ManagementToken, Body: "changed"},
+			ExpectStatus: http.StatusBadRequest,
+		},
+		{
+			Action:       "UpdateBox",
+			Request:      &models.UpdateBoxRequest{Id: created.Id, ManagementToken: "wrong", Body: "changed"},
+			ExpectStatus: http.StatusUnauthorized,
+		},
+		{
+			Action:       "UpdateBox",
+			Request:      &models.UpdateBoxRequest{Id: created.Id, ManagementToken: created.ManagementToken, Body: "changed"},
+			ExpectStatus: http.StatusOK,
+		},
+		{
+			Action:       "DeleteBox",
+			Request:      &models.DeleteBoxRequest{ManagementToken: created.ManagementToken},
+			ExpectStatus: http.StatusBadRequest,
+		},
+		{
+			Action:       "DeleteBox",
+			Request:      &models.DeleteBoxRequest{Id: created.Id},
+			ExpectStatus: http.StatusUnauthorized,
+		},
+		{
+			Action:       "DeleteBox",
+			Request:      &models.DeleteBoxRequest{Id: created.Id, ManagementToken: created.ManagementToken},
+			ExpectStatus: http.StatusOK,
+		},
+		{
+			Action:       "DeleteBox",
+			Request:      &models.DeleteBoxRequest{Id: created.Id, ManagementToken: created.ManagementToken},
+			ExpectStatus: http.StatusNotFound,
+		},
+	} {
+		if code := call(handler, tc.Action, tc.Request, nil); code != tc.ExpectStatus {
+			t.Fatalf("%s: expecting status %d; got %d", tc.Action, tc.ExpectStatus, code)
+		}
+	}
+	if _, err := q.Dequeue(queue.DequeueOptions{}); err != queue.ErrNoData {
+		t.Fatalf("expecting deleted Box to be removed from the queue; got %v", err)
+	}
+}
+
+func TestReplies(t *testing.T) {
+	handler := newTestHandler(t, &Options{})
+	box := createBox(t, handler, "hello")
+	var first models.CreateReplyResponse
+	if code := call(handler, "CreateReply", &models.CreateReplyRequest{BoxId: box.Id, Body: "first"}, &first); code != http.StatusOK {
+		t.Fatalf("create Reply: expecting status %d; got %d", http.StatusOK, code)
+	}
+	for i := 0; i < 4; i++ {
+		if code := call(handler, "CreateReply", &models.CreateReplyRequest{BoxId: box.Id, Body: "more"}, nil); code != http.StatusOK {
+			t.Fatalf("create Reply: expecting status %d; got %d", http.StatusOK, code)
+		}
+	}
+	if code := call(handler, "CreateReply", &models.CreateReplyRequest{
+		BoxId: box.Id, ParentId: first.Id, Body: "nested",
+	}, nil); code != http.StatusOK {
+		t.Fatalf("create nested Reply: expecting status %d; got %d", http.StatusOK, code)
+	}
+	if code := call(handler, "CreateReply", &models.CreateReplyRequest{
+		BoxId: "unknown", ParentId: first.Id, Body: "nested",
+	}, nil); code != http.StatusNotFound {
+		t.Fatalf("create Reply for unknown Box: expecting status %d; got %d", http.StatusNotFound, code)
+	}
+
+	var (
+		count int
+		resp  models.ListRepliesResponse
+	)
+	for page := 0; page == 0 || resp.NextCursor != ""; page++ {
+		req := &models.ListRepliesRequest{BoxId: box.Id, Cursor: resp.NextCursor, Limit: 2}
+		resp = models.ListRepliesResponse{}
+		if code := call(handler, "ListReplies", req, &resp); code != http.StatusOK {
+			t.Fatalf("list Replies: expecting status %d; got %d", http.StatusOK, code)
+		}
+		count += len(resp.Replies)
+	}
+	if count != 5 {
+		t.Fatalf("expecting 5 top-level Replies; got %d", count)
+	}
+	if code := call(handler, "ListReplies", &models.ListRepliesRequest{
+		BoxId: box.Id, Cursor: "not a cursor",
+	}, nil); code != http.StatusBadRequest {
+		t.Fatalf("list Replies with bad cursor: expecting status %d; got %d", http.StatusBadRequest, code)
+	}
+
+	var viewed models.ViewBoxResponse
+	waitFor(t, func() bool {
+		return call(handler, "ViewBox", nil, &viewed) == http.StatusOK
+	})
+	if viewed.ReplyCount != 6 {
+		t.Fatalf("expecting 6 Replies; got %d", viewed.ReplyCount)
+	}
+}
+
+func TestModeration(t *testing.T) {
+	moderator, err := (&moderation.Config{Filters: []moderation.FilterConfig{
+		{Type: "Keyword", Action: moderation.ActionReject, Keywords: []string{"spam"}},
+		{Type: "Link", Action: moderation.ActionReview},
+	}}).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs := store.NewMemoryBoxStore()
+	q := newTestQueue(t, bs)
+	handler := newTestHandler(t, &Options{QueueClient: queueclient.NewLocal(q), Boxes: bs, Moderator: moderator})
+
+	var rejected servicemodel.Response
+	if code := callForResponse(handler, "CreateBox", &models.CreateBoxRequest{Body: "buy spam"}, &rejected); code != http.StatusBadRequest {
+		t.Fatalf("create rejected Box: expecting status %d; got %d", http.StatusBadRequest, code)
+	}
+	if rejected.Error == nil || rejected.Error.Code != "ContentRejected" ||
+		rejected.Error.Data["Filter"] != "Keyword" || rejected.Error.Data["Reason"] == "" {
+		t.Fatalf("unexpected error for rejected Box: %+v", rejected.Error)
+	}
+	stored := 0
+	if err = bs.Scan(context.Background(), nil, func(*models.Box) error {
+		stored++
+		return nil
+	}); err != nil || stored != 0 {
+		t.Fatalf("expecting the rejected Box not to be stored; got %d Boxes, %v", stored, err)
+	}
+
+	var pending models.CreateBoxResponse
+	if code := call(handler, "CreateBox", &models.CreateBoxRequest{Body: "see example.com"}, &pending); code != http.StatusOK {
+		t.Fatalf("create pending Box: expecting status %d; got %d", http.StatusOK, code)
+	}
+	if pending.Status != models.BoxStatusPending {
+		t.Fatalf("expecting status %s; got %s", models.BoxStatusPending, pending.Status)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if _, err = q.Dequeue(queue.DequeueOptions{}); err != queue.ErrNoData {
+		t.Fatalf("expecting Box pending review not to be served; got %v", err)
+	}
+
+	var updated models.UpdateBoxResponse
+	if code := call(handler, "UpdateBox", &models.UpdateBoxRequest{
+		Id: pending.Id, ManagementToken: pending.ManagementToken, Body: "no link",
+	}, &updated); code != http.StatusOK {
+		t.Fatalf("update Box: expecting status %d; got %d", http.StatusOK, code)
+	}
+	if updated.Status != models.BoxStatusApproved {
+		t.Fatalf("expecting status %s; got %s", models.BoxStatusApproved, updated.Status)
+	}
+	var viewed models.ViewBoxResponse
+	waitFor(t, func() bool {
+		return call(handler, "ViewBox", nil, &viewed) == http.StatusOK
+	})
+	if viewed.Id != pending.Id {
+		t.Fatalf("expecting Box %s; got %s", pending.Id, viewed.Id)
+	}
+}
+
+func TestReports(t *testing.T) {
+	const adminToken = "admin"
+	bs := store.NewMemoryBoxStore()
+	q := newTestQueue(t, bs)
+	handler := newTestHandler(t, &Options{
+		QueueClient:         queueclient.NewLocal(q),
+		Boxes:               bs,
+		ReportHideThreshold: 2,
+		AdminToken:          adminToken,
+	})
+	box := createBox(t, handler, "hello")
+	waitFor(t, func() bool {
+		return call(handler, "ViewBox", nil, nil) == http.StatusOK
+	})
+
+	reporter := func(fingerprint string) http.Header {
+		return http.Header{HeaderReporterFingerprint: []string{fingerprint}}
+	}
+	for _, tc := range []struct {
+		Header       http.Header
+		Request      *models.ReportBoxRequest
+		ExpectStatus int
+	}{
+		{
+			Request:      &models.ReportBoxRequest{Id: box.Id, Reason: "Spam"},
+			ExpectStatus: http.StatusBadRequest,
+		},
+		{
+			Header:       reporter("a"),
+			Request:      &models.ReportBoxRequest{Id: box.Id, Reason: "Unknown"},
+			ExpectStatus: http.StatusBadRequest,
+		},
+		{
+			Header:       reporter("a"),
+			Request:      &models.ReportBoxRequest{Id: "unknown", Reason: "Spam"},
+			ExpectStatus: http.StatusNotFound,
+		},
+		{
+			Header:       reporter("a"),
+			Request:      &models.ReportBoxRequest{Id: box.Id, Reason: "Spam"},
+			ExpectStatus: http.StatusOK,
+		},
+		{
+			// the same reporter is only counted once
+			Header:       reporter("a"),
+			Request:      &models.ReportBoxRequest{Id: box.Id, Reason: "Abuse"},
+			ExpectStatus: http.StatusOK,
+		},
+	} {
+		if code := callWithHeader(handler, "ReportBox", tc.Header, tc.Request, nil); code != tc.ExpectStatus {
+			t.Fatalf("report %+v: expecting status %d; got %d", tc.Request, tc.ExpectStatus, code)
+		}
+	}
+	var viewed models.ViewBoxResponse
+	if code := call(handler, "ViewBox", nil, &viewed); code != http.StatusOK {
+		t.Fatalf("view Box: expecting status %d; got %d", http.StatusOK, code)
+	}
+	if viewed.ReportCount != 0 || viewed.ReportReasons != nil {
+		t.Fatalf("expecting report statistics to be hidden from viewers; got %+v", viewed)
+	}
+
+	if code := callWithHeader(
+		handler, "ReportBox", reporter("b"), &models.ReportBoxRequest{Id: box.Id, Reason: "Spam"}, nil,
+	); code != http.StatusOK {
+		t.Fatalf("report Box: expecting status %d; got %d", http.StatusOK, code)
+	}
+	if _, err := q.Dequeue(queue.DequeueOptions{}); err != queue.ErrNoData {
+		t.Fatalf("expecting hidden Box to be removed from the queue; got %v", err)
+	}
+
+	listRequest := &models.ListReportedBoxesRequest{MinReportCount: 1}
+	for _, header := range []http.Header{nil, {"Authorization": []string{"Bearer wrong"}}} {
+		if code := callWithHeader(handler, "ListReportedBoxes", header, listRequest, nil); code != http.StatusUnauthorized {
+			t.Fatalf("list reported Boxes without authorization: expecting status %d; got %d", http.StatusUnauthorized, code)
+		}
+	}
+	var listed models.ListReportedBoxesResponse
+	if code := callWithHeader(
+		handler, "ListReportedBoxes", http.Header{"Authorization": []string{"Bearer " + adminToken}}, listRequest, &listed,
+	); code != http.StatusOK {
+		t.Fatalf("list reported Boxes: expecting status %d; got %d", http.StatusOK, code)
+	}
+	if len(listed.Boxes) != 1 {
+		t.Fatalf("expecting 1 reported Box; got %d", len(listed.Boxes))
+	}
+	reported := listed.Boxes[0]
+	if reported.Id != box.Id || reported.ReportCount != 2 || reported.ReportReasons["Spam"] != 2 ||
+		reported.Status != models.BoxStatusHidden {
+		t.Fatalf("unexpected reported Box: %+v", reported)
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	const adminToken = "admin"
+	bs := store.NewMemoryBoxStore()
+	q := newTestQueue(t, bs)
+	handler := newTestHandler(t, &Options{QueueClient: queueclient.NewLocal(q), Boxes: bs, AdminToken: adminToken})
+	admin := http.Header{"Authorization": []string{"Bearer " + adminToken}}
+	first, second := createBox(t, handler, "hello"), createBox(t, handler, "hello")
+	if code := call(handler, "AddBoxEmoji", &models.AddBoxEmojiRequest{
+		Id: first.Id, EmojiFeedbacks: map[string]uint{"smile": 2},
+	}, nil); code != http.StatusOK {
+		t.Fatalf("add emoji: expecting status %d; got %d", http.StatusOK, code)
+	}
+	if code := call(handler, "AddBoxEmoji", &models.AddBoxEmojiRequest{
+		Id: first.Id, EmojiFeedbacks: map[string]uint{"$set.smile": 1},
+	}, nil); code != http.StatusBadRequest {
+		t.Fatalf("add emoji with a reserved character: expecting status %d; got %d", http.StatusBadRequest, code)
+	}
+	waitFor(t, func() bool {
+		return call(handler, "ViewBox", nil, nil) == http.StatusOK
+	})
+
+	if code := call(handler, "ListBoxes", &models.ListBoxesRequest{}, nil); code != http.StatusUnauthorized {
+		t.Fatalf("list Boxes without authorization: expecting status %d; got %d", http.StatusUnauthorized, code)
+	}
+	for _, tc := range []struct {
+		Request      *models.ListBoxesRequest
+		ExpectStatus int
+		Expected     int
+	}{
+		{Request: &models.ListBoxesRequest{}, ExpectStatus: http.StatusOK, Expected: 2},
+		{Request: &models.ListBoxesRequest{Limit: 1}, ExpectStatus: http.StatusOK, Expected: 1},
+		{Request: &models.ListBoxesRequest{Emoji: "smile", MinEmojiCount: 2}, ExpectStatus: http.StatusOK, Expected: 1},
+		{Request: &models.ListBoxesRequest{Status: models.BoxStatusHidden}, ExpectStatus: http.StatusOK, Expected: 0},
+		{Request: &models.ListBoxesRequest{Status: "Unknown"}, ExpectStatus: http.StatusBadRequest},
+		{Request: &models.ListBoxesRequest{Limit: 1000}, ExpectStatus: http.StatusBadRequest},
+	} {
+		var listed models.ListBoxesResponse
+		if code := callWithHeader(handler, "ListBoxes", admin, tc.Request, &listed); code != tc.ExpectStatus {
+			t.Fatalf("list Boxes %+v: expecting status %d; got %d", tc.Request, tc.ExpectStatus, code)
+		}
+		if tc.ExpectStatus == http.StatusOK && len(listed.Boxes) != tc.Expected {
+			t.Fatalf("list Boxes %+v: expecting %d Boxes; got %d", tc.Request, tc.Expected, len(listed.Boxes))
+		}
+	}
+
+	var box models.GetBoxResponse
+	if code := callWithHeader(handler, "HideBox", admin, &models.HideBoxRequest{Id: first.Id}, &box); code != http.StatusOK {
+		t.Fatalf("hide Box: expecting status %d; got %d", http.StatusOK, code)
+	}
+	if box.Status != models.BoxStatusHidden {
+		t.Fatalf("expecting Box to be hidden; got status %s", box.Status)
+	}
+	if code := callWithHeader(handler, "PurgeBox", admin, &models.PurgeBoxRequest{Id: second.Id}, nil); code != http.StatusOK {
+		t.Fatalf("purge Box: expecting status %d; got %d", http.StatusOK, code)
+	}
+	if code := callWithHeader(handler, "GetBox", admin, &models.GetBoxRequest{Id: second.Id}, nil); code != http.StatusNotFound {
+		t.Fatalf("get purged Box: expecting status %d; got %d", http.StatusNotFound, code)
+	}
+	if _, err := q.Dequeue(queue.DequeueOptions{}); err != queue.ErrNoData {
+		t.Fatalf("expecting hidden and purged Boxes to be removed from the queue; got %v", err)
+	}
+
+	if code := callWithHeader(handler, "UnhideBox", admin, &models.UnhideBoxRequest{Id: first.Id}, nil); code != http.StatusOK {
+		t.Fatalf("unhide Box: expecting status %d; got %d", http.StatusOK, code)
+	}
+	if code := callWithHeader(handler, "GetBox", admin, &models.GetBoxRequest{Id: first.Id}, &box); code != http.StatusOK {
+		t.Fatalf("get Box: expecting status %d; got %d", http.StatusOK, code)
+	}
+	if box.Status != models.BoxStatusApproved {
+		t.Fatalf("expecting Box to be approved; got status %s", box.Status)
+	}
+	var viewed models.ViewBoxResponse
+	waitFor(t, func() bool {
+		return call(handler, "ViewBox", nil, &viewed) == http.StatusOK
+	})
+	if viewed.Id != first.Id {
+		t.Fatalf("expecting Box %s; got %s", first.Id, viewed.Id)
+	}
+}
+
+// newTestQueue runs a queue over the Box store until the test ends.
+func newTestQueue(t *testing.T, bs store.BoxStore) queue.Interface {
+	q := queue.New(bs, nil)
+	stopCh := make(chan struct{})
+	t.Cleanup(func() {
+		close(stopCh)
+	})
+	go q.Run(stopCh)
+	waitFor(t, q.Ready)
+	return q
+}
+
+// newTestHandler builds the handler of the service with the given options, in which the stores
+// left unset are in-memory ones and the queue client defaults to that of a queue run by
+// newTestQueue.
+func newTestHandler(t *testing.T, opts *Options) http.Handler {
+	if opts.Boxes == nil {
+		opts.Boxes = store.NewMemoryBoxStore()
+	}
+	if opts.Replies == nil {
+		opts.Replies = store.NewMemoryReplyStore()
+	}
+	if opts.Reports == nil {
+		opts.Reports = store.NewMemoryReportStore()
+	}
+	if opts.QueueClient == nil {
+		opts.QueueClient = queueclient.NewLocal(newTestQueue(t, opts.Boxes))
+	}
+	handler, err := Build(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return handler
+}
+
+// createBox creates a Box with the given body through the handler.
+func createBox(t *testing.T, handler http.Handler, body string) *models.CreateBoxResponse {
+	var created models.CreateBoxResponse
+	if code := call(handler, "CreateBox", &models.CreateBoxRequest{Body: body}, &created); code != http.StatusOK {
+		t.Fatalf("create Box: expecting status %d; got %d", http.StatusOK, code)
+	}
+	return &created
+}
+
+func call(handler http.Handler, action string, body, result interface{}) int {
+	return send(handler, action, nil, body, &servicemodel.Response{Result: result})
+}
+
+func callWithHeader(handler http.Handler, action string, header http.Header, body, result interface{}) int {
+	return send(handler, action, header, body, &servicemodel.Response{Result: result})
+}
+
+func callForResponse(handler http.Handler, action string, body interface{}, resp *servicemodel.Response) int {
+	return send(handler, action, nil, body, resp)
+}
+
+func send(handler http.Handler, action string, header http.Header, body interface{}, resp *servicemodel.Response) int {
+	buf := bytes.NewBuffer(nil)
+	if body != nil {
+		_ = json.NewEncoder(buf).Encode(body)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/?Action="+action+"&Version="+models.Version, buf)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set(servicemodel.HeaderContentType, servicemodel.ContentTypeJSON)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	_ = json.Unmarshal(rr.Body.Bytes(), resp)
+	return rr.Code
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	for deadline := time.Now().Add(3 * time.Second); !condition(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+	"github.com/pkg/errors"
+)
+
+const managementTokenBytes = 32
+
+// newManagementToken generates a random management token and returns it along with its hash.
+func newManagementToken() (string, string, error) {
+	buf := make([]byte, managementTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", errors.Wrap(err, "generate random token")
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashManagementToken(token), nil
+}
+
+func hashManagementToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyManagementToken tells if the given token belongs to the Box. Boxes created before
+// management tokens were introduced cannot be managed.
+func verifyManagementToken(box *models.Box, token string) bool {
+	if box.TokenHash == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(box.TokenHash), []byte(hashManagementToken(token))) == 1
+}
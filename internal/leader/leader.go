@@ -0,0 +1,138 @@
+// Package leader elects one of several replicas as the leader with a lease.
+package leader
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/lichuan0620/secret-keeper-backend/internal/store"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/telemetry/log"
+)
+
+const (
+	// DefaultLeaseDuration is how long a lease lasts unless it is renewed.
+	DefaultLeaseDuration = 15 * time.Second
+	// renewFraction is the part of the lease duration after which the lease is renewed.
+	renewFraction = 3
+)
+
+// Options configure an Elector; the zero value is valid.
+type Options struct {
+	// LeaseDuration defaults to DefaultLeaseDuration. A new leader is elected within the duration
+	// after the previous one is gone.
+	LeaseDuration time.Duration
+	// OnElected is called in a new goroutine whenever the Elector becomes the leader.
+	OnElected func()
+	// Eligible tells if the replica can lead, e.g. once it has loaded its state; the replica
+	// only campaigns while it is eligible. It is always eligible if Eligible is nil.
+	Eligible func() bool
+}
+
+// Elector campaigns for a lease on behalf of a replica.
+type Elector struct {
+	leases    store.LeaseStore
+	name      string
+	id        string
+	duration  time.Duration
+	onElected func()
+	eligible  func() bool
+	logger    logr.Logger
+
+	// validUntil is when the lease held by the replica expires by its own clock; the replica is
+	// the leader until then
+	validUntil time.Time
+	lock       sync.RWMutex
+}
+
+// New returns an Elector campaigning for the lease of the given name as the replica of the
+// given ID, which must be unique among the replicas.
+func New(leases store.LeaseStore, name, id string, opts *Options) *Elector {
+	if opts == nil {
+		opts = &Options{}
+	}
+	ret := &Elector{
+		leases:    leases,
+		name:      name,
+		id:        id,
+		duration:  opts.LeaseDuration,
+		onElected: opts.OnElected,
+		eligible:  opts.Eligible,
+		logger:    log.New().WithName("leader").WithValues("lease", name, "id", id),
+	}
+	if ret.duration <= 0 {
+		ret.duration = DefaultLeaseDuration
+	}
+	return ret
+}
+
+// IsLeader tells if the replica is the leader.
+func (e *Elector) IsLeader() bool {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return time.Now().Before(e.validUntil)
+}
+
+// Run campaigns for the lease, and keeps renewing it once acquired, until stopCh is closed. The
+// lease is released when Run returns so that another replica takes over right away.
+func (e *Elector) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(e.duration / renewFraction)
+	defer ticker.Stop()
+	for {
+		if e.eligible == nil || e.eligible() {
+			e.campaign()
+		} else {
+			e.resign()
+		}
+		select {
+		case <-stopCh:
+			e.resign()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// campaign tries to acquire or renew the lease once.
+func (e *Elector) campaign() {
+	wasLeader := e.IsLeader()
+	// the lease is counted from before the request, so that it never outlives the stored one
+	start := time.Now()
+	acquired, err := e.leases.Acquire(context.TODO(), e.name, e.id, e.duration)
+	if err != nil {
+		// keep leading until the lease expires; the next attempt may well succeed
+		e.logger.Error(err, "acquire lease")
+		return
+	}
+	e.lock.Lock()
+	if acquired {
+		e.validUntil = start.Add(e.duration)
+	} else {
+		e.validUntil = time.Time{}
+	}
+	e.lock.Unlock()
+	switch {
+	case acquired && !wasLeader:
+		e.logger.Info("elected as the leader")
+		if e.onElected != nil {
+			go e.onElected()
+		}
+	case !acquired && wasLeader:
+		e.logger.Info("lost the leadership")
+	}
+}
+
+func (e *Elector) resign() {
+	if !e.IsLeader() {
+		return
+	}
+	e.lock.Lock()
+	e.validUntil = time.Time{}
+	e.lock.Unlock()
+	if err := e.leases.Release(context.TODO(), e.name, e.id); err != nil {
+		e.logger.Error(err, "release lease")
+		return
+	}
+	e.logger.Info("resigned from the leadership")
+}
@@ -0,0 +1,54 @@
+package leader
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lichuan0620/secret-keeper-backend/internal/store"
+)
+
+func TestElector(t *testing.T) {
+	leases := store.NewMemoryLeaseStore()
+	elected := make(chan string, 2)
+	newElector := func(id string) *Elector {
+		return New(leases, "test", id, &Options{
+			LeaseDuration: 300 * time.Millisecond,
+			OnElected: func() {
+				elected <- id
+			},
+		})
+	}
+	a, b := newElector("a"), newElector("b")
+	stopA, stopB := make(chan struct{}), make(chan struct{})
+	doneA := make(chan struct{})
+	go func() {
+		defer close(doneA)
+		a.Run(stopA)
+	}()
+	if id := <-elected; id != "a" {
+		t.Fatalf("expecting a to be elected; got %s", id)
+	}
+	go b.Run(stopB)
+	defer close(stopB)
+	// b keeps failing while a renews the lease
+	time.Sleep(time.Second)
+	if !a.IsLeader() || b.IsLeader() {
+		t.Fatalf("expecting a to keep leading; a: %t, b: %t", a.IsLeader(), b.IsLeader())
+	}
+	close(stopA)
+	<-doneA
+	if a.IsLeader() {
+		t.Fatal("expecting a to resign")
+	}
+	select {
+	case id := <-elected:
+		if id != "b" {
+			t.Fatalf("expecting b to be elected; got %s", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting b to take over")
+	}
+	if !b.IsLeader() {
+		t.Fatal("expecting b to be the leader")
+	}
+}
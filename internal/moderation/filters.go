@@ -0,0 +1,154 @@
+package moderation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+type keywordFilter struct {
+	keywords []string
+	patterns []*regexp.Regexp
+}
+
+// NewKeywordFilter returns a Filter that is violated by text containing any of the keywords
+// (case-insensitive) or matching any of the regular expressions.
+func NewKeywordFilter(keywords, patterns []string) (Filter, error) {
+	ret := keywordFilter{
+		keywords: make([]string, 0, len(keywords)),
+		patterns: make([]*regexp.Regexp, 0, len(patterns)),
+	}
+	for _, keyword := range keywords {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			ret.keywords = append(ret.keywords, strings.ToLower(keyword))
+		}
+	}
+	for _, pattern := range patterns {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid pattern %q", pattern)
+		}
+		ret.patterns = append(ret.patterns, compiled)
+	}
+	return &ret, nil
+}
+
+func (f *keywordFilter) Name() string {
+	return "Keyword"
+}
+
+func (f *keywordFilter) Check(text string) string {
+	// the matched keyword is not revealed so the list cannot be probed
+	lower := strings.ToLower(text)
+	for _, keyword := range f.keywords {
+		if strings.Contains(lower, keyword) {
+			return "content contains a blocked keyword"
+		}
+	}
+	for _, pattern := range f.patterns {
+		if pattern.MatchString(text) {
+			return "content matches a blocked pattern"
+		}
+	}
+	return ""
+}
+
+type lengthFilter struct {
+	min, max int
+}
+
+// NewLengthFilter returns a Filter that is violated by text shorter than min or longer than
+// max characters. Zero means no limit.
+func NewLengthFilter(min, max int) (Filter, error) {
+	if min < 0 || max < 0 || (max > 0 && min > max) {
+		return nil, errors.Errorf("invalid length range [%d, %d]", min, max)
+	}
+	return &lengthFilter{min: min, max: max}, nil
+}
+
+func (f *lengthFilter) Name() string {
+	return "Length"
+}
+
+func (f *lengthFilter) Check(text string) string {
+	length := utf8.RuneCountInString(text)
+	if length < f.min {
+		return fmt.Sprintf("content is shorter than %d characters", f.min)
+	}
+	if f.max > 0 && length > f.max {
+		return fmt.Sprintf("content is longer than %d characters", f.max)
+	}
+	return ""
+}
+
+var linkPattern = regexp.MustCompile(
+	`(?i)(?:https?://|www\.)\S+|\b[a-z0-9][a-z0-9-]*(?:\.[a-z0-9-]+)*\.(?:com|net|org|io|cn|me|co|xyz|top|info|cc|ly|gl)\b`,
+)
+
+type linkFilter struct {
+	maxLinks int
+}
+
+// NewLinkFilter returns a Filter that is violated by text containing more than maxLinks links.
+func NewLinkFilter(maxLinks int) (Filter, error) {
+	if maxLinks < 0 {
+		return nil, errors.Errorf("invalid max links %d", maxLinks)
+	}
+	return &linkFilter{maxLinks: maxLinks}, nil
+}
+
+func (f *linkFilter) Name() string {
+	return "Link"
+}
+
+func (f *linkFilter) Check(text string) string {
+	if len(linkPattern.FindAllStringIndex(text, f.maxLinks+1)) > f.maxLinks {
+		if f.maxLinks == 0 {
+			return "content contains links"
+		}
+		return fmt.Sprintf("content contains more than %d links", f.maxLinks)
+	}
+	return ""
+}
+
+type repetitionFilter struct {
+	maxRepeat int
+}
+
+// NewRepetitionFilter returns a Filter that is violated by text repeating the same character
+// more than maxRepeat times in a row, a common trait of spam. Whitespace is ignored.
+func NewRepetitionFilter(maxRepeat int) (Filter, error) {
+	if maxRepeat < 1 {
+		return nil, errors.Errorf("invalid max repeat %d", maxRepeat)
+	}
+	return &repetitionFilter{maxRepeat: maxRepeat}, nil
+}
+
+func (f *repetitionFilter) Name() string {
+	return "Repetition"
+}
+
+func (f *repetitionFilter) Check(text string) string {
+	var (
+		last  rune
+		count int
+	)
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		if r == last {
+			count++
+		} else {
+			last, count = r, 1
+		}
+		if count > f.maxRepeat {
+			return fmt.Sprintf("content repeats a character more than %d times", f.maxRepeat)
+		}
+	}
+	return ""
+}
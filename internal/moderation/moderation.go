@@ -0,0 +1,161 @@
+package moderation
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+// Action is what happens to content that fails a Filter.
+type Action string
+
+const (
+	// ActionAllow lets the content through. It is only used in Results.
+	ActionAllow Action = "Allow"
+	// ActionReview holds the content back until an operator has reviewed it.
+	ActionReview Action = "Review"
+	// ActionReject refuses the content.
+	ActionReject Action = "Reject"
+)
+
+// severity orders Actions so the strictest verdict wins.
+func (a Action) severity() int {
+	switch a {
+	case ActionReject:
+		return 2
+	case ActionReview:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Filter inspects a piece of text.
+type Filter interface {
+	// Name identifies the Filter in Results.
+	Name() string
+	// Check returns a human-readable reason if the text violates the Filter, or an empty string
+	// otherwise.
+	Check(text string) string
+}
+
+// Result is the outcome of moderating a piece of text.
+type Result struct {
+	Action Action
+	// Filter and Reason describe the violation that determined the Action; they are empty when
+	// the Action is ActionAllow.
+	Filter string
+	Reason string
+}
+
+// Moderator runs text through a list of Filters.
+type Moderator struct {
+	rules []rule
+}
+
+type rule struct {
+	filter Filter
+	action Action
+}
+
+// New returns a Moderator without any Filter; it allows everything until Filters are added.
+func New() *Moderator {
+	return &Moderator{}
+}
+
+// Add registers a Filter with the Action to take when it is violated.
+func (m *Moderator) Add(filter Filter, action Action) *Moderator {
+	m.rules = append(m.rules, rule{filter: filter, action: action})
+	return m
+}
+
+// Moderate checks the text against all Filters and returns the strictest Result. A nil
+// Moderator allows everything.
+func (m *Moderator) Moderate(text string) Result {
+	ret := Result{Action: ActionAllow}
+	if m == nil {
+		return ret
+	}
+	for _, r := range m.rules {
+		if r.action.severity() <= ret.Action.severity() {
+			continue
+		}
+		if reason := r.filter.Check(text); reason != "" {
+			ret = Result{Action: r.action, Filter: r.filter.Name(), Reason: reason}
+			if r.action == ActionReject {
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// Config describes a Moderator, usually loaded from a JSON file.
+type Config struct {
+	Filters []FilterConfig `json:"Filters"`
+}
+
+// FilterConfig describes one Filter and the Action to take on violation. Which of the other
+// fields are used depends on the Type.
+type FilterConfig struct {
+	// Type is one of Keyword, Length, Link and Repetition.
+	Type   string `json:"Type"`
+	Action Action `json:"Action"`
+	// Keywords and Patterns are used by Keyword filters.
+	Keywords []string `json:"Keywords,omitempty"`
+	Patterns []string `json:"Patterns,omitempty"`
+	// MinLength and MaxLength are used by Length filters, counted in characters; zero means no
+	// limit.
+	MinLength int `json:"MinLength,omitempty"`
+	MaxLength int `json:"MaxLength,omitempty"`
+	// MaxLinks is used by Link filters.
+	MaxLinks int `json:"MaxLinks,omitempty"`
+	// MaxRepeat is used by Repetition filters.
+	MaxRepeat int `json:"MaxRepeat,omitempty"`
+}
+
+// LoadConfig reads a JSON Config from the given file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read moderation config")
+	}
+	var config Config
+	if err = json.Unmarshal(data, &config); err != nil {
+		return nil, errors.Wrap(err, "decode moderation config")
+	}
+	return &config, nil
+}
+
+// Build constructs the Moderator described by the Config.
+func (c *Config) Build() (*Moderator, error) {
+	m := New()
+	for i := range c.Filters {
+		fc := &c.Filters[i]
+		if fc.Action != ActionReview && fc.Action != ActionReject {
+			return nil, errors.Errorf("filter %d: invalid action %q", i, fc.Action)
+		}
+		var (
+			filter Filter
+			err    error
+		)
+		switch fc.Type {
+		case "Keyword":
+			filter, err = NewKeywordFilter(fc.Keywords, fc.Patterns)
+		case "Length":
+			filter, err = NewLengthFilter(fc.MinLength, fc.MaxLength)
+		case "Link":
+			filter, err = NewLinkFilter(fc.MaxLinks)
+		case "Repetition":
+			filter, err = NewRepetitionFilter(fc.MaxRepeat)
+		default:
+			err = errors.Errorf("unknown type %q", fc.Type)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "filter %d", i)
+		}
+		m.Add(filter, fc.Action)
+	}
+	return m, nil
+}
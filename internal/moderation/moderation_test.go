@@ -0,0 +1,77 @@
+package moderation
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestModerate(t *testing.T) {
+	config := Config{Filters: []FilterConfig{
+		{Type: "Length", Action: ActionReject, MinLength: 2, MaxLength: 20},
+		{Type: "Keyword", Action: ActionReject, Keywords: []string{"Forbidden"}, Patterns: []string{`\d{11}`}},
+		{Type: "Link", Action: ActionReview},
+		{Type: "Repetition", Action: ActionReview, MaxRepeat: 3},
+	}}
+	m, err := config.Build()
+	if err != nil {
+		t.Fatalf("build Moderator: %v", err)
+	}
+	for _, tc := range []struct {
+		Text         string
+		ExpectAction Action
+		ExpectFilter string
+	}{
+		{Text: "a secret", ExpectAction: ActionAllow},
+		{Text: "秘密", ExpectAction: ActionAllow},
+		{Text: "a", ExpectAction: ActionReject, ExpectFilter: "Length"},
+		{Text: strings.Repeat("ab", 11), ExpectAction: ActionReject, ExpectFilter: "Length"},
+		{Text: "so FORBIDDEN", ExpectAction: ActionReject, ExpectFilter: "Keyword"},
+		{Text: "call 13800138000", ExpectAction: ActionReject, ExpectFilter: "Keyword"},
+		{Text: "see example.com", ExpectAction: ActionReview, ExpectFilter: "Link"},
+		{Text: "see https://x.y/z", ExpectAction: ActionReview, ExpectFilter: "Link"},
+		{Text: "noooo way", ExpectAction: ActionReview, ExpectFilter: "Repetition"},
+		{Text: "nooo way", ExpectAction: ActionAllow},
+		{Text: "forbidden.com", ExpectAction: ActionReject, ExpectFilter: "Keyword"},
+	} {
+		result := m.Moderate(tc.Text)
+		if result.Action != tc.ExpectAction || result.Filter != tc.ExpectFilter {
+			t.Errorf("%q: expecting %s by %q; got %+v", tc.Text, tc.ExpectAction, tc.ExpectFilter, result)
+		}
+		if result.Action != ActionAllow && result.Reason == "" {
+			t.Errorf("%q: expecting a reason", tc.Text)
+		}
+	}
+	var nilModerator *Moderator
+	if result := nilModerator.Moderate("anything"); result.Action != ActionAllow {
+		t.Errorf("expecting nil Moderator to allow everything; got %+v", result)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		Content     string
+		ExpectError bool
+	}{
+		{Content: `{"Filters":[{"Type":"Link","Action":"Review","MaxLinks":1}]}`},
+		{Content: `{"Filters":[{"Type":"Link","Action":"Allow"}]}`, ExpectError: true},
+		{Content: `{"Filters":[{"Type":"Unknown","Action":"Reject"}]}`, ExpectError: true},
+		{Content: `{"Filters":[{"Type":"Keyword","Action":"Reject","Patterns":["("]}]}`, ExpectError: true},
+		{Content: `{"Filters":[{"Type":"Repetition","Action":"Reject"}]}`, ExpectError: true},
+		{Content: `not json`, ExpectError: true},
+	} {
+		path := filepath.Join(dir, "config.json")
+		if err := ioutil.WriteFile(path, []byte(tc.Content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		config, err := LoadConfig(path)
+		if err == nil {
+			_, err = config.Build()
+		}
+		if tc.ExpectError == (err == nil) {
+			t.Errorf("%s: expecting error: %v; got %v", tc.Content, tc.ExpectError, err)
+		}
+	}
+}
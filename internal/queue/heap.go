@@ -0,0 +1,129 @@
+package queue
+
+import (
+	"container/heap"
+
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+)
+
+// entry is an item in the heap along with its position, so that it can be updated or removed
+// in O(log n).
+type entry struct {
+	*models.QueueItem
+	index int
+	// reservations are the expiry times (in Unix nanoseconds) of the views reserved by
+	// DequeueBatch and not reported yet, oldest first; they are only kept for items with MaxViews.
+	reservations []int64
+}
+
+// reservable tells if the entry can be handed out at the given time (in Unix nanoseconds)
+// counting the reserved views as made. Expired reservations are dropped on the way.
+func (e *entry) reservable(now int64) bool {
+	for len(e.reservations) > 0 && e.reservations[0] <= now {
+		e.reservations = e.reservations[1:]
+	}
+	return e.MaxViews == 0 || e.Views+uint(len(e.reservations)) < e.MaxViews
+}
+
+// items is a min-heap of entries ordered by Score, i.e. the least recently viewed item first.
+// Use it through container/heap.
+type items []*entry
+
+func (it items) Len() int {
+	return len(it)
+}
+
+func (it items) Less(i, j int) bool {
+	return it[i].Score < it[j].Score
+}
+
+func (it items) Swap(i, j int) {
+	it[i], it[j] = it[j], it[i]
+	it[i].index = i
+	it[j].index = j
+}
+
+func (it *items) Push(x interface{}) {
+	e := x.(*entry)
+	e.index = len(*it)
+	*it = append(*it, e)
+}
+
+func (it *items) Pop() interface{} {
+	old := *it
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	e.index = -1
+	*it = old[:n-1]
+	return e
+}
+
+// At implements Items.
+func (it items) At(i int) *models.QueueItem {
+	return it[i].QueueItem
+}
+
+// Ascend implements Items.
+func (it items) Ascend(fn func(*models.QueueItem) bool) {
+	it.ascend(func(e *entry) bool {
+		return fn(e.QueueItem)
+	})
+}
+
+// init rebuilds the heap after the entries have been replaced in bulk.
+func (it *items) init() {
+	for i, e := range *it {
+		e.index = i
+	}
+	heap.Init(it)
+}
+
+// ascend calls fn with the entries in ascending order of Score until fn returns false. It visits
+// k entries in O(k log k) without modifying the heap, which must not be changed by fn either.
+func (it items) ascend(fn func(*entry) bool) {
+	if len(it) == 0 {
+		return
+	}
+	// frontier is a min-heap of positions in it whose parents have all been visited
+	frontier := &positions{items: it, positions: []int{0}}
+	for frontier.Len() > 0 {
+		i := heap.Pop(frontier).(int)
+		if !fn(it[i]) {
+			return
+		}
+		for _, child := range []int{2*i + 1, 2*i + 2} {
+			if child < len(it) {
+				heap.Push(frontier, child)
+			}
+		}
+	}
+}
+
+type positions struct {
+	items     items
+	positions []int
+}
+
+func (p *positions) Len() int {
+	return len(p.positions)
+}
+
+func (p *positions) Less(i, j int) bool {
+	return p.items.Less(p.positions[i], p.positions[j])
+}
+
+func (p *positions) Swap(i, j int) {
+	p.positions[i], p.positions[j] = p.positions[j], p.positions[i]
+}
+
+func (p *positions) Push(x interface{}) {
+	p.positions = append(p.positions, x.(int))
+}
+
+func (p *positions) Pop() interface{} {
+	n := len(p.positions)
+	ret := p.positions[n-1]
+	p.positions = p.positions[:n-1]
+	return ret
+}
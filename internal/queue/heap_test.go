@@ -0,0 +1,132 @@
+package queue
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/lichuan0620/secret-keeper-backend/internal/store"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+)
+
+func TestHeap(t *testing.T) {
+	var h items
+	for i := 0; i < 1000; i++ {
+		heap.Push(&h, &entry{QueueItem: &models.QueueItem{Id: fmt.Sprint(i), Score: rand.Int63n(100)}})
+	}
+	for i := 0; i < 1000; i++ {
+		e := h[rand.Intn(len(h))]
+		if i%10 == 0 {
+			heap.Remove(&h, e.index)
+			continue
+		}
+		e.Score = rand.Int63n(100)
+		heap.Fix(&h, e.index)
+	}
+	for i, e := range h {
+		if e.index != i {
+			t.Fatalf("entry %s at position %d has index %d", e.Id, i, e.index)
+		}
+	}
+	var ascended []int64
+	h.ascend(func(e *entry) bool {
+		ascended = append(ascended, e.Score)
+		return true
+	})
+	if len(ascended) != len(h) {
+		t.Fatalf("expecting %d entries; got %d", len(h), len(ascended))
+	}
+	if !sort.SliceIsSorted(ascended, func(i, j int) bool { return ascended[i] < ascended[j] }) {
+		t.Fatalf("entries are not visited in order: %v", ascended)
+	}
+	var visited int
+	h.ascend(func(*entry) bool {
+		visited++
+		return visited < randomFactor
+	})
+	if visited != randomFactor {
+		t.Fatalf("expecting ascend to stop after %d entries; got %d", randomFactor, visited)
+	}
+}
+
+// nopBoxStore discards view records so that benchmarks only measure the queue itself.
+type nopBoxStore struct {
+	store.BoxStore
+}
+
+func (nopBoxStore) MarkViewed(context.Context, []store.BoxViews) error {
+	return nil
+}
+
+// sortedQueue is the former implementation of the queue, which keeps the items sorted in a slice
+// and sorts it again on every change. It is kept for comparison.
+type sortedQueue struct {
+	items sortedItems
+	index map[string]*models.QueueItem
+}
+
+type sortedItems []*models.QueueItem
+
+func (it sortedItems) Len() int           { return len(it) }
+func (it sortedItems) Less(i, j int) bool { return it[i].Score < it[j].Score }
+func (it sortedItems) Swap(i, j int)      { it[i], it[j] = it[j], it[i] }
+
+func (q *sortedQueue) dequeue(now int64) string {
+	item := q.items[rand.Intn(randomFactor)]
+	item.Score = now
+	item.Views++
+	sort.Sort(q.items)
+	return item.Id
+}
+
+func (q *sortedQueue) sync(item *models.QueueItem) {
+	q.index[item.Id].Score = item.Score
+	sort.Sort(q.items)
+}
+
+func benchmarkItems(n int) []*models.QueueItem {
+	ret := make([]*models.QueueItem, n)
+	for i := range ret {
+		ret[i] = &models.QueueItem{Id: fmt.Sprint(i), Score: rand.Int63()}
+	}
+	return ret
+}
+
+func BenchmarkQueue(b *testing.B) {
+	for _, n := range []int{10000, 100000, 1000000} {
+		b.Run(fmt.Sprintf("heap/%d", n), func(b *testing.B) {
+			q := New(nopBoxStore{}, nil).(*Type)
+			q.index = make(map[string]*entry, n)
+			for _, item := range benchmarkItems(n) {
+				e := &entry{QueueItem: item}
+				q.items = append(q.items, e)
+				q.index[item.Id] = e
+			}
+			q.items.init()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := q.Dequeue(DequeueOptions{}); err != nil {
+					b.Fatal(err)
+				}
+				q.sync(&models.QueueItem{Id: fmt.Sprint(rand.Intn(n)), Score: rand.Int63()})
+			}
+		})
+		b.Run(fmt.Sprintf("sorted/%d", n), func(b *testing.B) {
+			q := &sortedQueue{index: make(map[string]*models.QueueItem, n)}
+			for _, item := range benchmarkItems(n) {
+				q.items = append(q.items, item)
+				q.index[item.Id] = item
+			}
+			sort.Sort(q.items)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				q.dequeue(time.Now().UnixNano())
+				q.sync(&models.QueueItem{Id: fmt.Sprint(rand.Intn(n)), Score: rand.Int63()})
+			}
+		})
+	}
+}
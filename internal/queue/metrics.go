@@ -0,0 +1,72 @@
+package queue
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	resyncModeFull        = "full"
+	resyncModeIncremental = "incremental"
+
+	resyncChangeUpdated = "updated"
+	resyncChangeRemoved = "removed"
+)
+
+var (
+	resyncDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "secret_keeper",
+		Subsystem: "queue",
+		Name:      "resync_duration_seconds",
+		Help:      "Time taken to resync the queue with the Box store.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 4, 8),
+	}, []string{"mode", "result"})
+	resyncItems = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "secret_keeper",
+		Subsystem: "queue",
+		Name:      "resync_items_total",
+		Help:      "Number of queue items changed by resyncs.",
+	}, []string{"mode", "change"})
+	watchedChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "secret_keeper",
+		Subsystem: "queue",
+		Name:      "watched_changes_total",
+		Help:      "Number of queue items changed by the Box change stream.",
+	}, []string{"change"})
+	viewWrites = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "secret_keeper",
+		Subsystem: "queue",
+		Name:      "view_writes_total",
+		Help:      "Number of writes of the views handed out by the queue to the Box store.",
+	}, []string{"result"})
+	queueItems = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "secret_keeper",
+		Subsystem: "queue",
+		Name:      "items",
+		Help:      "Number of items in the queue after the last resync.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(resyncDuration, resyncItems, watchedChanges, viewWrites, queueItems)
+}
+
+// resyncStats counts the changes made by a resync.
+type resyncStats struct {
+	updated int
+	removed int
+}
+
+func observeResync(mode string, duration time.Duration, stats *resyncStats, err error) {
+	resyncDuration.WithLabelValues(mode, resultOf(err)).Observe(duration.Seconds())
+	resyncItems.WithLabelValues(mode, resyncChangeUpdated).Add(float64(stats.updated))
+	resyncItems.WithLabelValues(mode, resyncChangeRemoved).Add(float64(stats.removed))
+}
+
+func resultOf(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
@@ -1,13 +1,15 @@
 package queue
 
 import (
-	"math/rand"
-	"sort"
+	"container/heap"
+	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/globalsign/mgo/bson"
 	"github.com/go-logr/logr"
+	"github.com/lichuan0620/secret-keeper-backend/internal/shard"
+	"github.com/lichuan0620/secret-keeper-backend/internal/store"
 	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
 	"github.com/lichuan0620/secret-keeper-backend/pkg/mongo"
 	"github.com/lichuan0620/secret-keeper-backend/pkg/telemetry/log"
@@ -16,153 +18,759 @@ import (
 
 const randomFactor = 5
 
+const (
+	// resyncOverlap is subtracted from the high-water mark when looking for changed Boxes, to
+	// cover the clock difference between the queue and the database, and the writes that were in
+	// flight during the previous resync.
+	resyncOverlap = time.Minute
+	// resyncBatchSize is the number of changes applied at a time during an incremental resync,
+	// so that Dequeue is not blocked for long.
+	resyncBatchSize = 100
+	// MaxDequeueBatch is the largest number of items DequeueBatch hands out at a time.
+	MaxDequeueBatch = 100
+	// ReservationTTL is how long a view reserved by DequeueBatch counts against the MaxViews of
+	// the item; the reservation is given up if the view is not reported by then.
+	ReservationTTL = time.Minute
+)
+
 var ErrNoData = errors.New("no data")
 
+// ErrNotLeader is returned by Dequeue, DequeueBatch and RecordViews on a replica that is not the
+// leader.
+var ErrNotLeader = errors.New("not the leader")
+
 var location *time.Location
 
 func init() {
 	location, _ = time.LoadLocation("Asia/Shanghai")
 }
 
+// DequeueOptions tune which item Dequeue hands out.
+type DequeueOptions struct {
+	// ViewerId identifies an anonymous viewer; items recently handed out to the same viewer are
+	// skipped if possible. An empty ViewerId disables the tracking.
+	ViewerId string
+	// Strategy is the name of the Strategy to use instead of the configured one.
+	Strategy string
+}
+
+// Options configure a queue; the zero value is valid.
+type Options struct {
+	// Strategy is the default Strategy; the lru Strategy is used if it is nil.
+	Strategy Strategy
+	// SnapshotDir is where the state of the queue is persisted so that it can be restored right
+	// away after a restart; nothing is persisted if it is empty.
+	SnapshotDir string
+	// SnapshotInterval is how often a snapshot is taken; it defaults to 5 minutes.
+	SnapshotInterval time.Duration
+	// Watcher streams the changes made to the Boxes. If it is set, the queue applies them as they
+	// come instead of relying on Sync; Sync still works but is no longer needed.
+	Watcher store.BoxWatcher
+	// Checkpoints saves the position in the Watcher stream so that the queue continues where it
+	// left off after a restart; the stream starts from the present if it is nil.
+	Checkpoints store.CheckpointStore
+	// Partition is the part of the Boxes the queue is responsible for when the queue is sharded;
+	// the queue takes every Box if it is nil.
+	Partition *shard.Partition
+	// Leader tells if this replica is the leader among the replicas of the queue, which is the
+	// only one handing out items; the others are kept up to date as hot standbys. The replica
+	// always hands out items if it is nil.
+	Leader Leader
+	// Replica identifies this replica among the replicas of the queue, each of which keeps its
+	// own Watcher checkpoint since their progress differs; it may be empty with a single replica.
+	Replica string
+}
+
+// Leader tells if a replica is the leader, see internal/leader.
+type Leader interface {
+	IsLeader() bool
+}
+
 type Interface interface {
 	Sync(item models.QueueItem)
-	Dequeue() (string, error)
+	Dequeue(opts DequeueOptions) (string, error)
+	// DequeueBatch reserves up to n items for a caller that hands them out later, and reports
+	// the views with RecordViews.
+	DequeueBatch(opts DequeueOptions, n int) ([]string, error)
+	RecordViews(views []models.View) error
+	Remove(id string)
+	// Resync brings the queue up to date with the Box store. Only the Boxes changed since the
+	// last resync are read unless full is true, in which case the queue is rebuilt.
+	Resync(full bool) error
 	Ready() bool
+	// Serving tells if the queue hands out items: it is ready and, if the replicas elect a
+	// leader, it is the leader.
+	Serving() bool
 	Run(stopCh <-chan struct{})
 }
 
-func New() Interface {
-	return &Type{
-		buf:    make(chan *models.QueueItem, 1000),
-		logger: log.New().WithName("queue"),
+func New(boxes store.BoxStore, opts *Options) Interface {
+	if opts == nil {
+		opts = &Options{}
+	}
+	strategy := opts.Strategy
+	if strategy == nil {
+		strategy = Strategies[DefaultStrategy]
+	}
+	ret := &Type{
+		boxes:            boxes,
+		strategy:         strategy,
+		snapshotInterval: opts.SnapshotInterval,
+		watcher:          opts.Watcher,
+		checkpoints:      opts.Checkpoints,
+		partition:        opts.Partition,
+		leader:           opts.Leader,
+		replica:          opts.Replica,
+		slots:            opts.Partition.Slots(),
+		buf:              make(chan *models.QueueItem, 1000),
+		seen:             newSeenTracker(maxViewers, seenPerViewer),
+		logger:           log.New().WithName("queue"),
 	}
+	ret.views = newViewWriter(boxes, ret.logger)
+	if ret.snapshotInterval <= 0 {
+		ret.snapshotInterval = 5 * time.Minute
+	}
+	if opts.SnapshotDir != "" {
+		ret.persister = newPersister(opts.SnapshotDir)
+	}
+	return ret
 }
 
 type Type struct {
-	items  items
-	index  map[string]*models.QueueItem
-	buf    chan *models.QueueItem
-	ready  bool
-	once   sync.Once
-	lock   sync.Mutex
-	logger logr.Logger
+	boxes     store.BoxStore
+	partition *shard.Partition
+	// slots are the shard slots of the partition, or nil for every slot
+	slots    []int
+	leader   Leader
+	replica  string
+	strategy Strategy
+	items    items
+	index    map[string]*entry
+	buf      chan *models.QueueItem
+	// pending holds the changes made before the queue is ready
+	pending []*journalRecord
+	seen    *SeenTracker
+	views   *viewWriter
+	ready   int32
+	lock    sync.Mutex
+	logger  logr.Logger
+
+	// highWater is the time of the last successful resync; the Boxes modified before it are
+	// already reflected in the queue. It is guarded by lock.
+	highWater  time.Time
+	resyncLock sync.Mutex
+
+	watcher     store.BoxWatcher
+	checkpoints store.CheckpointStore
+
+	persister        *persister
+	snapshotInterval time.Duration
+	snapshotting     int32
 }
 
+// Sync adds an item to the queue or updates the existing one; items outside the partition of the
+// queue are ignored.
 func (t *Type) Sync(item models.QueueItem) {
-	if t.ready {
-		t.buf <- &item
+	if !t.partition.Owns(item.Id) {
+		t.logger.V(log.LevelExtended).Info("ignoring item of another shard", "id", item.Id)
+		return
 	}
+	t.buf <- &item
 }
 
-func (t *Type) Dequeue() (string, error) {
+// Dequeue hands out an item chosen by the Strategy, skipping the ones the viewer has recently
+// seen unless there is nothing else left.
+func (t *Type) Dequeue(opts DequeueOptions) (string, error) {
+	if t.leader != nil && !t.leader.IsLeader() {
+		return "", ErrNotLeader
+	}
+	strategy := t.strategy
+	if opts.Strategy != "" {
+		var err error
+		if strategy, err = StrategyByName(opts.Strategy); err != nil {
+			return "", err
+		}
+	}
 	t.lock.Lock()
 	defer t.lock.Unlock()
-	count := len(t.items)
-	var i int
-	if count <= randomFactor {
-		if count == 0 {
-			return "", ErrNoData
+	now := time.Now().In(location)
+	e := t.pick(strategy, now.UnixNano(), opts.ViewerId, nil)
+	if e == nil {
+		return "", ErrNoData
+	}
+	t.view(e, opts.ViewerId, now)
+	return e.Id, nil
+}
+
+// DequeueBatch reserves up to n distinct items chosen by the Strategy. A reserved item goes to the
+// back of the queue as if it were viewed, but the view is only counted once it is reported with
+// RecordViews; an item that is never viewed is simply handed out again later. Meanwhile, the
+// reserved view counts against the MaxViews of the item for ReservationTTL, so that an item is
+// never reserved more times than it may be viewed.
+func (t *Type) DequeueBatch(opts DequeueOptions, n int) ([]string, error) {
+	if t.leader != nil && !t.leader.IsLeader() {
+		return nil, ErrNotLeader
+	}
+	strategy := t.strategy
+	if opts.Strategy != "" {
+		var err error
+		if strategy, err = StrategyByName(opts.Strategy); err != nil {
+			return nil, err
+		}
+	}
+	if n > MaxDequeueBatch {
+		n = MaxDequeueBatch
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	now := time.Now().UnixNano()
+	picked := make(map[string]struct{}, n)
+	ids := make([]string, 0, n)
+	for len(ids) < n {
+		e := t.pick(strategy, now, opts.ViewerId, picked)
+		if e == nil {
+			break
+		}
+		picked[e.Id] = struct{}{}
+		ids = append(ids, e.Id)
+		if e.MaxViews > 0 {
+			e.reservations = append(e.reservations, now+int64(ReservationTTL))
+		}
+		e.Score = now
+		t.record(&journalRecord{Op: journalOpView, Id: e.Id, Score: e.Score, Views: e.Views})
+		heap.Fix(&t.items, e.index)
+	}
+	if len(ids) == 0 {
+		return nil, ErrNoData
+	}
+	return ids, nil
+}
+
+// RecordViews counts the views of items handed out through DequeueBatch, like Dequeue does for
+// the item it hands out, releasing their reservations. Views of unknown items are still written
+// to the Box store.
+func (t *Type) RecordViews(views []models.View) error {
+	if t.leader != nil && !t.leader.IsLeader() {
+		return ErrNotLeader
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for _, v := range views {
+		if e, ok := t.index[v.Id]; ok {
+			if len(e.reservations) > 0 {
+				e.reservations = e.reservations[1:]
+			}
+			t.view(e, v.ViewerId, v.ViewedAt)
+		} else {
+			t.views.add(v.Id, v.ViewedAt)
 		}
-		i = rand.Intn(count)
+	}
+	return nil
+}
+
+// view counts a view of the entry by the viewer at the given time, which is written to the Box
+// store in the background; the lock must be held by the caller.
+func (t *Type) view(e *entry, viewer string, viewed time.Time) {
+	t.views.add(e.Id, viewed)
+	if viewer != "" {
+		t.seen.Add(viewer, e.Id)
+	}
+	now := viewed.UnixNano()
+	if now > e.Score {
+		e.Score = now
+	}
+	e.Views++
+	t.record(&journalRecord{Op: journalOpView, Id: e.Id, Score: e.Score, Views: e.Views})
+	if !e.Available(now) {
+		t.remove(e)
 	} else {
-		i = count - 1 - rand.Intn(randomFactor)
+		heap.Fix(&t.items, e.index)
 	}
-	id := t.items[i].Id
-	now := time.Now().In(location)
-	if err := mongo.DB().C(mongo.CollectionBox).UpdateId(
-		id,
-		bson.M{"$set": bson.M{"LastViewed": now}},
-	); err != nil {
-		return "", errors.Wrap(err, "update view record")
+}
+
+// pick returns the entry to hand out other than the excluded ones, or nil if there is none; the
+// lock must be held by the caller. Entries found unavailable on the way are removed, and those
+// whose remaining views are all reserved are skipped.
+func (t *Type) pick(strategy Strategy, now int64, viewer string, exclude map[string]struct{}) *entry {
+	unavailable := make(map[string]struct{})
+	available := func(item *models.QueueItem) bool {
+		if _, excluded := exclude[item.Id]; excluded {
+			return false
+		}
+		if !item.Available(now) {
+			unavailable[item.Id] = struct{}{}
+			return false
+		}
+		return t.index[item.Id].reservable(now)
+	}
+	item := strategy.Pick(t.items, func(item *models.QueueItem) bool {
+		return available(item) && (viewer == "" || !t.seen.Seen(viewer, item.Id))
+	})
+	if item == nil && viewer != "" {
+		// the viewer has seen everything; repeating is better than showing nothing
+		item = strategy.Pick(t.items, available)
+	}
+	for id := range unavailable {
+		t.remove(t.index[id])
+	}
+	if item == nil {
+		return nil
+	}
+	return t.index[item.Id]
+}
+
+// Remove takes an item out of the queue right away. Removing an unknown item is a no-op.
+func (t *Type) Remove(id string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if !t.Ready() {
+		t.pending = append(t.pending, &journalRecord{Op: journalOpRemove, Id: id})
+		return
+	}
+	if e, ok := t.index[id]; ok {
+		t.remove(e)
+		t.record(&journalRecord{Op: journalOpRemove, Id: id})
 	}
-	t.items[i].Score = now.UnixNano()
-	sort.Sort(t.items)
-	return id, nil
 }
 
 func (t *Type) Ready() bool {
-	return t.ready
+	return atomic.LoadInt32(&t.ready) == 1
+}
+
+func (t *Type) Serving() bool {
+	return t.Ready() && (t.leader == nil || t.leader.IsLeader())
 }
 
 func (t *Type) Run(stopCh <-chan struct{}) {
 	const (
 		resync = 15 * time.Minute
 		retry  = 10 * time.Second
+		purge  = 10 * time.Second
+		flush  = time.Second
 	)
+	// a restored queue is caught up by an incremental resync, which is cheap
+	t.restore()
+	stopWatch := func() {}
+	if t.watcher != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			t.watch(ctx)
+		}()
+		stopWatch = func() {
+			cancel()
+			<-done
+		}
+	}
+	viewWriterStopCh, viewWriterDone := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(viewWriterDone)
+		t.views.run(viewWriterStopCh)
+	}()
 	resyncTimer := time.NewTimer(0)
 	defer resyncTimer.Stop()
+	purgeTicker := time.NewTicker(purge)
+	defer purgeTicker.Stop()
+	snapshotTicker := time.NewTicker(t.snapshotInterval)
+	defer snapshotTicker.Stop()
+	flushTicker := time.NewTicker(flush)
+	defer flushTicker.Stop()
 	for {
 		select {
 		case <-stopCh:
+			stopWatch()
+			// the views handed out so far are written before the process exits
+			close(viewWriterStopCh)
+			<-viewWriterDone
+			t.shutdown()
 			return
 		case <-resyncTimer.C:
-			t.logger.Info("resync initialized")
 			go func() {
-				if err := t.resync(); err != nil {
+				if err := t.Resync(false); err != nil {
 					t.logger.Error(err, "resync")
 					resyncTimer.Reset(retry)
 				} else {
-					t.logger.Info("resync successful")
 					resyncTimer.Reset(resync)
 				}
 			}()
+		case <-purgeTicker.C:
+			if purged := t.purge(); purged > 0 {
+				t.logger.Info("unavailable items purged", "count", purged)
+			}
+		case <-snapshotTicker.C:
+			t.snapshotInBackground()
+		case <-flushTicker.C:
+			t.flush()
 		case item := <-t.buf:
 			t.logger.Info("sync item received", "id", item.Id, "score", item.Score)
-			func() {
-				if item != nil {
-					t.lock.Lock()
-					defer t.lock.Unlock()
-					if existing, ok := t.index[item.Id]; ok {
-						existing.Score = item.Score
-					} else {
-						t.items = append(t.items, item)
-						t.index[item.Id] = t.items[len(t.items)-1]
-					}
-					sort.Sort(t.items)
-				}
-			}()
+			if item != nil {
+				t.sync(item)
+			}
 		}
 	}
 }
 
-func (t *Type) resync() error {
-	var buf []models.Box
-	if err := mongo.DB().C(mongo.CollectionBox).Find(nil).All(&buf); err != nil {
-		return errors.Wrap(err, "list Box")
+// sync adds an item to the queue or updates the existing one. Items synced before the queue is
+// ready are applied once it is, like the removals.
+func (t *Type) sync(item *models.QueueItem) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if !t.Ready() {
+		t.pending = append(t.pending, &journalRecord{Op: journalOpSync, Item: item})
+		return
 	}
+	t.apply(item)
+	t.record(&journalRecord{Op: journalOpSync, Item: item})
+}
+
+// apply adds an item to the queue or updates the existing one; the lock must be held by the
+// caller. The Score and Views of an existing item never go back: the views are written to the
+// store in the background, so items built from a Box read from the store may lag behind.
+func (t *Type) apply(item *models.QueueItem) {
+	if existing, ok := t.index[item.Id]; ok {
+		if item.Score > existing.Score {
+			existing.Score = item.Score
+		}
+		existing.ExpiresAt = item.ExpiresAt
+		existing.MaxViews = item.MaxViews
+		existing.Engagement = item.Engagement
+		existing.CreatedAt = item.CreatedAt
+		if item.Views > existing.Views {
+			existing.Views = item.Views
+		}
+		heap.Fix(&t.items, existing.index)
+	} else if item.Available(time.Now().UnixNano()) {
+		e := &entry{QueueItem: item}
+		heap.Push(&t.items, e)
+		t.index[item.Id] = e
+	}
+}
+
+// purge removes all items that can no longer be handed out and returns how many were removed.
+func (t *Type) purge() int {
 	t.lock.Lock()
 	defer t.lock.Unlock()
-	t.items = t.items[:0]
-	t.index = make(map[string]*models.QueueItem)
-	for i := range buf {
-		if buf[i].LastViewed != nil {
-			item := models.QueueItem{
-				Id:    buf[i].Id,
-				Score: buf[i].LastViewed.UnixNano(),
-			}
-			t.items = append(t.items, &item)
-			t.index[item.Id] = &item
+	now := time.Now().UnixNano()
+	kept := t.items[:0]
+	for _, e := range t.items {
+		if e.Available(now) {
+			kept = append(kept, e)
+		} else {
+			delete(t.index, e.Id)
 		}
 	}
-	sort.Sort(t.items)
-	t.once.Do(func() {
-		t.ready = true
-	})
+	purged := len(t.items) - len(kept)
+	for i := len(kept); i < len(t.items); i++ {
+		t.items[i] = nil
+	}
+	t.items = kept
+	if purged > 0 {
+		t.items.init()
+	}
+	return purged
+}
+
+// remove deletes an entry; the lock must be held by the caller.
+func (t *Type) remove(e *entry) {
+	delete(t.index, e.Id)
+	heap.Remove(&t.items, e.index)
+}
+
+func (t *Type) Resync(full bool) error {
+	start := time.Now()
+	mode, stats, err := t.resync(full)
+	observeResync(mode, time.Since(start), stats, err)
+	if err != nil {
+		return err
+	}
+	t.lock.Lock()
+	count := len(t.items)
+	t.lock.Unlock()
+	queueItems.Set(float64(count))
+	t.logger.V(log.LevelExtended).Info("resync successful", "mode", mode,
+		"updated", stats.updated, "removed", stats.removed, "duration", time.Since(start))
+	if mode == resyncModeFull {
+		t.snapshotInBackground()
+	}
 	return nil
 }
 
-type items []*models.QueueItem
+// resync brings the queue up to date with the Box store and returns the mode it used. It falls
+// back to a full resync if the queue has never been synced, or if the last resync is so long ago
+// that the deletions since then may have been forgotten by the store.
+func (t *Type) resync(full bool) (string, *resyncStats, error) {
+	t.resyncLock.Lock()
+	defer t.resyncLock.Unlock()
+	t.lock.Lock()
+	highWater := t.highWater
+	t.lock.Unlock()
+	start := time.Now()
+	if full || highWater.IsZero() || start.Sub(highWater) > mongo.TombstoneRetention-resyncOverlap {
+		stats, err := t.fullResync(start)
+		return resyncModeFull, stats, err
+	}
+	stats, err := t.incrementalResync(highWater.Add(-resyncOverlap), start)
+	return resyncModeIncremental, stats, err
+}
+
+// fullResync rebuilds the queue from every Box in the store.
+func (t *Type) fullResync(start time.Time) (*resyncStats, error) {
+	var buf items
+	now := start.UnixNano()
+	if err := t.boxes.Scan(context.TODO(), t.slots, func(box *models.Box) error {
+		if item := t.queueItemOf(box); item != nil && item.Available(now) {
+			buf = append(buf, &entry{QueueItem: item})
+		}
+		return nil
+	}); err != nil {
+		return &resyncStats{}, errors.Wrap(err, "list Box")
+	}
+	t.load(buf)
+	t.setHighWater(start)
+	return &resyncStats{updated: len(buf)}, nil
+}
+
+// incrementalResync streams the Boxes changed or deleted since the given time and applies them to
+// the queue in batches.
+func (t *Type) incrementalResync(since, start time.Time) (*resyncStats, error) {
+	stats := &resyncStats{}
+	batch := make([]*models.Box, 0, resyncBatchSize)
+	if err := t.boxes.ScanModified(context.TODO(), since, t.slots, func(box *models.Box) error {
+		if batch = append(batch, box); len(batch) == resyncBatchSize {
+			t.applyBoxes(batch, stats)
+			batch = batch[:0]
+		}
+		return nil
+	}); err != nil {
+		return stats, errors.Wrap(err, "list modified Box")
+	}
+	t.applyBoxes(batch, stats)
+	var deleted []string
+	if err := t.boxes.ScanDeleted(context.TODO(), since, func(id string) error {
+		if deleted = append(deleted, id); len(deleted) == resyncBatchSize {
+			t.removeAll(deleted, stats)
+			deleted = deleted[:0]
+		}
+		return nil
+	}); err != nil {
+		return stats, errors.Wrap(err, "list deleted Box")
+	}
+	t.removeAll(deleted, stats)
+	t.setHighWater(start)
+	return stats, nil
+}
+
+// applyBoxes updates the queue with the current state of the given Boxes.
+func (t *Type) applyBoxes(boxes []*models.Box, stats *resyncStats) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	now := time.Now().UnixNano()
+	for _, box := range boxes {
+		switch t.applyBox(box, now) {
+		case resyncChangeUpdated:
+			stats.updated++
+		case resyncChangeRemoved:
+			stats.removed++
+		}
+	}
+}
+
+// applyBox updates the queue with the current state of a Box, adding it if it has become
+// eligible and removing it if it is no longer, and returns the kind of change made if any; the
+// lock must be held by the caller.
+func (t *Type) applyBox(box *models.Box, now int64) string {
+	item := t.queueItemOf(box)
+	existing, ok := t.index[box.Id]
+	if item == nil || !item.Available(now) {
+		if !ok {
+			return ""
+		}
+		t.remove(existing)
+		t.record(&journalRecord{Op: journalOpRemove, Id: box.Id})
+		return resyncChangeRemoved
+	}
+	if ok {
+		// a view handed out after the Box was read must not be undone
+		if existing.Score > item.Score {
+			item.Score = existing.Score
+		}
+		if existing.Views > item.Views {
+			item.Views = existing.Views
+		}
+		if *existing.QueueItem == *item {
+			return ""
+		}
+	}
+	t.apply(item)
+	t.record(&journalRecord{Op: journalOpSync, Item: item})
+	return resyncChangeUpdated
+}
+
+// removeAll removes the items of the given IDs.
+func (t *Type) removeAll(ids []string, stats *resyncStats) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for _, id := range ids {
+		if e, ok := t.index[id]; ok {
+			t.remove(e)
+			t.record(&journalRecord{Op: journalOpRemove, Id: id})
+			stats.removed++
+		}
+	}
+}
+
+func (t *Type) setHighWater(highWater time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.highWater = highWater
+	t.record(&journalRecord{Op: journalOpHighWater, HighWater: &highWater})
+}
+
+// queueItemOf returns the QueueItem of a Box, or nil if the Box does not belong in the queue.
+func (t *Type) queueItemOf(box *models.Box) *models.QueueItem {
+	if box.LastViewed == nil || !box.Approved() || !t.partition.Owns(box.Id) {
+		return nil
+	}
+	return models.NewQueueItem(box)
+}
+
+// restore loads the persisted state of the queue, and tells if the queue is ready afterwards.
+func (t *Type) restore() bool {
+	if t.persister == nil {
+		return false
+	}
+	t.lock.Lock()
+	state, err := t.persister.restore()
+	if err == nil {
+		t.highWater = state.highWater
+	}
+	t.lock.Unlock()
+	if err != nil {
+		if err == ErrNoSnapshot {
+			t.logger.Info("no snapshot to restore from")
+		} else {
+			t.logger.Error(err, "restore snapshot")
+		}
+		return false
+	}
+	now := time.Now().UnixNano()
+	buf := make(items, 0, len(state.items))
+	for _, item := range state.items {
+		// the snapshot may have been taken with a different number of shards
+		if item.Available(now) && t.partition.Owns(item.Id) {
+			buf = append(buf, &entry{QueueItem: item})
+		}
+	}
+	t.load(buf)
+	t.logger.Info("snapshot restored", "count", len(buf))
+	// compact the replayed journals into a new snapshot
+	t.snapshotInBackground()
+	return true
+}
 
-func (it items) Len() int {
-	return len(it)
+// load replaces the content of the queue and makes it ready. Views recorded since the items were
+// read are kept, and the changes made while the queue was not ready are applied.
+func (t *Type) load(buf items) {
+	index := make(map[string]*entry, len(buf))
+	for _, e := range buf {
+		index[e.Id] = e
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for id, e := range index {
+		if existing, ok := t.index[id]; ok && existing.Score > e.Score {
+			e.Score, e.Views = existing.Score, existing.Views
+		}
+	}
+	buf.init()
+	t.items, t.index = buf, index
+	atomic.StoreInt32(&t.ready, 1)
+	for _, rec := range t.pending {
+		switch rec.Op {
+		case journalOpSync:
+			t.apply(rec.Item)
+		case journalOpRemove:
+			if e, ok := t.index[rec.Id]; ok {
+				t.remove(e)
+			}
+		}
+		t.record(rec)
+	}
+	t.pending = nil
 }
 
-func (it items) Less(i, j int) bool {
-	return it[i].Score < it[j].Score
+// record appends a change to the journal; the lock must be held by the caller.
+func (t *Type) record(rec *journalRecord) {
+	if t.persister == nil {
+		return
+	}
+	if err := t.persister.record(rec); err != nil {
+		t.logger.Error(err, "record change")
+	}
 }
 
-func (it items) Swap(i, j int) {
-	cpy := it[i]
-	it[i] = it[j]
-	it[j] = cpy
+func (t *Type) flush() {
+	if t.persister == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if err := t.persister.flush(); err != nil {
+		t.logger.Error(err, "flush journal")
+	}
+}
+
+// snapshotInBackground takes a snapshot unless one is being taken already.
+func (t *Type) snapshotInBackground() {
+	if t.persister == nil || !t.Ready() || !atomic.CompareAndSwapInt32(&t.snapshotting, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&t.snapshotting, 0)
+		if err := t.snapshot(); err != nil {
+			t.logger.Error(err, "take snapshot")
+		}
+	}()
+}
+
+// snapshot persists the whole state of the queue and starts a new journal.
+func (t *Type) snapshot() error {
+	t.lock.Lock()
+	buf := make([]models.QueueItem, len(t.items))
+	for i, e := range t.items {
+		buf[i] = *e.QueueItem
+	}
+	highWater := t.highWater
+	gen, err := t.persister.rotate()
+	t.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	if err = t.persister.writeSnapshot(gen, buf, highWater); err != nil {
+		return err
+	}
+	t.logger.V(log.LevelExtended).Info("snapshot taken", "generation", gen, "count", len(buf))
+	return nil
+}
+
+// shutdown persists the state of the queue before it stops.
+func (t *Type) shutdown() {
+	if t.persister == nil {
+		return
+	}
+	for !atomic.CompareAndSwapInt32(&t.snapshotting, 0, 1) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	defer atomic.StoreInt32(&t.snapshotting, 0)
+	if t.Ready() {
+		if err := t.snapshot(); err != nil {
+			t.logger.Error(err, "take snapshot")
+		}
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if err := t.persister.close(); err != nil {
+		t.logger.Error(err, "close journal")
+	}
 }
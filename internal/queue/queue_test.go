@@ -0,0 +1,385 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lichuan0620/secret-keeper-backend/internal/shard"
+	"github.com/lichuan0620/secret-keeper-backend/internal/store"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/mongo"
+)
+
+func newTestQueue(t *testing.T, boxes ...*models.Box) *Type {
+	bs := store.NewMemoryBoxStore()
+	for _, box := range boxes {
+		if err := bs.Create(context.Background(), box); err != nil {
+			t.Fatalf("create Box: %v", err)
+		}
+	}
+	q := New(bs, nil).(*Type)
+	if _, _, err := q.resync(true); err != nil {
+		t.Fatalf("resync: %v", err)
+	}
+	return q
+}
+
+func TestDequeueAvailability(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+	q := newTestQueue(t,
+		&models.Box{Id: "expired", LastViewed: &now, ExpiresAt: &past},
+		&models.Box{Id: "once", LastViewed: &now, MaxViews: 1},
+		&models.Box{Id: "later", LastViewed: &now, ExpiresAt: &future},
+		&models.Box{Id: "pending", LastViewed: &now, Status: models.BoxStatusPending},
+		&models.Box{Id: "rejected", LastViewed: &now, Status: models.BoxStatusRejected},
+	)
+	for _, id := range []string{"expired", "pending", "rejected"} {
+		if _, exists := q.index[id]; exists {
+			t.Fatalf("Box %s should not be loaded", id)
+		}
+	}
+	seen := make(map[string]int)
+	for i := 0; i < 10; i++ {
+		id, err := q.Dequeue(DequeueOptions{})
+		if err != nil {
+			t.Fatalf("dequeue: %v", err)
+		}
+		seen[id]++
+	}
+	if seen["once"] != 1 {
+		t.Fatalf("expecting Box with MaxViews 1 to be viewed once; got %d", seen["once"])
+	}
+	if seen["later"] != 9 {
+		t.Fatalf("expecting the rest of the views to go to the unexpired Box; got %v", seen)
+	}
+	// the views are written to the store in the background
+	if err := q.views.write(context.Background()); err != nil {
+		t.Fatalf("write views: %v", err)
+	}
+	box, err := q.boxes.Get(context.Background(), "later")
+	if err != nil {
+		t.Fatalf("get Box: %v", err)
+	}
+	if box.Views != 9 {
+		t.Fatalf("expecting 9 views recorded; got %d", box.Views)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	now := time.Now()
+	soon := now.Add(50 * time.Millisecond)
+	q := newTestQueue(t,
+		&models.Box{Id: "a", LastViewed: &now, ExpiresAt: &soon},
+		&models.Box{Id: "b", LastViewed: &now},
+	)
+	if purged := q.purge(); purged != 0 {
+		t.Fatalf("expecting nothing to be purged; got %d", purged)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if purged := q.purge(); purged != 1 {
+		t.Fatalf("expecting 1 item to be purged; got %d", purged)
+	}
+	if len(q.items) != 1 || q.items[0].Id != "b" || len(q.index) != 1 {
+		t.Fatalf("unexpected queue state after purge: %v", q.items)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	now := time.Now()
+	q := newTestQueue(t,
+		&models.Box{Id: "a", LastViewed: &now},
+		&models.Box{Id: "b", LastViewed: &now},
+	)
+	q.Remove("a")
+	q.Remove("unknown")
+	if _, exists := q.index["a"]; exists || len(q.items) != 1 {
+		t.Fatalf("unexpected queue state after removal: %v", q.items)
+	}
+	for i := 0; i < 5; i++ {
+		if id, err := q.Dequeue(DequeueOptions{}); err != nil || id != "b" {
+			t.Fatalf("expecting b; got %s, %v", id, err)
+		}
+	}
+}
+
+func TestSyncAfterView(t *testing.T) {
+	now := time.Now()
+	earlier, later := now.Add(-time.Minute), now.Add(time.Minute)
+	q := newTestQueue(t, &models.Box{Id: "a", LastViewed: &earlier})
+	if id, err := q.Dequeue(DequeueOptions{}); err != nil || id != "a" {
+		t.Fatalf("expecting a; got %s, %v", id, err)
+	}
+	viewed := *q.index["a"].QueueItem
+	q.sync(&models.QueueItem{Id: "b", Score: later.UnixNano()})
+	// a Sync built from the store before the view was written, e.g. by AddBoxEmoji
+	q.sync(&models.QueueItem{Id: "a", Score: earlier.UnixNano(), Engagement: 1})
+	if item := q.index["a"]; item.Score != viewed.Score || item.Views != viewed.Views || item.Engagement != 1 {
+		t.Fatalf("expecting the view to be kept; got %+v", *item.QueueItem)
+	}
+	if front := q.items[0]; front.Id != "a" {
+		t.Fatalf("expecting a viewed before b; got %s first", front.Id)
+	}
+	// a later view does move the item
+	q.sync(&models.QueueItem{Id: "a", Score: later.Add(time.Minute).UnixNano()})
+	if front := q.items[0]; front.Id != "b" {
+		t.Fatalf("expecting b to come first; got %s", front.Id)
+	}
+}
+
+func TestDequeueLeastRecentlyViewed(t *testing.T) {
+	now := time.Now()
+	var boxes []*models.Box
+	for i := 0; i < 20; i++ {
+		lastViewed := now.Add(time.Duration(i) * time.Second)
+		boxes = append(boxes, &models.Box{Id: fmt.Sprintf("%02d", i), LastViewed: &lastViewed})
+	}
+	q := newTestQueue(t, boxes...)
+	for i := 0; i < 100; i++ {
+		id, err := q.Dequeue(DequeueOptions{})
+		if err != nil {
+			t.Fatalf("dequeue: %v", err)
+		}
+		if i < len(boxes) && id >= fmt.Sprintf("%02d", i+randomFactor) {
+			t.Fatalf("dequeue %d: expecting one of the %d least recently viewed items; got %s", i, randomFactor, id)
+		}
+	}
+}
+
+func TestDequeueViewer(t *testing.T) {
+	now := time.Now()
+	var boxes []*models.Box
+	for i := 0; i < 10; i++ {
+		boxes = append(boxes, &models.Box{Id: fmt.Sprintf("%02d", i), LastViewed: &now})
+	}
+	q := newTestQueue(t, boxes...)
+	seen := make(map[string]bool)
+	for i := 0; i < len(boxes); i++ {
+		// views from others must not affect what the viewer has seen
+		if _, err := q.Dequeue(DequeueOptions{ViewerId: "other"}); err != nil {
+			t.Fatalf("dequeue: %v", err)
+		}
+		id, err := q.Dequeue(DequeueOptions{ViewerId: "viewer"})
+		if err != nil {
+			t.Fatalf("dequeue: %v", err)
+		}
+		if seen[id] {
+			t.Fatalf("item %s handed out to the same viewer twice", id)
+		}
+		seen[id] = true
+	}
+	// everything has been seen; the viewer still gets something
+	if _, err := q.Dequeue(DequeueOptions{ViewerId: "viewer"}); err != nil {
+		t.Fatalf("dequeue: %v", err)
+	}
+}
+
+func TestDequeueBatch(t *testing.T) {
+	now := time.Now()
+	q := newTestQueue(t,
+		&models.Box{Id: "a", LastViewed: &now},
+		&models.Box{Id: "b", LastViewed: &now},
+		&models.Box{Id: "once", LastViewed: &now, MaxViews: 1},
+	)
+	ids, err := q.DequeueBatch(DequeueOptions{}, 10)
+	if err != nil {
+		t.Fatalf("dequeue batch: %v", err)
+	}
+	if len(ids) != 3 || ids[0] == ids[1] || ids[1] == ids[2] || ids[0] == ids[2] {
+		t.Fatalf("expecting every item once; got %v", ids)
+	}
+	// reserved items are not viewed yet
+	for _, id := range ids {
+		if box, err := q.boxes.Get(context.Background(), id); err != nil || box.Views != 0 {
+			t.Fatalf("expecting no view of %s; got %v, %v", id, box, err)
+		}
+	}
+	// the only view of once is reserved
+	if ids, err = q.DequeueBatch(DequeueOptions{}, 10); err != nil || len(ids) != 2 {
+		t.Fatalf("expecting reserved items but once to be handed out again; got %v, %v", ids, err)
+	}
+	for _, id := range ids {
+		if id == "once" {
+			t.Fatalf("expecting once not to be reserved twice; got %v", ids)
+		}
+	}
+	if _, err = q.Dequeue(DequeueOptions{}); err != nil {
+		t.Fatalf("dequeue: %v", err)
+	}
+	if id, err := q.Dequeue(DequeueOptions{}); err != nil || id == "once" {
+		t.Fatalf("expecting once not to be handed out; got %s, %v", id, err)
+	}
+	// a reservation is given up once it expires
+	q.index["once"].reservations[0] = now.UnixNano()
+	if !q.index["once"].reservable(now.Add(time.Nanosecond).UnixNano()) {
+		t.Fatal("expecting the expired reservation to be given up")
+	}
+
+	later := now.Add(time.Second)
+	if err = q.RecordViews([]models.View{
+		{Id: "once", ViewerId: "viewer", ViewedAt: later},
+		{Id: "missing", ViewedAt: later},
+	}); err != nil {
+		t.Fatalf("record views: %v", err)
+	}
+	if err = q.views.write(context.Background()); err != nil {
+		t.Fatalf("write views: %v", err)
+	}
+	box, err := q.boxes.Get(context.Background(), "once")
+	if err != nil {
+		t.Fatalf("get Box: %v", err)
+	}
+	if box.Views != 1 || !box.LastViewed.Equal(later) {
+		t.Fatalf("expecting the view to be recorded; got %+v", box)
+	}
+	if _, exists := q.index["once"]; exists {
+		t.Fatal("expecting the exhausted item to be removed")
+	}
+	if !q.seen.Seen("viewer", "once") {
+		t.Fatal("expecting the view to be tracked for the viewer")
+	}
+}
+
+func TestSeenTracker(t *testing.T) {
+	s := newSeenTracker(2, 2)
+	s.Add("a", "1")
+	s.Add("a", "2")
+	s.Add("a", "3")
+	if s.Seen("a", "1") || !s.Seen("a", "2") || !s.Seen("a", "3") {
+		t.Fatal("expecting only the latest items to be remembered")
+	}
+	s.Add("b", "1")
+	s.Add("a", "4")
+	s.Add("c", "1")
+	if s.Seen("b", "1") {
+		t.Fatal("expecting the least recently active viewer to be forgotten")
+	}
+	if !s.Seen("a", "4") || !s.Seen("c", "1") {
+		t.Fatal("expecting active viewers to be remembered")
+	}
+}
+
+func TestIncrementalResync(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	q := newTestQueue(t,
+		&models.Box{Id: "kept", LastViewed: &now},
+		&models.Box{Id: "hidden", LastViewed: &now},
+		&models.Box{Id: "deleted", LastViewed: &now},
+	)
+	viewed, err := q.Dequeue(DequeueOptions{})
+	if err != nil {
+		t.Fatalf("dequeue: %v", err)
+	}
+	score := q.index[viewed].Score
+	for _, box := range []*models.Box{
+		{Id: "added", LastViewed: &now},
+		{Id: "pending", LastViewed: &now, Status: models.BoxStatusPending},
+	} {
+		if err = q.boxes.Create(ctx, box); err != nil {
+			t.Fatalf("create Box: %v", err)
+		}
+	}
+	hidden := models.BoxStatusHidden
+	if _, err = q.boxes.Update(ctx, "hidden", &store.BoxUpdate{Status: &hidden}); err != nil {
+		t.Fatalf("update Box: %v", err)
+	}
+	if err = q.boxes.Delete(ctx, "deleted"); err != nil {
+		t.Fatalf("delete Box: %v", err)
+	}
+
+	mode, stats, err := q.resync(false)
+	if err != nil {
+		t.Fatalf("resync: %v", err)
+	}
+	if mode != resyncModeIncremental {
+		t.Fatalf("expecting an incremental resync; got %s", mode)
+	}
+	if stats.removed != 2 {
+		t.Fatalf("expecting 2 removed items; got %d", stats.removed)
+	}
+	for id, expected := range map[string]bool{
+		"kept": true, "added": true, "hidden": false, "deleted": false, "pending": false,
+	} {
+		if _, exists := q.index[id]; exists != expected {
+			t.Fatalf("expecting %s in the queue: %t; got %t", id, expected, exists)
+		}
+	}
+	if e, ok := q.index[viewed]; ok && e.Score != score {
+		t.Fatalf("expecting the view of %s to be kept", viewed)
+	}
+
+	// a queue that has not been resynced for too long is rebuilt
+	q.highWater = now.Add(-mongo.TombstoneRetention)
+	if mode, _, err = q.resync(false); err != nil {
+		t.Fatalf("resync: %v", err)
+	}
+	if mode != resyncModeFull {
+		t.Fatalf("expecting a full resync; got %s", mode)
+	}
+}
+
+func TestPartition(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	bs := store.NewMemoryBoxStore()
+	for i := 0; i < 100; i++ {
+		if err := bs.Create(ctx, &models.Box{Id: fmt.Sprint(i), LastViewed: &now}); err != nil {
+			t.Fatalf("create Box: %v", err)
+		}
+	}
+	ring := shard.NewRing(2)
+	owners := make(map[string]int)
+	for i := 0; i < ring.Shards(); i++ {
+		q := New(bs, &Options{Partition: &shard.Partition{Ring: ring, Shard: i}}).(*Type)
+		if _, _, err := q.resync(true); err != nil {
+			t.Fatalf("resync: %v", err)
+		}
+		for id := range q.index {
+			if ring.Owner(id) != i {
+				t.Fatalf("shard %d loaded %s of shard %d", i, id, ring.Owner(id))
+			}
+			owners[id]++
+		}
+		for j := 100; j < 200; j++ {
+			if id := fmt.Sprint(j); ring.Owner(id) != i {
+				q.Sync(models.QueueItem{Id: id, Score: now.UnixNano()})
+				if len(q.buf) != 0 {
+					t.Fatalf("expecting shard %d to ignore %s of shard %d", i, id, ring.Owner(id))
+				}
+				break
+			}
+		}
+	}
+	if len(owners) != 100 {
+		t.Fatalf("expecting every Box to be loaded by a shard; got %d", len(owners))
+	}
+}
+
+type fakeLeader bool
+
+func (l *fakeLeader) IsLeader() bool {
+	return bool(*l)
+}
+
+func TestDequeueLeader(t *testing.T) {
+	now := time.Now()
+	bs := store.NewMemoryBoxStore()
+	if err := bs.Create(context.Background(), &models.Box{Id: "a", LastViewed: &now}); err != nil {
+		t.Fatalf("create Box: %v", err)
+	}
+	leader := fakeLeader(false)
+	q := New(bs, &Options{Leader: &leader}).(*Type)
+	if _, _, err := q.resync(true); err != nil {
+		t.Fatalf("resync: %v", err)
+	}
+	if _, err := q.Dequeue(DequeueOptions{}); err != ErrNotLeader {
+		t.Fatalf("expecting ErrNotLeader from a follower; got %v", err)
+	}
+	leader = true
+	if id, err := q.Dequeue(DequeueOptions{}); err != nil || id != "a" {
+		t.Fatalf("expecting a from the leader; got %q, %v", id, err)
+	}
+}
@@ -0,0 +1,85 @@
+package queue
+
+import "container/list"
+
+const (
+	// maxViewers is the number of viewers whose history is kept; the least recently active viewers
+	// are forgotten first.
+	maxViewers = 100000
+	// seenPerViewer is the number of recently viewed items remembered for every viewer.
+	seenPerViewer = 64
+)
+
+// SeenTracker remembers the items recently handed out to every viewer within a bounded amount of
+// memory. It is not safe for concurrent use.
+type SeenTracker struct {
+	maxViewers int
+	perViewer  int
+	viewers    map[string]*list.Element
+	// lru holds *viewerHistory, the most recently active viewer in front
+	lru *list.List
+}
+
+// viewerHistory is a ring buffer of the items seen by a viewer along with a set for lookups.
+type viewerHistory struct {
+	viewer string
+	ring   []string
+	next   int
+	set    map[string]struct{}
+}
+
+// NewSeenTracker returns a SeenTracker remembering as much as the one of the queue.
+func NewSeenTracker() *SeenTracker {
+	return newSeenTracker(maxViewers, seenPerViewer)
+}
+
+func newSeenTracker(maxViewers, perViewer int) *SeenTracker {
+	return &SeenTracker{
+		maxViewers: maxViewers,
+		perViewer:  perViewer,
+		viewers:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// Seen tells if the item has recently been handed out to the viewer.
+func (s *SeenTracker) Seen(viewer, id string) bool {
+	elem, ok := s.viewers[viewer]
+	if !ok {
+		return false
+	}
+	_, seen := elem.Value.(*viewerHistory).set[id]
+	return seen
+}
+
+// Add records that the item has been handed out to the viewer.
+func (s *SeenTracker) Add(viewer, id string) {
+	var history *viewerHistory
+	if elem, ok := s.viewers[viewer]; ok {
+		s.lru.MoveToFront(elem)
+		history = elem.Value.(*viewerHistory)
+	} else {
+		if s.lru.Len() >= s.maxViewers {
+			oldest := s.lru.Back()
+			s.lru.Remove(oldest)
+			delete(s.viewers, oldest.Value.(*viewerHistory).viewer)
+		}
+		history = &viewerHistory{
+			viewer: viewer,
+			ring:   make([]string, 0, s.perViewer),
+			set:    make(map[string]struct{}, s.perViewer),
+		}
+		s.viewers[viewer] = s.lru.PushFront(history)
+	}
+	if _, seen := history.set[id]; seen {
+		return
+	}
+	if len(history.ring) < s.perViewer {
+		history.ring = append(history.ring, id)
+	} else {
+		delete(history.set, history.ring[history.next])
+		history.ring[history.next] = id
+		history.next = (history.next + 1) % s.perViewer
+	}
+	history.set[id] = struct{}{}
+}
@@ -0,0 +1,364 @@
+package queue
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+	"github.com/pkg/errors"
+)
+
+// The queue state is persisted as generations of snapshot and journal files. The journal of a
+// generation records every change made after the snapshot of the same generation was taken, so the
+// state is restored by loading the latest complete snapshot and replaying the journals of that
+// generation and the later ones, in order.
+const (
+	snapshotPrefix = "snapshot-"
+	journalPrefix  = "journal-"
+	fileSuffix     = ".json"
+
+	journalOpSync      = "Sync"
+	journalOpView      = "View"
+	journalOpRemove    = "Remove"
+	journalOpHighWater = "HighWater"
+
+	// maxJournalLine limits the size of a journal record, which is a single QueueItem.
+	maxJournalLine = 64 * 1024
+)
+
+// ErrNoSnapshot is returned when there is no complete snapshot to restore from.
+var ErrNoSnapshot = errors.New("no snapshot")
+
+// journalRecord is a line in a journal.
+type journalRecord struct {
+	Op    string            `json:"Op"`
+	Item  *models.QueueItem `json:"Item,omitempty"`
+	Id    string            `json:"Id,omitempty"`
+	Score int64             `json:"Score,omitempty"`
+	Views uint              `json:"Views,omitempty"`
+	// HighWater is the high-water mark of the resyncs, see Type.highWater.
+	HighWater *time.Time `json:"HighWater,omitempty"`
+}
+
+// snapshotRecord is a line in a snapshot. The last line is a trailer holding the number of items,
+// which tells a complete snapshot from a truncated one, and the high-water mark of the resyncs.
+type snapshotRecord struct {
+	Item      *models.QueueItem `json:"Item,omitempty"`
+	Count     *int              `json:"Count,omitempty"`
+	HighWater *time.Time        `json:"HighWater,omitempty"`
+}
+
+// state is the persisted state of a queue.
+type state struct {
+	items     map[string]*models.QueueItem
+	highWater time.Time
+}
+
+// persister writes snapshots and journals to a directory. Its methods must be called with the
+// queue lock held unless noted otherwise.
+type persister struct {
+	dir     string
+	gen     uint64
+	journal *os.File
+	writer  *bufio.Writer
+}
+
+func newPersister(dir string) *persister {
+	return &persister{dir: dir}
+}
+
+// record appends a change to the journal. Changes made before the first generation is started
+// are not recorded; they are covered by the first snapshot.
+func (p *persister) record(rec *journalRecord) error {
+	if p.writer == nil {
+		return nil
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return errors.Wrap(err, "encode journal record")
+	}
+	if _, err = p.writer.Write(append(data, '\n')); err != nil {
+		return errors.Wrap(err, "write journal")
+	}
+	return nil
+}
+
+// flush writes the buffered journal records to the file.
+func (p *persister) flush() error {
+	if p.writer == nil {
+		return nil
+	}
+	return errors.Wrap(p.writer.Flush(), "flush journal")
+}
+
+// rotate starts a new generation and returns its number; the snapshot of the generation must be
+// written with writeSnapshot afterwards.
+func (p *persister) rotate() (uint64, error) {
+	if err := p.close(); err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(p.dir, 0o755); err != nil {
+		return 0, errors.Wrap(err, "create snapshot directory")
+	}
+	gen := p.gen + 1
+	f, err := os.OpenFile(p.path(journalPrefix, gen), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return 0, errors.Wrap(err, "open journal")
+	}
+	p.gen, p.journal, p.writer = gen, f, bufio.NewWriter(f)
+	return gen, nil
+}
+
+// close flushes and closes the current journal.
+func (p *persister) close() error {
+	if p.journal == nil {
+		return nil
+	}
+	err := p.writer.Flush()
+	if closeErr := p.journal.Close(); err == nil {
+		err = closeErr
+	}
+	p.journal, p.writer = nil, nil
+	return errors.Wrap(err, "close journal")
+}
+
+// writeSnapshot atomically writes the snapshot of a generation and removes the files of the
+// previous generations, which are no longer needed. It does not require the queue lock.
+func (p *persister) writeSnapshot(gen uint64, items []models.QueueItem, highWater time.Time) error {
+	f, err := ioutil.TempFile(p.dir, snapshotPrefix)
+	if err != nil {
+		return errors.Wrap(err, "create snapshot")
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for i := range items {
+		if err = enc.Encode(&snapshotRecord{Item: &items[i]}); err != nil {
+			return errors.Wrap(err, "write snapshot")
+		}
+	}
+	trailer := snapshotRecord{Count: new(int)}
+	*trailer.Count = len(items)
+	if !highWater.IsZero() {
+		trailer.HighWater = &highWater
+	}
+	if err = enc.Encode(&trailer); err != nil {
+		return errors.Wrap(err, "write snapshot")
+	}
+	if err = w.Flush(); err != nil {
+		return errors.Wrap(err, "write snapshot")
+	}
+	if err = f.Sync(); err != nil {
+		return errors.Wrap(err, "sync snapshot")
+	}
+	if err = os.Rename(f.Name(), p.path(snapshotPrefix, gen)); err != nil {
+		return errors.Wrap(err, "rename snapshot")
+	}
+	files, err := p.list()
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.gen < gen {
+			_ = os.Remove(filepath.Join(p.dir, file.name))
+		}
+	}
+	return nil
+}
+
+// restore loads the latest complete snapshot and replays the journals written after it. It
+// returns ErrNoSnapshot if there is nothing to restore from, or another error if the files are
+// corrupt. The generation continues from the latest one found even if restoring fails, so that
+// the next snapshot supersedes the files that could not be restored.
+func (p *persister) restore() (*state, error) {
+	files, err := p.list()
+	if err != nil {
+		return nil, err
+	}
+	if len(files) > 0 {
+		p.gen = files[len(files)-1].gen
+	}
+	// snapshots are renamed into place once complete, so only the latest one is ever needed; the
+	// files of the previous generations may already be gone
+	snapshot := -1
+	for i := len(files) - 1; i >= 0; i-- {
+		if files[i].snapshot {
+			snapshot = i
+			break
+		}
+	}
+	if snapshot < 0 {
+		return nil, ErrNoSnapshot
+	}
+	state, err := p.loadSnapshot(files[snapshot].name)
+	if err != nil {
+		return nil, err
+	}
+	var journals []file
+	for _, f := range files {
+		if !f.snapshot && f.gen >= files[snapshot].gen {
+			journals = append(journals, f)
+		}
+	}
+	for i, f := range journals {
+		if err = p.replay(f.name, state, i == len(journals)-1); err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
+}
+
+func (p *persister) loadSnapshot(name string) (*state, error) {
+	f, err := os.Open(filepath.Join(p.dir, name))
+	if err != nil {
+		return nil, errors.Wrap(err, "open snapshot")
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	s := &state{items: make(map[string]*models.QueueItem)}
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for {
+		var rec snapshotRecord
+		if err = dec.Decode(&rec); err != nil {
+			return nil, errors.Wrapf(err, "snapshot %s is incomplete", name)
+		}
+		if rec.Count != nil {
+			if *rec.Count != len(s.items) {
+				return nil, errors.Errorf("snapshot %s is corrupt: expecting %d items; got %d", name, *rec.Count, len(s.items))
+			}
+			if rec.HighWater != nil {
+				s.highWater = *rec.HighWater
+			}
+			return s, nil
+		}
+		if rec.Item != nil {
+			s.items[rec.Item.Id] = rec.Item
+		}
+	}
+}
+
+// replay applies a journal to the state. A torn record at the end of the last journal is the
+// result of a crash and is ignored; anything else that cannot be read means the journal is corrupt.
+func (p *persister) replay(name string, s *state, last bool) error {
+	f, err := os.Open(filepath.Join(p.dir, name))
+	if err != nil {
+		return errors.Wrap(err, "open journal")
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 4096), maxJournalLine)
+	var torn bool
+	for scanner.Scan() {
+		if torn {
+			return errors.Errorf("journal %s is corrupt", name)
+		}
+		var rec journalRecord
+		if err = json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			torn = true
+			continue
+		}
+		s.apply(&rec)
+	}
+	if err = scanner.Err(); err != nil {
+		return errors.Wrapf(err, "read journal %s", name)
+	}
+	if torn && !last {
+		return errors.Errorf("journal %s is corrupt", name)
+	}
+	return nil
+}
+
+func (s *state) apply(rec *journalRecord) {
+	switch rec.Op {
+	case journalOpSync:
+		if rec.Item == nil {
+			return
+		}
+		if existing, ok := s.items[rec.Item.Id]; ok {
+			score, views := existing.Score, existing.Views
+			*existing = *rec.Item
+			if score > existing.Score {
+				existing.Score = score
+			}
+			if views > existing.Views {
+				existing.Views = views
+			}
+		} else {
+			item := *rec.Item
+			s.items[item.Id] = &item
+		}
+	case journalOpView:
+		if existing, ok := s.items[rec.Id]; ok {
+			existing.Score, existing.Views = rec.Score, rec.Views
+		}
+	case journalOpRemove:
+		delete(s.items, rec.Id)
+	case journalOpHighWater:
+		if rec.HighWater != nil {
+			s.highWater = *rec.HighWater
+		}
+	}
+}
+
+type file struct {
+	name     string
+	gen      uint64
+	snapshot bool
+}
+
+// list returns the snapshot and journal files in the directory, ordered by generation with the
+// journal of a generation before its snapshot.
+func (p *persister) list() ([]file, error) {
+	entries, err := ioutil.ReadDir(p.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "read snapshot directory")
+	}
+	var ret []file
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+		f := file{name: name}
+		var prefix string
+		switch {
+		case strings.HasPrefix(name, snapshotPrefix):
+			prefix, f.snapshot = snapshotPrefix, true
+		case strings.HasPrefix(name, journalPrefix):
+			prefix = journalPrefix
+		default:
+			continue
+		}
+		if _, err = fmt.Sscanf(strings.TrimSuffix(strings.TrimPrefix(name, prefix), fileSuffix), "%d", &f.gen); err != nil {
+			continue
+		}
+		ret = append(ret, f)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].gen != ret[j].gen {
+			return ret[i].gen < ret[j].gen
+		}
+		return !ret[i].snapshot && ret[j].snapshot
+	})
+	return ret, nil
+}
+
+func (p *persister) path(prefix string, gen uint64) string {
+	return filepath.Join(p.dir, fmt.Sprintf("%s%020d%s", prefix, gen, fileSuffix))
+}
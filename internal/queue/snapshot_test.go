@@ -0,0 +1,201 @@
+package queue
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lichuan0620/secret-keeper-backend/internal/store"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	bs := store.NewMemoryBoxStore()
+	for _, id := range []string{"a", "b", "c"} {
+		if err := bs.Create(context.Background(), &models.Box{Id: id, LastViewed: &now}); err != nil {
+			t.Fatalf("create Box: %v", err)
+		}
+	}
+	q := New(bs, &Options{SnapshotDir: dir}).(*Type)
+	if q.restore() {
+		t.Fatal("expecting nothing to restore from an empty directory")
+	}
+	if _, _, err := q.resync(true); err != nil {
+		t.Fatalf("resync: %v", err)
+	}
+	if err := q.snapshot(); err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	// changes after the snapshot go to the journal
+	viewed, err := q.Dequeue(DequeueOptions{})
+	if err != nil {
+		t.Fatalf("dequeue: %v", err)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		if id != viewed {
+			q.Remove(id)
+			break
+		}
+	}
+	q.sync(&models.QueueItem{Id: "d", Score: 1})
+	expected := make(map[string]models.QueueItem)
+	for _, e := range q.items {
+		expected[e.Id] = *e.QueueItem
+	}
+	q.shutdown()
+
+	// a restarted queue has the same state without reading the store
+	restored := New(store.NewMemoryBoxStore(), &Options{SnapshotDir: dir}).(*Type)
+	if !restored.restore() {
+		t.Fatal("expecting the state to be restored")
+	}
+	defer restored.shutdown()
+	if !restored.Ready() {
+		t.Fatal("expecting the restored queue to be ready")
+	}
+	if len(restored.items) != len(expected) {
+		t.Fatalf("expecting %d items; got %d", len(expected), len(restored.items))
+	}
+	for _, e := range restored.items {
+		if *e.QueueItem != expected[e.Id] {
+			t.Fatalf("expecting %+v; got %+v", expected[e.Id], *e.QueueItem)
+		}
+	}
+	if restored.index[viewed].Views != 1 {
+		t.Fatalf("expecting the view of %s to be restored", viewed)
+	}
+	if !restored.highWater.Equal(q.highWater) {
+		t.Fatalf("expecting high-water mark %v; got %v", q.highWater, restored.highWater)
+	}
+}
+
+func TestSnapshotJournal(t *testing.T) {
+	dir := t.TempDir()
+	p := newPersister(dir)
+	if _, err := p.restore(); err != ErrNoSnapshot {
+		t.Fatalf("expecting ErrNoSnapshot; got %v", err)
+	}
+	gen, err := p.rotate()
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	highWater := time.Unix(1000, 0)
+	if err = p.writeSnapshot(gen, []models.QueueItem{{Id: "a", Score: 1}, {Id: "b", Score: 2}}, highWater); err != nil {
+		t.Fatalf("write snapshot: %v", err)
+	}
+	highWater = highWater.Add(time.Minute)
+	for _, rec := range []*journalRecord{
+		{Op: journalOpView, Id: "a", Score: 3, Views: 1},
+		{Op: journalOpRemove, Id: "b"},
+		{Op: journalOpHighWater, HighWater: &highWater},
+	} {
+		if err = p.record(rec); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+	if err = p.close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	journal := p.path(journalPrefix, gen)
+
+	// a record torn by a crash at the end of the journal is ignored
+	appendFile(t, journal, `{"Op":"Sync","Item":{"Id":"c"`)
+	state, err := newPersister(dir).restore()
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if len(state.items) != 1 || state.items["a"].Score != 3 || state.items["a"].Views != 1 {
+		t.Fatalf("unexpected restored items: %v", state.items)
+	}
+	if !state.highWater.Equal(highWater) {
+		t.Fatalf("expecting high-water mark %v; got %v", highWater, state.highWater)
+	}
+
+	// anything after it means the journal is corrupt
+	appendFile(t, journal, "\n"+`{"Op":"Remove","Id":"a"}`+"\n")
+	if _, err = newPersister(dir).restore(); err == nil || err == ErrNoSnapshot {
+		t.Fatalf("expecting corrupt journal error; got %v", err)
+	}
+
+	// so is a snapshot without its trailer
+	snapshot := p.path(snapshotPrefix, gen)
+	data, err := ioutil.ReadFile(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Remove(journal); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(snapshot, data[:len(data)/2], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = newPersister(dir).restore(); err == nil || err == ErrNoSnapshot {
+		t.Fatalf("expecting corrupt snapshot error; got %v", err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, snapshotPrefix+"*")); len(matches) != 1 {
+		t.Fatalf("expecting temporary files to be cleaned up; got %v", matches)
+	}
+
+	// the next snapshot after a failed restore supersedes the corrupt one
+	p = newPersister(dir)
+	if _, err = p.restore(); err == nil {
+		t.Fatal("expecting corrupt snapshot error")
+	}
+	next, err := p.rotate()
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if next <= gen {
+		t.Fatalf("expecting a generation after %d; got %d", gen, next)
+	}
+	if err = p.writeSnapshot(next, []models.QueueItem{{Id: "c", Score: 1}}, highWater); err != nil {
+		t.Fatalf("write snapshot: %v", err)
+	}
+	if err = p.close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if _, err = os.Stat(snapshot); !os.IsNotExist(err) {
+		t.Fatalf("expecting the corrupt snapshot to be removed; got %v", err)
+	}
+	if state, err = newPersister(dir).restore(); err != nil || len(state.items) != 1 || state.items["c"] == nil {
+		t.Fatalf("expecting the new snapshot to be restored; got %v, %v", state, err)
+	}
+}
+
+func TestSyncBeforeReady(t *testing.T) {
+	now := time.Now()
+	bs := store.NewMemoryBoxStore()
+	if err := bs.Create(context.Background(), &models.Box{Id: "a", LastViewed: &now}); err != nil {
+		t.Fatalf("create Box: %v", err)
+	}
+	q := New(bs, nil).(*Type)
+	q.sync(&models.QueueItem{Id: "b", Score: now.UnixNano()})
+	q.Remove("a")
+	if _, _, err := q.resync(true); err != nil {
+		t.Fatalf("resync: %v", err)
+	}
+	if _, exists := q.index["a"]; exists {
+		t.Fatal("expecting removal before ready to be applied")
+	}
+	if _, exists := q.index["b"]; !exists {
+		t.Fatal("expecting sync before ready to be applied")
+	}
+}
+
+func appendFile(t *testing.T, name, data string) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	if _, err = f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
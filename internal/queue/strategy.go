@@ -0,0 +1,140 @@
+package queue
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+	"github.com/pkg/errors"
+)
+
+const (
+	// sampleSize is the number of random draws the sampling strategies make for every pick.
+	sampleSize = 32
+	// freshHalfLife is how fast the boost given by the fresh-first strategy decays with age.
+	freshHalfLife = 24 * time.Hour
+	// freshBoost is how much more likely a brand new item is picked by the fresh-first strategy
+	// compared to a very old one.
+	freshBoost = 10
+)
+
+// ErrUnknownStrategy is returned when a Strategy is selected by an unknown name.
+var ErrUnknownStrategy = errors.New("unknown strategy")
+
+// Items gives a Strategy read access to the items in the queue. It must not be retained after
+// Pick returns.
+type Items interface {
+	// Len returns the number of items.
+	Len() int
+	// At returns the i-th item, in no particular order; it is meant for random sampling.
+	At(i int) *models.QueueItem
+	// Ascend visits the items from the least recently viewed until fn returns false.
+	Ascend(fn func(*models.QueueItem) bool)
+}
+
+// Strategy decides which item Dequeue hands out.
+type Strategy interface {
+	// Pick chooses one of the items for which eligible returns true, or returns nil if it finds
+	// none. eligible may be called multiple times with the same item.
+	Pick(items Items, eligible func(*models.QueueItem) bool) *models.QueueItem
+}
+
+// Strategies are the available Strategies by name.
+var Strategies = map[string]Strategy{
+	"lru":            lruStrategy{},
+	"weighted-emoji": weightedStrategy{weight: emojiWeight},
+	"fresh-first":    weightedStrategy{weight: freshWeight},
+	"uniform":        uniformStrategy{},
+}
+
+// DefaultStrategy is the name of the Strategy used if none is configured.
+const DefaultStrategy = "lru"
+
+// StrategyByName returns the Strategy with the given name, or the default one if the name is
+// empty.
+func StrategyByName(name string) (Strategy, error) {
+	if name == "" {
+		name = DefaultStrategy
+	}
+	strategy, ok := Strategies[name]
+	if !ok {
+		return nil, errors.Wrap(ErrUnknownStrategy, name)
+	}
+	return strategy, nil
+}
+
+// lruStrategy picks at random among the randomFactor least recently viewed items.
+type lruStrategy struct{}
+
+func (lruStrategy) Pick(items Items, eligible func(*models.QueueItem) bool) *models.QueueItem {
+	var candidates []*models.QueueItem
+	items.Ascend(func(item *models.QueueItem) bool {
+		if eligible(item) {
+			candidates = append(candidates, item)
+		}
+		return len(candidates) < randomFactor
+	})
+	if len(candidates) == 0 {
+		return nil
+	}
+	return candidates[rand.Intn(len(candidates))]
+}
+
+// uniformStrategy picks any item with the same probability.
+type uniformStrategy struct{}
+
+func (uniformStrategy) Pick(items Items, eligible func(*models.QueueItem) bool) *models.QueueItem {
+	for i := 0; i < sampleSize && items.Len() > 0; i++ {
+		if item := items.At(rand.Intn(items.Len())); eligible(item) {
+			return item
+		}
+	}
+	// mostly ineligible items; avoid failing by chance
+	return lruStrategy{}.Pick(items, eligible)
+}
+
+// weightedStrategy draws a random sample of items and picks one of them with a probability
+// proportional to its weight.
+type weightedStrategy struct {
+	weight func(item *models.QueueItem, now int64) float64
+}
+
+func (s weightedStrategy) Pick(items Items, eligible func(*models.QueueItem) bool) *models.QueueItem {
+	now := time.Now().UnixNano()
+	var (
+		chosen *models.QueueItem
+		total  float64
+	)
+	for i := 0; i < sampleSize && items.Len() > 0; i++ {
+		item := items.At(rand.Intn(items.Len()))
+		if !eligible(item) {
+			continue
+		}
+		// weighted reservoir sampling of a single item
+		w := s.weight(item, now)
+		total += w
+		if rand.Float64()*total < w {
+			chosen = item
+		}
+	}
+	if chosen == nil {
+		return lruStrategy{}.Pick(items, eligible)
+	}
+	return chosen
+}
+
+func emojiWeight(item *models.QueueItem, _ int64) float64 {
+	return 1 + float64(item.Engagement)
+}
+
+func freshWeight(item *models.QueueItem, now int64) float64 {
+	if item.CreatedAt == 0 {
+		return 1
+	}
+	age := float64(now-item.CreatedAt) / float64(freshHalfLife)
+	if age < 0 {
+		age = 0
+	}
+	return 1 + (freshBoost-1)*math.Pow(2, -age)
+}
@@ -0,0 +1,109 @@
+package queue
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+)
+
+func TestStrategies(t *testing.T) {
+	now := time.Now()
+	var h items
+	for i := 0; i < 100; i++ {
+		item := &models.QueueItem{
+			Id:        fmt.Sprint(i),
+			Score:     int64(i),
+			CreatedAt: now.Add(-30 * 24 * time.Hour).UnixNano(),
+		}
+		h.Push(&entry{QueueItem: item})
+	}
+	h.init()
+	// a single item stands out in every dimension the weighted strategies care about
+	popular := h[50].QueueItem
+	popular.Engagement = 1000
+	popular.CreatedAt = now.UnixNano()
+
+	even := func(item *models.QueueItem) bool {
+		var i int
+		_, _ = fmt.Sscan(item.Id, &i)
+		return i%2 == 0
+	}
+	for name, strategy := range Strategies {
+		picked := make(map[string]int)
+		for i := 0; i < 1000; i++ {
+			item := strategy.Pick(h, even)
+			if item == nil || !even(item) {
+				t.Fatalf("%s: expecting an eligible item; got %v", name, item)
+			}
+			picked[item.Id]++
+		}
+		switch name {
+		case "lru":
+			for id := range picked {
+				if len(id) > 1 {
+					t.Fatalf("%s: expecting only the least recently viewed items; got %s", name, id)
+				}
+			}
+		case "uniform":
+			if len(picked) < 40 {
+				t.Fatalf("%s: expecting most eligible items to be picked; got %d", name, len(picked))
+			}
+		case "weighted-emoji", "fresh-first":
+			// an item is picked 20 times on average without weights; the favoured item about 110
+			// times by fresh-first, with a standard deviation of about 10, and more by weighted-emoji
+			if picked[popular.Id] < 50 {
+				t.Fatalf("%s: expecting the favoured item to be picked often; got %d times", name, picked[popular.Id])
+			}
+		}
+		if item := strategy.Pick(h, func(*models.QueueItem) bool { return false }); item != nil {
+			t.Fatalf("%s: expecting nil without eligible items; got %v", name, item)
+		}
+	}
+}
+
+func TestWeights(t *testing.T) {
+	now := time.Now()
+	for _, tc := range []struct {
+		Name   string
+		Weight func(*models.QueueItem, int64) float64
+		Item   models.QueueItem
+		Expect float64
+	}{
+		{Name: "no emoji", Weight: emojiWeight, Expect: 1},
+		{Name: "emoji", Weight: emojiWeight, Item: models.QueueItem{Engagement: 9}, Expect: 10},
+		{Name: "unknown age", Weight: freshWeight, Expect: 1},
+		{Name: "new", Weight: freshWeight, Item: models.QueueItem{CreatedAt: now.UnixNano()}, Expect: freshBoost},
+		{
+			Name:   "half life",
+			Weight: freshWeight,
+			Item:   models.QueueItem{CreatedAt: now.Add(-freshHalfLife).UnixNano()},
+			Expect: 1 + (freshBoost-1)/2.0,
+		},
+		{
+			Name:   "old",
+			Weight: freshWeight,
+			Item:   models.QueueItem{CreatedAt: now.Add(-30 * freshHalfLife).UnixNano()},
+			Expect: 1,
+		},
+	} {
+		if w := tc.Weight(&tc.Item, now.UnixNano()); math.Abs(w-tc.Expect) > 1e-6 {
+			t.Errorf("%s: expecting weight %v; got %v", tc.Name, tc.Expect, w)
+		}
+	}
+}
+
+func TestDequeueStrategy(t *testing.T) {
+	now := time.Now()
+	q := newTestQueue(t, &models.Box{Id: "a", LastViewed: &now})
+	if _, err := q.Dequeue(DequeueOptions{Strategy: "unknown"}); err == nil {
+		t.Fatal("expecting error dequeuing with an unknown strategy")
+	}
+	for name := range Strategies {
+		if id, err := q.Dequeue(DequeueOptions{Strategy: name}); err != nil || id != "a" {
+			t.Fatalf("%s: expecting a; got %s, %v", name, id, err)
+		}
+	}
+}
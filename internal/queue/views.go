@@ -0,0 +1,143 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/lichuan0620/secret-keeper-backend/internal/store"
+	"github.com/pkg/errors"
+)
+
+const (
+	// viewWriteInterval is how often the views handed out are written to the Box store.
+	viewWriteInterval = time.Second
+	// viewWriteBatch is the largest number of Boxes updated by a single bulk write.
+	viewWriteBatch = 500
+	// viewWriteTimeout bounds the final write on shutdown, after which the views left are lost
+	// to the store; the items in the queue keep them until the next full resync.
+	viewWriteTimeout = 10 * time.Second
+)
+
+// viewWriter writes the views handed out by the queue to the Box store in the background, so that
+// Dequeue does not wait for the database. The views of a Box between two writes are coalesced
+// into one update, and the updates are written in bulk.
+type viewWriter struct {
+	boxes  store.BoxStore
+	logger logr.Logger
+
+	// pending holds the views yet to be written by Box ID
+	pending map[string]*store.BoxViews
+	lock    sync.Mutex
+	// writeLock serializes the writes so that a failed batch is put back before the next write
+	writeLock sync.Mutex
+}
+
+func newViewWriter(boxes store.BoxStore, logger logr.Logger) *viewWriter {
+	return &viewWriter{
+		boxes:   boxes,
+		logger:  logger,
+		pending: make(map[string]*store.BoxViews),
+	}
+}
+
+// add records a view of a Box to be written.
+func (w *viewWriter) add(id string, viewed time.Time) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.merge(&store.BoxViews{Id: id, Count: 1, LastViewed: viewed})
+}
+
+// merge coalesces the views into the pending ones; the lock must be held by the caller.
+func (w *viewWriter) merge(v *store.BoxViews) {
+	existing, ok := w.pending[v.Id]
+	if !ok {
+		copied := *v
+		w.pending[v.Id] = &copied
+		return
+	}
+	existing.Count += v.Count
+	if v.LastViewed.After(existing.LastViewed) {
+		existing.LastViewed = v.LastViewed
+	}
+}
+
+// run writes the pending views periodically until stopCh is closed, and then writes what is left
+// before returning.
+func (w *viewWriter) run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(viewWriteInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			ctx, cancel := context.WithTimeout(context.Background(), viewWriteTimeout)
+			defer cancel()
+			// keep trying until the time is up, as the views are lost otherwise
+			for w.write(ctx) != nil && ctx.Err() == nil {
+				time.Sleep(100 * time.Millisecond)
+			}
+			if left := w.len(); left > 0 {
+				w.logger.Error(nil, "views not written to the store", "count", left)
+			}
+			return
+		case <-ticker.C:
+			_ = w.write(context.Background())
+		}
+	}
+}
+
+// write writes the pending views to the store. The views of a failed batch are put back to be
+// written next time, except those the store reports as written since they would be counted
+// twice.
+func (w *viewWriter) write(ctx context.Context) error {
+	w.writeLock.Lock()
+	defer w.writeLock.Unlock()
+	w.lock.Lock()
+	pending := w.pending
+	w.pending = make(map[string]*store.BoxViews)
+	w.lock.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+	batch := make([]store.BoxViews, 0, viewWriteBatch)
+	var err error
+	writeBatch := func() {
+		failed := batch
+		if err == nil {
+			if err = w.boxes.MarkViewed(ctx, batch); err != nil {
+				var viewsErr *store.ViewsError
+				if errors.As(err, &viewsErr) {
+					failed = viewsErr.Failed
+				}
+			}
+		}
+		if err != nil {
+			w.lock.Lock()
+			for i := range failed {
+				w.merge(&failed[i])
+			}
+			w.lock.Unlock()
+		}
+		batch = batch[:0]
+	}
+	for _, v := range pending {
+		if batch = append(batch, *v); len(batch) == viewWriteBatch {
+			writeBatch()
+		}
+	}
+	if len(batch) > 0 {
+		writeBatch()
+	}
+	if err != nil {
+		w.logger.Error(err, "write views")
+	}
+	viewWrites.WithLabelValues(resultOf(err)).Inc()
+	return err
+}
+
+func (w *viewWriter) len() int {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return len(w.pending)
+}
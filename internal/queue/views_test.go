@@ -0,0 +1,116 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lichuan0620/secret-keeper-backend/internal/store"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/telemetry/log"
+	"github.com/pkg/errors"
+)
+
+// flakyBoxStore fails to record views while fail is set, and counts the bulk writes otherwise.
+// The views of the Boxes in failIds are not recorded while the others are.
+type flakyBoxStore struct {
+	store.BoxStore
+	fail    bool
+	failIds map[string]bool
+	writes  int
+}
+
+func (s *flakyBoxStore) MarkViewed(ctx context.Context, views []store.BoxViews) error {
+	if s.fail {
+		return errors.New("unavailable")
+	}
+	s.writes++
+	var recorded, failed []store.BoxViews
+	for _, v := range views {
+		if s.failIds[v.Id] {
+			failed = append(failed, v)
+		} else {
+			recorded = append(recorded, v)
+		}
+	}
+	if err := s.BoxStore.MarkViewed(ctx, recorded); err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		return &store.ViewsError{Failed: failed, Err: errors.New("unavailable")}
+	}
+	return nil
+}
+
+func TestViewWriter(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	bs := &flakyBoxStore{BoxStore: store.NewMemoryBoxStore()}
+	for _, id := range []string{"a", "b"} {
+		if err := bs.Create(ctx, &models.Box{Id: id, LastViewed: &now}); err != nil {
+			t.Fatalf("create Box: %v", err)
+		}
+	}
+	w := newViewWriter(bs, log.New())
+	later := now.Add(time.Minute)
+	w.add("a", later)
+	w.add("a", now)
+	w.add("b", now)
+
+	// the views are kept until they are written
+	bs.fail = true
+	if err := w.write(ctx); err == nil {
+		t.Fatal("expecting the write to fail")
+	}
+	w.add("a", now)
+	bs.fail = false
+	if err := w.write(ctx); err != nil {
+		t.Fatalf("write views: %v", err)
+	}
+	if bs.writes != 1 {
+		t.Fatalf("expecting the views to be coalesced into 1 write; got %d", bs.writes)
+	}
+	box, err := bs.Get(ctx, "a")
+	if err != nil {
+		t.Fatalf("get Box: %v", err)
+	}
+	if box.Views != 3 || !box.LastViewed.Equal(later) {
+		t.Fatalf("expecting 3 views last at %v; got %d at %v", later, box.Views, box.LastViewed)
+	}
+
+	// only the views not recorded are written again
+	bs.failIds = map[string]bool{"b": true}
+	w.add("a", now)
+	w.add("b", now)
+	if err = w.write(ctx); err == nil {
+		t.Fatal("expecting the write to fail")
+	}
+	bs.failIds = nil
+	if err = w.write(ctx); err != nil {
+		t.Fatalf("write views: %v", err)
+	}
+	for id, expected := range map[string]uint{"a": 4, "b": 2} {
+		if box, err = bs.Get(ctx, id); err != nil {
+			t.Fatalf("get Box: %v", err)
+		}
+		if box.Views != expected {
+			t.Fatalf("expecting %d views of %s; got %d", expected, id, box.Views)
+		}
+	}
+
+	// the views left are written on shutdown
+	w.add("b", later)
+	stopCh, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		w.run(stopCh)
+	}()
+	close(stopCh)
+	<-done
+	if box, err = bs.Get(ctx, "b"); err != nil {
+		t.Fatalf("get Box: %v", err)
+	}
+	if box.Views != 3 {
+		t.Fatalf("expecting 3 views of b; got %d", box.Views)
+	}
+}
@@ -0,0 +1,134 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/lichuan0620/secret-keeper-backend/internal/store"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+	"github.com/pkg/errors"
+)
+
+// The ways the queue learns about the changes made to the Boxes.
+const (
+	// SyncModePush relies on the server pushing the changes with Sync.
+	SyncModePush = "push"
+	// SyncModeChangeStream tails the changes from the store with a store.BoxWatcher.
+	SyncModeChangeStream = "change-stream"
+)
+
+const (
+	// checkpointName is the name the resume token of the queue is saved under; each shard and
+	// replica has its own, see Type.checkpointName.
+	checkpointName = "queue"
+	// checkpointInterval is how often the resume token is saved while changes are coming in.
+	checkpointInterval = 5 * time.Second
+)
+
+// watch tails the changes made to the Boxes and applies them to the queue until ctx is done. It
+// continues from the saved resume token if there is one.
+func (t *Type) watch(ctx context.Context) {
+	const retry = 10 * time.Second
+	token := t.loadCheckpoint(ctx)
+	for {
+		err := t.tail(ctx, &token)
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, store.ErrHistoryLost) {
+			// the stream continues from now on, and the changes missed are picked up by the rebuild
+			t.logger.Info("change history lost; rebuilding the queue")
+			token = nil
+			go func() {
+				if err := t.Resync(true); err != nil {
+					t.logger.Error(err, "resync")
+				}
+			}()
+			continue
+		}
+		t.logger.Error(err, "watch Box changes")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+	}
+}
+
+// tail applies the changes after the token until an error occurs, keeping the token up to date.
+func (t *Type) tail(ctx context.Context, token *[]byte) error {
+	saved, savedAt := *token, time.Now()
+	defer func() {
+		if !bytes.Equal(saved, *token) {
+			t.saveCheckpoint(*token)
+		}
+	}()
+	return t.watcher.Watch(ctx, *token, func(change *store.BoxChange) error {
+		t.applyChange(change)
+		*token = change.Token
+		if time.Since(savedAt) >= checkpointInterval {
+			t.saveCheckpoint(*token)
+			saved, savedAt = *token, time.Now()
+		}
+		return nil
+	})
+}
+
+// applyChange applies a change of a Box to the queue. Changes made before the queue is ready are
+// applied once it is, like the pushed ones.
+func (t *Type) applyChange(change *store.BoxChange) {
+	box := change.Box
+	if box == nil {
+		box = &models.Box{Id: change.Id}
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	now := time.Now().UnixNano()
+	if t.Ready() {
+		if result := t.applyBox(box, now); result != "" {
+			watchedChanges.WithLabelValues(result).Inc()
+		}
+		return
+	}
+	if item := t.queueItemOf(box); item != nil && item.Available(now) {
+		t.pending = append(t.pending, &journalRecord{Op: journalOpSync, Item: item})
+	} else {
+		t.pending = append(t.pending, &journalRecord{Op: journalOpRemove, Id: box.Id})
+	}
+}
+
+func (t *Type) loadCheckpoint(ctx context.Context) []byte {
+	if t.checkpoints == nil {
+		return nil
+	}
+	token, err := t.checkpoints.Get(ctx, t.checkpointName())
+	if err != nil {
+		if err != store.ErrNotFound {
+			t.logger.Error(err, "load checkpoint")
+		}
+		return nil
+	}
+	return token
+}
+
+func (t *Type) saveCheckpoint(token []byte) {
+	if t.checkpoints == nil || token == nil {
+		return
+	}
+	if err := t.checkpoints.Save(context.TODO(), t.checkpointName(), token); err != nil {
+		t.logger.Error(err, "save checkpoint")
+	}
+}
+
+func (t *Type) checkpointName() string {
+	ret := checkpointName
+	if t.partition != nil {
+		ret += "-" + strconv.Itoa(t.partition.Shard)
+	}
+	if t.replica != "" {
+		ret += "-" + t.replica
+	}
+	return ret
+}
@@ -0,0 +1,84 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lichuan0620/secret-keeper-backend/internal/store"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+)
+
+func TestWatch(t *testing.T) {
+	ctx := context.Background()
+	bs, checkpoints := store.NewMemoryBoxStore(), store.NewMemoryCheckpointStore()
+	q := New(bs, &Options{Watcher: bs.(store.BoxWatcher), Checkpoints: checkpoints}).(*Type)
+	if _, _, err := q.resync(true); err != nil {
+		t.Fatalf("resync: %v", err)
+	}
+	// start from the first change; the memory BoxStore numbers its changes from 1
+	if err := checkpoints.Save(ctx, checkpointName, []byte("0")); err != nil {
+		t.Fatalf("save checkpoint: %v", err)
+	}
+	watch := func() (stop func()) {
+		watchCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			q.watch(watchCtx)
+		}()
+		return func() {
+			cancel()
+			<-done
+		}
+	}
+	now := time.Now()
+	stop := watch()
+	if err := bs.Create(ctx, &models.Box{Id: "a", LastViewed: &now}); err != nil {
+		t.Fatalf("create Box: %v", err)
+	}
+	waitForItem(t, q, "a", true)
+	if err := bs.Delete(ctx, "a"); err != nil {
+		t.Fatalf("delete Box: %v", err)
+	}
+	waitForItem(t, q, "a", false)
+	stop()
+	if _, err := checkpoints.Get(ctx, checkpointName); err != nil {
+		t.Fatalf("expecting the resume token to be saved; got %v", err)
+	}
+
+	// changes made while the queue is not watching are picked up after a restart
+	if err := bs.Create(ctx, &models.Box{Id: "b", LastViewed: &now}); err != nil {
+		t.Fatalf("create Box: %v", err)
+	}
+	stop = watch()
+	waitForItem(t, q, "b", true)
+	stop()
+
+	// the queue is rebuilt if the changes after the resume token are gone
+	if err := bs.Create(ctx, &models.Box{Id: "c", LastViewed: &now}); err != nil {
+		t.Fatalf("create Box: %v", err)
+	}
+	for i := 0; i < 2000; i++ {
+		if err := bs.MarkViewed(ctx, []store.BoxViews{{Id: "b", Count: 1, LastViewed: now}}); err != nil {
+			t.Fatalf("mark viewed: %v", err)
+		}
+	}
+	stop = watch()
+	defer stop()
+	waitForItem(t, q, "c", true)
+}
+
+func waitForItem(t *testing.T, q *Type, id string, expected bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		q.lock.Lock()
+		_, exists := q.index[id]
+		q.lock.Unlock()
+		if exists == expected {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expecting %s in the queue: %t", id, expected)
+}
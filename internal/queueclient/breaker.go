@@ -0,0 +1,66 @@
+package queueclient
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker is a circuit breaker: it opens after a number of consecutive failures, failing the calls
+// right away, and lets a single trial call through after a while to see if the queue is back.
+type breaker struct {
+	threshold   int
+	openTimeout time.Duration
+
+	failures int
+	// openUntil is when a trial call is allowed; the breaker is closed if it is zero
+	openUntil time.Time
+	// trial is set while the trial call is in flight
+	trial bool
+	lock  sync.Mutex
+}
+
+// allow tells if a call can be made; a call that is allowed must be followed by done or release.
+func (b *breaker) allow() bool {
+	if b.threshold <= 0 {
+		return true
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.openUntil.IsZero() {
+		return true
+	}
+	if b.trial || time.Now().Before(b.openUntil) {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// done records the outcome of an allowed call.
+func (b *breaker) done(failed bool) {
+	if b.threshold <= 0 {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.trial = false
+	if !failed {
+		b.failures, b.openUntil = 0, time.Time{}
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.openTimeout)
+	}
+}
+
+// release ends an allowed call whose outcome says nothing about the queue, such as a call given up
+// by the caller, recording neither a success nor a failure.
+func (b *breaker) release() {
+	if b.threshold <= 0 {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.trial = false
+}
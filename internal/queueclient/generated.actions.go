@@ -0,0 +1,99 @@
+// Code generated by queueclient generator. DO NOT EDIT.
+
+package queueclient
+
+import (
+	"context"
+
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service"
+)
+
+// Actions calls the Actions of the service.
+type Actions struct {
+	*service.Client
+}
+
+// NewActions returns the Actions making the calls with c.
+func NewActions(c *service.Client) *Actions {
+	return &Actions{Client: c}
+}
+
+// Dequeue calls the Dequeue Action of version 2021-12-23.
+func (c *Actions) Dequeue(ctx context.Context, viewerId string, strategy string) (*models.DequeueResponse, error) {
+	var ret *models.DequeueResponse
+	_, err := c.Call(ctx, &service.Request{
+		Action:  "Dequeue",
+		Version: "2021-12-23",
+		Query: map[string]interface{}{
+			"ViewerId": viewerId,
+			"Strategy": strategy,
+		},
+	}, &ret)
+	return ret, err
+}
+
+// DequeueBatch calls the DequeueBatch Action of version 2021-12-23.
+func (c *Actions) DequeueBatch(ctx context.Context, body *models.DequeueBatchRequest) (*models.DequeueBatchResponse, error) {
+	var ret *models.DequeueBatchResponse
+	_, err := c.Call(ctx, &service.Request{
+		Action:  "DequeueBatch",
+		Version: "2021-12-23",
+		Body:    body,
+	}, &ret)
+	return ret, err
+}
+
+// Health calls the Health Action of version 2021-12-23.
+func (c *Actions) Health(ctx context.Context) (models.HealthResponse, error) {
+	var ret models.HealthResponse
+	_, err := c.Call(ctx, &service.Request{
+		Action:  "Health",
+		Version: "2021-12-23",
+	}, &ret)
+	return ret, err
+}
+
+// RecordViews calls the RecordViews Action of version 2021-12-23.
+func (c *Actions) RecordViews(ctx context.Context, body *models.RecordViewsRequest) (models.RecordViewsResponse, error) {
+	var ret models.RecordViewsResponse
+	_, err := c.Call(ctx, &service.Request{
+		Action:  "RecordViews",
+		Version: "2021-12-23",
+		Body:    body,
+	}, &ret)
+	return ret, err
+}
+
+// Remove calls the Remove Action of version 2021-12-23.
+func (c *Actions) Remove(ctx context.Context, body *models.RemoveRequest) (models.RemoveResponse, error) {
+	var ret models.RemoveResponse
+	_, err := c.Call(ctx, &service.Request{
+		Action:  "Remove",
+		Version: "2021-12-23",
+		Body:    body,
+	}, &ret)
+	return ret, err
+}
+
+// Resync calls the Resync Action of version 2021-12-23.
+func (c *Actions) Resync(ctx context.Context, body *models.ResyncRequest) (models.ResyncResponse, error) {
+	var ret models.ResyncResponse
+	_, err := c.Call(ctx, &service.Request{
+		Action:  "Resync",
+		Version: "2021-12-23",
+		Body:    body,
+	}, &ret)
+	return ret, err
+}
+
+// Sync calls the Sync Action of version 2021-12-23.
+func (c *Actions) Sync(ctx context.Context, body *models.SyncRequest) (models.SyncResponse, error) {
+	var ret models.SyncResponse
+	_, err := c.Call(ctx, &service.Request{
+		Action:  "Sync",
+		Version: "2021-12-23",
+		Body:    body,
+	}, &ret)
+	return ret, err
+}
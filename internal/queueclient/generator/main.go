@@ -0,0 +1,30 @@
+package main
+
+import (
+	"io/ioutil"
+
+	"github.com/lichuan0620/secret-keeper-backend/cmd/queue/service"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/clientgen"
+	"github.com/pkg/errors"
+)
+
+func genActions() error {
+	source, err := clientgen.Generate(service.NewBuilder(nil).Actions(), &clientgen.Options{
+		Package:   "queueclient",
+		TypeName:  "Actions",
+		Generator: "queueclient generator",
+	})
+	if err != nil {
+		return errors.WithMessage(err, "gen client")
+	}
+	if err = ioutil.WriteFile("generated.actions.go", source, 0644); err != nil {
+		return errors.WithMessage(err, "write file")
+	}
+	return nil
+}
+
+func main() {
+	if err := genActions(); err != nil {
+		panic(err)
+	}
+}
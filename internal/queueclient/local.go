@@ -0,0 +1,82 @@
+package queueclient
+
+import (
+	"context"
+
+	"github.com/lichuan0620/secret-keeper-backend/internal/queue"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+)
+
+type local struct {
+	q queue.Interface
+}
+
+// NewLocal returns an Interface that talks to an in-process queue directly instead of going
+// through HTTP. It is meant for tests and local development.
+func NewLocal(q queue.Interface) Interface {
+	return &local{q: q}
+}
+
+func (l *local) Sync(_ context.Context, req *models.SyncRequest) error {
+	l.q.Sync(models.QueueItem(*req))
+	return nil
+}
+
+func (l *local) Dequeue(_ context.Context, req *models.DequeueRequest) (*models.DequeueResponse, error) {
+	id, err := l.q.Dequeue(queue.DequeueOptions{ViewerId: req.ViewerId, Strategy: req.Strategy})
+	if err == queue.ErrNoData {
+		return nil, ErrNoData
+	} else if err == queue.ErrNotLeader {
+		return nil, ErrNotLeader
+	} else if err != nil {
+		return nil, err
+	}
+	return &models.DequeueResponse{Id: id}, nil
+}
+
+func (l *local) DequeueBatch(_ context.Context, req *models.DequeueBatchRequest) (*models.DequeueBatchResponse, error) {
+	ids, err := l.q.DequeueBatch(queue.DequeueOptions{Strategy: req.Strategy}, req.Count)
+	if err == queue.ErrNoData {
+		return nil, ErrNoData
+	} else if err == queue.ErrNotLeader {
+		return nil, ErrNotLeader
+	} else if err != nil {
+		return nil, err
+	}
+	return &models.DequeueBatchResponse{Ids: ids}, nil
+}
+
+func (l *local) RecordViews(_ context.Context, req *models.RecordViewsRequest) error {
+	if err := l.q.RecordViews(req.Views); err == queue.ErrNotLeader {
+		return ErrNotLeader
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (l *local) Remove(_ context.Context, req *models.RemoveRequest) error {
+	l.q.Remove(req.Id)
+	return nil
+}
+
+func (l *local) Health(context.Context) error {
+	if !l.q.Serving() {
+		return ErrNotLeader
+	}
+	return nil
+}
+
+type withoutSync struct {
+	Interface
+}
+
+// WithoutSync returns an Interface that drops the Sync calls, for a queue that reads the changes
+// from the store itself; see queue.SyncModeChangeStream.
+func WithoutSync(c Interface) Interface {
+	return withoutSync{Interface: c}
+}
+
+func (withoutSync) Sync(context.Context, *models.SyncRequest) error {
+	return nil
+}
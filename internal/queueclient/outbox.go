@@ -0,0 +1,103 @@
+package queueclient
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/lichuan0620/secret-keeper-backend/internal/store"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/telemetry/log"
+)
+
+const (
+	// outboxInterval is how often the pending items are delivered.
+	outboxInterval = 5 * time.Second
+	// outboxBatch is the number of pending items read at a time.
+	outboxBatch = 100
+)
+
+// Outbox keeps the items of the failed Sync calls in a store.OutboxStore and delivers them later,
+// so that the queue learns about a Box even if it is unavailable for a while, rather than with
+// its next resync. Every server may deliver any pending item.
+//
+// An item delivered late may be older than one synced meanwhile; the queue corrects it with its
+// next resync.
+type Outbox struct {
+	Interface
+	outbox store.OutboxStore
+	logger logr.Logger
+}
+
+// NewOutbox returns an Outbox wrapping c.
+func NewOutbox(c Interface, outbox store.OutboxStore) *Outbox {
+	return &Outbox{
+		Interface: c,
+		outbox:    outbox,
+		logger:    log.New().WithName("outbox"),
+	}
+}
+
+// Sync only fails if the item can neither be synced nor put in the outbox.
+func (o *Outbox) Sync(ctx context.Context, req *models.SyncRequest) error {
+	err := o.Interface.Sync(ctx, req)
+	if err == nil {
+		return nil
+	}
+	// the item is kept even if the caller has given up
+	if putErr := o.outbox.Put(context.TODO(), (*models.QueueItem)(req)); putErr != nil {
+		o.logger.Error(putErr, "put item in outbox", "id", req.Id)
+		return err
+	}
+	o.logger.V(log.LevelExtended).Info("sync deferred", "id", req.Id, "error", err.Error())
+	return nil
+}
+
+// Remove discards the pending item of the Box so that it is not delivered after the removal.
+func (o *Outbox) Remove(ctx context.Context, req *models.RemoveRequest) error {
+	if err := o.outbox.Discard(ctx, req.Id); err != nil {
+		o.logger.Error(err, "discard item from outbox", "id", req.Id)
+	}
+	return o.Interface.Remove(ctx, req)
+}
+
+// Run delivers the pending items periodically until stopCh is closed.
+func (o *Outbox) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(outboxInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			o.deliver(context.Background())
+		}
+	}
+}
+
+// deliver syncs the pending items, oldest first, until there is none left or the queue fails.
+func (o *Outbox) deliver(ctx context.Context) {
+	for {
+		entries, err := o.outbox.List(ctx, outboxBatch)
+		if err != nil {
+			o.logger.Error(err, "list outbox")
+			return
+		}
+		for i := range entries {
+			entry := &entries[i]
+			if err = o.Interface.Sync(ctx, (*models.SyncRequest)(&entry.Item)); err != nil {
+				// the rest waits for the next round
+				o.logger.V(log.LevelExtended).Info("queue still failing", "pending", len(entries)-i, "error", err.Error())
+				return
+			}
+			if err = o.outbox.Delete(ctx, entry); err != nil {
+				o.logger.Error(err, "delete delivered item from outbox", "id", entry.Id)
+				return
+			}
+			o.logger.V(log.LevelExtended).Info("deferred sync delivered", "id", entry.Id)
+		}
+		if len(entries) < outboxBatch {
+			return
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package queueclient
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lichuan0620/secret-keeper-backend/internal/store"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+	"github.com/pkg/errors"
+)
+
+func TestOutbox(t *testing.T) {
+	ctx := context.Background()
+	queue := &fakeShard{err: errors.New("unavailable")}
+	outbox := store.NewMemoryOutboxStore()
+	c := NewOutbox(queue, outbox)
+	for _, id := range []string{"a", "b", "c"} {
+		if err := c.Sync(ctx, &models.SyncRequest{Id: id}); err != nil {
+			t.Fatalf("expecting the failed Sync to be deferred; got %v", err)
+		}
+	}
+	// a removed Box is not delivered
+	_ = c.Remove(ctx, &models.RemoveRequest{Id: "b"})
+
+	c.deliver(ctx)
+	if pending, _ := outbox.List(ctx, 10); len(pending) != 2 {
+		t.Fatalf("expecting 2 pending items while the queue fails; got %d", len(pending))
+	}
+	queue.err = nil
+	c.deliver(ctx)
+	if pending, _ := outbox.List(ctx, 10); len(pending) != 0 {
+		t.Fatalf("expecting the pending items to be delivered; got %d left", len(pending))
+	}
+	if len(queue.synced) != 2 || queue.synced[0] != "a" || queue.synced[1] != "c" {
+		t.Fatalf("expecting a and c to be delivered in order; got %v", queue.synced)
+	}
+}
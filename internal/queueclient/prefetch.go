@@ -0,0 +1,273 @@
+package queueclient
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/lichuan0620/secret-keeper-backend/internal/queue"
+	"github.com/lichuan0620/secret-keeper-backend/internal/store"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/telemetry/log"
+	"github.com/pkg/errors"
+)
+
+// maxPendingViews is the number of views kept for the next flush when reporting them has failed;
+// the oldest ones are dropped beyond that, and the queue learns about them with its resync.
+const maxPendingViews = 10000
+
+// PrefetchOptions configure a Prefetcher; the zero value is valid.
+type PrefetchOptions struct {
+	// Size is the number of Boxes kept in the pool; it defaults to 16.
+	Size int
+	// MaxAge is how long a prefetched Box may be handed out; it defaults to 10 seconds and may
+	// not exceed queue.ReservationTTL, after which the queue no longer holds the view reserved for
+	// the Box. Changes made to the Box meanwhile are only seen if they go through the Prefetcher.
+	MaxAge time.Duration
+	// FlushInterval is how often the views are reported to the queue; it defaults to 1 second.
+	FlushInterval time.Duration
+}
+
+// Prefetcher keeps a small pool of Boxes reserved from the queue with DequeueBatch and loaded
+// from the store ahead of time, so that most views are served from memory. The views are reported
+// to the queue in the background. It also implements Interface, dropping the Boxes passed to Sync
+// and Remove from the pool as they have changed.
+//
+// The pool is shared by all viewers since DequeueBatch does not take one, so the Prefetcher keeps
+// track of the Boxes it has handed out to every viewer and skips them like the queue does. Unlike
+// the queue, it only knows about the views served by itself, not by other server instances.
+type Prefetcher struct {
+	Interface
+	boxes         store.BoxStore
+	size          int
+	maxAge        time.Duration
+	flushInterval time.Duration
+	logger        logr.Logger
+
+	// pool holds the prefetched Boxes in the order the queue has handed them out
+	pool []prefetched
+	// views are the views yet to be reported
+	views []models.View
+	// seen are the Boxes recently handed out to every viewer
+	seen *queue.SeenTracker
+	lock sync.Mutex
+	// refillLock serializes the refills, and refilling is set while one runs in the background
+	refillLock sync.Mutex
+	refilling  int32
+}
+
+type prefetched struct {
+	box       *models.Box
+	fetchedAt time.Time
+}
+
+// NewPrefetcher returns a Prefetcher taking Boxes from the queue behind c.
+func NewPrefetcher(c Interface, boxes store.BoxStore, opts *PrefetchOptions) *Prefetcher {
+	if opts == nil {
+		opts = &PrefetchOptions{}
+	}
+	ret := &Prefetcher{
+		Interface:     c,
+		boxes:         boxes,
+		size:          opts.Size,
+		maxAge:        opts.MaxAge,
+		flushInterval: opts.FlushInterval,
+		logger:        log.New().WithName("prefetcher"),
+		seen:          queue.NewSeenTracker(),
+	}
+	if ret.size <= 0 {
+		ret.size = 16
+	}
+	if ret.maxAge <= 0 {
+		ret.maxAge = 10 * time.Second
+	} else if ret.maxAge > queue.ReservationTTL {
+		ret.maxAge = queue.ReservationTTL
+	}
+	if ret.flushInterval <= 0 {
+		ret.flushInterval = time.Second
+	}
+	return ret
+}
+
+// View hands out a Box from the pool that the viewer has not recently seen, refilling the pool
+// first if it has none, and counts a view of it by the viewer. Like Dequeue, it hands out a Box
+// the viewer has seen if there is no other. It returns ErrNoData if the queue has nothing to hand
+// out.
+func (p *Prefetcher) View(ctx context.Context, viewerID string) (*models.Box, error) {
+	box := p.take(viewerID, false)
+	if box == nil {
+		if err := p.refill(ctx); err != nil && err != ErrNoData {
+			return nil, err
+		}
+		if box = p.take(viewerID, true); box == nil {
+			return nil, ErrNoData
+		}
+	}
+	if p.low() && atomic.CompareAndSwapInt32(&p.refilling, 0, 1) {
+		go func() {
+			defer atomic.StoreInt32(&p.refilling, 0)
+			if err := p.refill(context.Background()); err != nil && err != ErrNoData {
+				p.logger.Error(err, "refill pool")
+			}
+		}()
+	}
+	now := time.Now()
+	p.lock.Lock()
+	p.views = append(p.views, models.View{Id: box.Id, ViewerId: viewerID, ViewedAt: now})
+	if viewerID != "" {
+		p.seen.Add(viewerID, box.Id)
+	}
+	p.lock.Unlock()
+	box.LastViewed = &now
+	box.Views++
+	return box, nil
+}
+
+func (p *Prefetcher) Sync(ctx context.Context, req *models.SyncRequest) error {
+	p.drop(req.Id)
+	return p.Interface.Sync(ctx, req)
+}
+
+func (p *Prefetcher) Remove(ctx context.Context, req *models.RemoveRequest) error {
+	p.drop(req.Id)
+	return p.Interface.Remove(ctx, req)
+}
+
+// Run reports the views to the queue periodically until stopCh is closed, and once more before
+// returning.
+func (p *Prefetcher) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(p.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			p.flush()
+			return
+		case <-ticker.C:
+			p.flush()
+		}
+	}
+}
+
+// take removes the first Box that can still be handed out to the viewer from the pool and returns
+// it, or returns nil if there is none. The Boxes the viewer has recently seen are left in the pool
+// for the other viewers unless allowSeen is set. The Boxes that can no longer be handed out are
+// dropped on the way.
+func (p *Prefetcher) take(viewerID string, allowSeen bool) *models.Box {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	now := time.Now()
+	kept := p.pool[:0]
+	var ret *models.Box
+	for i, next := range p.pool {
+		if now.Sub(next.fetchedAt) >= p.maxAge || !available(next.box, now) {
+			continue
+		}
+		if viewerID == "" || allowSeen || !p.seen.Seen(viewerID, next.box.Id) {
+			ret = next.box
+			kept = append(kept, p.pool[i+1:]...)
+			break
+		}
+		kept = append(kept, next)
+	}
+	p.pool = kept
+	return ret
+}
+
+func (p *Prefetcher) low() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return len(p.pool) <= p.size/2
+}
+
+func (p *Prefetcher) drop(id string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for i := range p.pool {
+		if p.pool[i].box.Id == id {
+			p.pool = append(p.pool[:i:i], p.pool[i+1:]...)
+			return
+		}
+	}
+}
+
+// refill tops up the pool with a batch from the queue unless another refill has just done so. The
+// queue reserves a view of each Box in the batch, so every Box in the pool is handed out once at
+// most; the Boxes already in the pool are not added again.
+func (p *Prefetcher) refill(ctx context.Context) error {
+	p.refillLock.Lock()
+	defer p.refillLock.Unlock()
+	if !p.low() {
+		return nil
+	}
+	p.lock.Lock()
+	count := p.size - len(p.pool)
+	p.lock.Unlock()
+	resp, err := p.DequeueBatch(ctx, &models.DequeueBatchRequest{Count: count})
+	if err != nil {
+		return err
+	}
+	// the Boxes are loaded all at once and put in the order the queue has handed them out
+	boxes, err := p.boxes.GetMany(ctx, resp.Ids)
+	if err != nil {
+		return errors.Wrap(err, "load prefetched Boxes")
+	}
+	byID := make(map[string]*models.Box, len(boxes))
+	for i := range boxes {
+		byID[boxes[i].Id] = &boxes[i]
+	}
+	now := time.Now()
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	pooled := make(map[string]struct{}, len(p.pool))
+	for _, next := range p.pool {
+		pooled[next.box.Id] = struct{}{}
+	}
+	for _, id := range resp.Ids {
+		if _, ok := pooled[id]; ok {
+			continue
+		}
+		box, ok := byID[id]
+		if !ok || !available(box, now) {
+			// the queue lags behind the database; its resync drops the Box eventually
+			p.logger.V(log.LevelExtended).Info("prefetched Box is no longer available", "id", id)
+			continue
+		}
+		p.pool = append(p.pool, prefetched{box: box, fetchedAt: now})
+	}
+	return nil
+}
+
+// flush reports the pending views to the queue, keeping them for the next flush if it fails. Only
+// the views the queue reports as not counted are kept if some were.
+func (p *Prefetcher) flush() {
+	p.lock.Lock()
+	views := p.views
+	p.views = nil
+	p.lock.Unlock()
+	if len(views) == 0 {
+		return
+	}
+	err := p.RecordViews(context.TODO(), &models.RecordViewsRequest{Views: views})
+	if err == nil {
+		return
+	}
+	p.logger.Error(err, "report views", "count", len(views))
+	var viewsErr *ViewsError
+	if errors.As(err, &viewsErr) {
+		views = viewsErr.Failed
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.views = append(views, p.views...)
+	if dropped := len(p.views) - maxPendingViews; dropped > 0 {
+		p.logger.Error(nil, "too many pending views; dropping the oldest", "count", dropped)
+		p.views = p.views[dropped:]
+	}
+}
+
+func available(box *models.Box, now time.Time) bool {
+	return box.Approved() && !box.Expired(now) && !box.Exhausted()
+}
@@ -0,0 +1,176 @@
+package queueclient
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lichuan0620/secret-keeper-backend/internal/queue"
+	"github.com/lichuan0620/secret-keeper-backend/internal/shard"
+	"github.com/lichuan0620/secret-keeper-backend/internal/store"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+	"github.com/pkg/errors"
+)
+
+func TestPrefetcher(t *testing.T) {
+	ctx := context.Background()
+	bs := store.NewMemoryBoxStore()
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := bs.Create(ctx, &models.Box{Id: fmt.Sprint(i), LastViewed: &now}); err != nil {
+			t.Fatalf("create Box: %v", err)
+		}
+	}
+	q := queue.New(bs, nil)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go q.Run(stopCh)
+	for !q.Ready() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	p := NewPrefetcher(NewLocal(q), bs, &PrefetchOptions{Size: 2})
+	const views = 10
+	for i := 0; i < views; i++ {
+		box, err := p.View(ctx, "viewer")
+		if err != nil {
+			t.Fatalf("view: %v", err)
+		}
+		if box.Views == 0 || box.LastViewed == nil || box.LastViewed.Before(now) {
+			t.Fatalf("expecting the view to be counted in the Box; got %+v", box)
+		}
+	}
+	// the views reach the store once they are reported and written by the queue
+	p.flush()
+	total := func() uint {
+		var ret uint
+		if err := bs.Scan(ctx, nil, func(box *models.Box) error {
+			ret += box.Views
+			return nil
+		}); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		return ret
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for total() != views && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if recorded := total(); recorded != views {
+		t.Fatalf("expecting %d views recorded; got %d", views, recorded)
+	}
+
+	empty := NewPrefetcher(NewLocal(queue.New(store.NewMemoryBoxStore(), nil)), bs, nil)
+	if _, err := empty.View(ctx, ""); err != ErrNoData {
+		t.Fatalf("expecting ErrNoData from an empty queue; got %v", err)
+	}
+}
+
+func TestPrefetcherMaxViews(t *testing.T) {
+	ctx := context.Background()
+	bs := store.NewMemoryBoxStore()
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		box := &models.Box{Id: fmt.Sprint(i), LastViewed: &now}
+		if i == 0 {
+			box.MaxViews = 1
+		}
+		if err := bs.Create(ctx, box); err != nil {
+			t.Fatalf("create Box: %v", err)
+		}
+	}
+	q := queue.New(bs, nil)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go q.Run(stopCh)
+	for !q.Ready() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the Box is handed out no more times than it may be viewed, although the store only
+	// learns about the views once they are reported and written
+	p := NewPrefetcher(NewLocal(q), bs, &PrefetchOptions{Size: 2})
+	served := 0
+	for i := 0; i < 20; i++ {
+		box, err := p.View(ctx, "")
+		if err != nil {
+			t.Fatalf("view: %v", err)
+		}
+		if box.Id == "0" {
+			served++
+		}
+	}
+	if served != 1 {
+		t.Fatalf("expecting the Box to be served once; got %d", served)
+	}
+}
+
+func TestPrefetcherSkipsSeen(t *testing.T) {
+	ctx := context.Background()
+	bs := store.NewMemoryBoxStore()
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if err := bs.Create(ctx, &models.Box{Id: fmt.Sprint(i), LastViewed: &now}); err != nil {
+			t.Fatalf("create Box: %v", err)
+		}
+	}
+	q := queue.New(bs, nil)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go q.Run(stopCh)
+	for !q.Ready() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	p := NewPrefetcher(NewLocal(q), bs, &PrefetchOptions{Size: 4})
+	boxes, err := bs.GetMany(ctx, []string{"0", "1"})
+	if err != nil || len(boxes) != 2 {
+		t.Fatalf("get Boxes: %v", err)
+	}
+	for i := range boxes {
+		p.pool = append(p.pool, prefetched{box: &boxes[i], fetchedAt: now})
+	}
+	p.seen.Add("a", "0")
+	for _, tc := range []struct {
+		Viewer string
+		Expect string
+	}{
+		// the Box seen by a is left for b
+		{Viewer: "a", Expect: "1"},
+		{Viewer: "b", Expect: "0"},
+	} {
+		box, err := p.View(ctx, tc.Viewer)
+		if err != nil || box.Id != tc.Expect {
+			t.Fatalf("%s: expecting Box %s; got %v, %v", tc.Viewer, tc.Expect, box, err)
+		}
+	}
+	// a has seen every Box; repeating is better than showing nothing
+	if _, err = p.View(ctx, "a"); err != nil {
+		t.Fatalf("expecting a Box seen before; got %v", err)
+	}
+}
+
+func TestPrefetcherFlush(t *testing.T) {
+	shards := []*fakeShard{{err: errors.New("unavailable")}, {}}
+	p := NewPrefetcher(NewSharded([]Interface{shards[0], shards[1]}), store.NewMemoryBoxStore(), nil)
+	ring := shard.NewRing(len(shards))
+	failed := 0
+	for i := 0; i < 10; i++ {
+		id := fmt.Sprint(i)
+		p.views = append(p.views, models.View{Id: id})
+		if ring.Owner(id) == 0 {
+			failed++
+		}
+	}
+	// the views counted by the healthy shard are not reported again
+	p.flush()
+	if len(p.views) != failed || len(shards[1].viewed) != 10-failed {
+		t.Fatalf("expecting %d views kept; got %d", failed, len(p.views))
+	}
+	for _, v := range p.views {
+		if ring.Owner(v.Id) != 0 {
+			t.Fatalf("expecting only the views of the failing shard to be kept; got %s", v.Id)
+		}
+	}
+}
@@ -1,97 +1,238 @@
 package queueclient
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"fmt"
-	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
-	"github.com/lichuan0620/secret-keeper-backend/pkg/service/model"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/standard"
 	"github.com/lichuan0620/secret-keeper-backend/pkg/telemetry/log"
 	"github.com/pkg/errors"
 )
 
+var (
+	// ErrNoData is returned by Dequeue when the queue is empty.
+	ErrNoData = errors.New("no data")
+	// ErrNotLeader is returned by Dequeue when the queue replica is not the leader.
+	ErrNotLeader = errors.New("not the leader")
+	// ErrCircuitOpen is returned without calling the queue when it has kept failing recently.
+	ErrCircuitOpen = errors.New("circuit open")
+)
+
+// ViewsError is returned by RecordViews when some of the views were not counted.
+type ViewsError struct {
+	// Failed are the views not counted.
+	Failed []models.View
+	Err    error
+}
+
+func (e *ViewsError) Error() string {
+	return errors.Wrapf(e.Err, "%d views not recorded", len(e.Failed)).Error()
+}
+
+func (e *ViewsError) Unwrap() error {
+	return e.Err
+}
+
+// maxBackoff caps the delay between retries.
+const maxBackoff = 2 * time.Second
+
 type Interface interface {
 	Sync(ctx context.Context, box *models.SyncRequest) error
-	Dequeue(ctx context.Context) (*models.DequeueResponse, error)
+	Dequeue(ctx context.Context, req *models.DequeueRequest) (*models.DequeueResponse, error)
+	// DequeueBatch reserves a number of Boxes, the views of which are reported with RecordViews.
+	DequeueBatch(ctx context.Context, req *models.DequeueBatchRequest) (*models.DequeueBatchResponse, error)
+	// RecordViews counts the views of Boxes taken with DequeueBatch. A *ViewsError tells which
+	// views were not counted when the others were; only those may be reported again.
+	RecordViews(ctx context.Context, req *models.RecordViewsRequest) error
+	Remove(ctx context.Context, req *models.RemoveRequest) error
+	// Health returns nil if the queue hands out Boxes.
+	Health(ctx context.Context) error
+}
+
+// Options configure a client of the queue service; the zero value is valid.
+type Options struct {
+	// Timeout bounds every attempt of a call; it defaults to 3 seconds.
+	Timeout time.Duration
+	// Retries is the number of times an idempotent call, Sync or Remove, is retried after the
+	// queue has failed it; it defaults to 2, and a negative value disables the retries.
+	Retries int
+	// Backoff is the delay before the first retry, which doubles for every following one, with
+	// a random jitter; it defaults to 100 milliseconds.
+	Backoff time.Duration
+	// BreakerThreshold is the number of consecutive failures after which the calls fail right away
+	// with ErrCircuitOpen; it defaults to 5, and a negative value disables the circuit breaker.
+	BreakerThreshold int
+	// BreakerTimeout is how long the calls fail right away before one is let through to see if
+	// the queue is back; it defaults to 10 seconds.
+	BreakerTimeout time.Duration
 }
 
+//go:generate go run generator/main.go
+
 type Type struct {
-	endpoint string
-	client   *http.Client
-	logger   logr.Logger
-}
-
-func New(url string) Interface {
-	return &Type{
-		endpoint: url,
-		client: &http.Client{
-			Transport: http.DefaultTransport,
-			Timeout:   3 * time.Second,
-		},
-		logger: log.New().WithName("queueclient"),
-	}
+	actions *Actions
+	retries int
+	backoff time.Duration
+	breaker *breaker
+	logger  logr.Logger
 }
 
-func (t *Type) Sync(ctx context.Context, reqBody *models.SyncRequest) error {
-	body := bytes.NewBuffer(nil)
-	if err := json.NewEncoder(body).Encode(reqBody); err != nil {
-		return errors.Wrap(err, "encode JSON object")
+func New(url string, opts *Options) Interface {
+	if opts == nil {
+		opts = &Options{}
 	}
-	url := t.buildURL("Sync", models.Version)
-	req, err := http.NewRequest(http.MethodPost, url, body)
-	if err != nil {
-		return errors.Wrapf(err, "build request %s", url)
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = 3 * time.Second
 	}
-	req.Header.Set(model.HeaderContentType, model.ContentTypeJSON)
-	resp, err := t.client.Do(req.WithContext(ctx))
-	if err != nil {
-		return err
+	ret := &Type{
+		actions: NewActions(service.NewClient(url, &service.ClientOptions{
+			HTTPClient: &http.Client{
+				Transport: http.DefaultTransport,
+				Timeout:   timeout,
+			},
+		})),
+		retries: opts.Retries,
+		backoff: opts.Backoff,
+		breaker: &breaker{threshold: opts.BreakerThreshold, openTimeout: opts.BreakerTimeout},
+		logger:  log.New().WithName("queueclient"),
+	}
+	if ret.retries == 0 {
+		ret.retries = 2
+	}
+	if ret.backoff <= 0 {
+		ret.backoff = 100 * time.Millisecond
 	}
-	defer func() {
-		_ = resp.Body.Close()
-	}()
-	if resp.StatusCode != http.StatusOK {
-		return errors.Errorf("request %s returns non-OK response status code %d", url, resp.StatusCode)
+	if ret.breaker.threshold == 0 {
+		ret.breaker.threshold = 5
 	}
-	return nil
+	if ret.breaker.openTimeout <= 0 {
+		ret.breaker.openTimeout = 10 * time.Second
+	}
+	return ret
+}
+
+func (t *Type) Sync(ctx context.Context, req *models.SyncRequest) error {
+	return t.do(ctx, "Sync", true, func(ctx context.Context) error {
+		_, err := t.actions.Sync(ctx, req)
+		return err
+	})
+}
+
+func (t *Type) Remove(ctx context.Context, req *models.RemoveRequest) error {
+	return t.do(ctx, "Remove", true, func(ctx context.Context) error {
+		_, err := t.actions.Remove(ctx, req)
+		return err
+	})
+}
+
+func (t *Type) Dequeue(ctx context.Context, req *models.DequeueRequest) (*models.DequeueResponse, error) {
+	var ret *models.DequeueResponse
+	err := t.do(ctx, "Dequeue", false, func(ctx context.Context) (err error) {
+		ret, err = t.actions.Dequeue(ctx, req.ViewerId, req.Strategy)
+		return err
+	})
+	return ret, err
+}
+
+func (t *Type) DequeueBatch(ctx context.Context, req *models.DequeueBatchRequest) (*models.DequeueBatchResponse, error) {
+	var ret *models.DequeueBatchResponse
+	err := t.do(ctx, "DequeueBatch", false, func(ctx context.Context) (err error) {
+		ret, err = t.actions.DequeueBatch(ctx, req)
+		return err
+	})
+	return ret, err
+}
+
+func (t *Type) RecordViews(ctx context.Context, req *models.RecordViewsRequest) error {
+	return t.do(ctx, "RecordViews", false, func(ctx context.Context) error {
+		_, err := t.actions.RecordViews(ctx, req)
+		return err
+	})
 }
 
-func (t *Type) Dequeue(ctx context.Context) (*models.DequeueResponse, error) {
-	url := t.buildURL("Dequeue", models.Version)
-	req, err := http.NewRequest(http.MethodPost, url, nil)
-	if err != nil {
-		return nil, errors.Wrapf(err, "build request %s", url)
+func (t *Type) Health(ctx context.Context) error {
+	return t.do(ctx, "Health", false, func(ctx context.Context) error {
+		_, err := t.actions.Health(ctx)
+		return err
+	})
+}
+
+// do makes a call to the queue through the circuit breaker. An idempotent call is retried with
+// backoff as long as the queue fails it.
+func (t *Type) do(ctx context.Context, action string, idempotent bool, call func(context.Context) error) error {
+	attempts := 1
+	if idempotent && t.retries > 0 {
+		attempts += t.retries
 	}
-	req.Header.Set(model.HeaderContentType, model.ContentTypeJSON)
-	resp, err := t.client.Do(req.WithContext(ctx))
-	if err != nil {
-		return nil, err
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(t.delay(i)):
+			}
+		}
+		if !t.breaker.allow() {
+			return ErrCircuitOpen
+		}
+		err = convertError(call(ctx))
+		if ctx.Err() != nil {
+			// a call given up by the caller says nothing about the queue
+			t.breaker.release()
+			return err
+		}
+		failed := unavailable(err)
+		t.breaker.done(failed)
+		if !failed {
+			return err
+		}
+		t.logger.V(log.LevelExtended).Info("queue call failed", "action", action, "attempt", i+1, "error", err.Error())
 	}
-	defer func() {
-		_ = resp.Body.Close()
-	}()
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.Errorf("request %s returns non-OK response status code %d", url, resp.StatusCode)
+	return err
+}
+
+// delay returns the backoff before the given retry: the base delay doubled for every previous
+// retry, of which a random half is taken off so that clients do not retry in lockstep.
+func (t *Type) delay(retry int) time.Duration {
+	d := t.backoff << (retry - 1)
+	if d > maxBackoff || d <= 0 {
+		d = maxBackoff
 	}
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, errors.Wrap(err, "read response body")
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// convertError turns the standard errors the queue service answers with into the errors of this
+// package.
+func convertError(err error) error {
+	var callErr *service.CallError
+	if !errors.As(err, &callErr) {
+		return err
 	}
-	respBody := struct {
-		Result models.DequeueResponse `json:"Result"`
-	}{}
-	if err = json.Unmarshal(body, &respBody); err != nil {
-		return nil, errors.Wrap(err, "decode JSON object")
+	switch callErr.Err.GetCode() {
+	case standard.ResourceNotFound("").GetCode():
+		return ErrNoData
+	case standard.ServiceUnavailable().GetCode():
+		return ErrNotLeader
 	}
-	return &respBody.Result, nil
+	return err
 }
 
-func (t *Type) buildURL(action, version string) string {
-	return fmt.Sprintf("%s?Action=%s&Version=%s", t.endpoint, action, version)
+// unavailable tells if an error shows that the queue is failing, rather than the queue rejecting
+// a call, in which case the call is worth retrying.
+func unavailable(err error) bool {
+	if err == nil || err == ErrNoData || err == ErrNotLeader {
+		return false
+	}
+	var callErr *service.CallError
+	if errors.As(err, &callErr) {
+		return callErr.Err.GetHTTPCode() >= http.StatusInternalServerError
+	}
+	return true
 }
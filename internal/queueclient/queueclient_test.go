@@ -0,0 +1,152 @@
+package queueclient
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	queueservice "github.com/lichuan0620/secret-keeper-backend/cmd/queue/service"
+	"github.com/lichuan0620/secret-keeper-backend/internal/queue"
+	"github.com/lichuan0620/secret-keeper-backend/internal/store"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/clientgen"
+)
+
+func TestGenerated(t *testing.T) {
+	source, err := clientgen.Generate(queueservice.NewBuilder(nil).Actions(), &clientgen.Options{
+		Package:   "queueclient",
+		TypeName:  "Actions",
+		Generator: "queueclient generator",
+	})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if generated, _ := ioutil.ReadFile("generated.actions.go"); !bytes.Equal(generated, source) {
+		t.Fatal("generated.actions.go is out of date; run go generate")
+	}
+}
+
+func TestType(t *testing.T) {
+	ctx := context.Background()
+	q := queue.New(store.NewMemoryBoxStore(), nil)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go q.Run(stopCh)
+	for !q.Ready() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	handler, err := queueservice.Build(q)
+	if err != nil {
+		t.Fatalf("build queue service: %v", err)
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	c := New(server.URL, nil)
+	if err = c.Health(ctx); err != nil {
+		t.Fatalf("health: %v", err)
+	}
+	if _, err = c.Dequeue(ctx, &models.DequeueRequest{}); err != ErrNoData {
+		t.Fatalf("expecting ErrNoData from an empty queue; got %v", err)
+	}
+	if err = c.Sync(ctx, &models.SyncRequest{Id: "a"}); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if resp, err := c.Dequeue(ctx, &models.DequeueRequest{ViewerId: "viewer"}); err != nil || resp.Id != "a" {
+		t.Fatalf("expecting a; got %v, %v", resp, err)
+	}
+	if resp, err := c.DequeueBatch(ctx, &models.DequeueBatchRequest{Count: 2}); err != nil || len(resp.Ids) != 1 {
+		t.Fatalf("expecting a batch of 1; got %v, %v", resp, err)
+	}
+	if _, err = c.DequeueBatch(ctx, &models.DequeueBatchRequest{}); err == nil || unavailable(err) {
+		t.Fatalf("expecting the invalid batch to be rejected; got %v", err)
+	}
+}
+
+// flakyServer fails the first failures requests with status 500, and succeeds afterwards.
+func flakyServer(failures int32) (*httptest.Server, *int32) {
+	var requests int32
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= failures {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(`{"Result":{"Id":"a"}}`))
+	})), &requests
+}
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	server, requests := flakyServer(2)
+	defer server.Close()
+	c := New(server.URL, &Options{Backoff: time.Millisecond})
+	if err := c.Sync(ctx, &models.SyncRequest{Id: "a"}); err != nil {
+		t.Fatalf("expecting Sync to succeed after retries; got %v", err)
+	}
+	if n := atomic.LoadInt32(requests); n != 3 {
+		t.Fatalf("expecting 3 requests; got %d", n)
+	}
+
+	// Dequeue is not idempotent
+	server, requests = flakyServer(1)
+	defer server.Close()
+	c = New(server.URL, &Options{Backoff: time.Millisecond})
+	if _, err := c.Dequeue(ctx, &models.DequeueRequest{}); err == nil {
+		t.Fatal("expecting Dequeue to fail")
+	}
+	if n := atomic.LoadInt32(requests); n != 1 {
+		t.Fatalf("expecting 1 request; got %d", n)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	ctx := context.Background()
+	server, requests := flakyServer(2)
+	defer server.Close()
+	c := New(server.URL, &Options{Retries: -1, BreakerThreshold: 2, BreakerTimeout: 100 * time.Millisecond})
+	for i := 0; i < 2; i++ {
+		if err := c.Remove(ctx, &models.RemoveRequest{Id: "a"}); err == nil || err == ErrCircuitOpen {
+			t.Fatalf("expecting the error of the queue; got %v", err)
+		}
+	}
+	if err := c.Remove(ctx, &models.RemoveRequest{Id: "a"}); err != ErrCircuitOpen {
+		t.Fatalf("expecting ErrCircuitOpen; got %v", err)
+	}
+	if n := atomic.LoadInt32(requests); n != 2 {
+		t.Fatalf("expecting no request while the circuit is open; got %d", n)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if err := c.Remove(ctx, &models.RemoveRequest{Id: "a"}); err != nil {
+		t.Fatalf("expecting the trial call to succeed; got %v", err)
+	}
+	if resp, err := c.Dequeue(ctx, &models.DequeueRequest{}); err != nil || resp.Id != "a" {
+		t.Fatalf("expecting the circuit to be closed; got %v, %v", resp, err)
+	}
+}
+
+func TestBreakerRelease(t *testing.T) {
+	b := &breaker{threshold: 2, openTimeout: time.Millisecond}
+	for i := 0; i < 2; i++ {
+		if !b.allow() {
+			t.Fatal("expecting the call to be allowed while the circuit is closed")
+		}
+		b.done(true)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if !b.allow() || b.allow() {
+		t.Fatal("expecting a single trial call")
+	}
+	// a trial call given up by the caller neither closes the circuit nor counts as a failure
+	b.release()
+	if b.openUntil.IsZero() || b.failures != 2 {
+		t.Fatalf("expecting the circuit to stay open after 2 failures; got %d failures", b.failures)
+	}
+	if !b.allow() {
+		t.Fatal("expecting another trial call")
+	}
+}
@@ -0,0 +1,109 @@
+package queueclient
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+)
+
+type replicated struct {
+	replicas []Interface
+	// leader is the index of the replica that has last handed out a Box
+	leader int32
+}
+
+// NewReplicated returns an Interface that talks to the replicas of a queue, only one of which, the
+// leader, hands out Boxes. Sync and Remove go to every replica so that the standbys are up to date,
+// while Dequeue looks for the leader, starting with the last known one.
+func NewReplicated(replicas []Interface) Interface {
+	return &replicated{replicas: replicas}
+}
+
+func (r *replicated) Sync(ctx context.Context, req *models.SyncRequest) error {
+	return r.broadcast(func(c Interface) error {
+		return c.Sync(ctx, req)
+	})
+}
+
+func (r *replicated) Remove(ctx context.Context, req *models.RemoveRequest) error {
+	return r.broadcast(func(c Interface) error {
+		return c.Remove(ctx, req)
+	})
+}
+
+// broadcast calls every replica at once, and succeeds if any of them does; the others catch up
+// with their resyncs.
+func (r *replicated) broadcast(call func(Interface) error) error {
+	errs := make([]error, len(r.replicas))
+	var wg sync.WaitGroup
+	for i, c := range r.replicas {
+		wg.Add(1)
+		go func(i int, c Interface) {
+			defer wg.Done()
+			errs[i] = call(c)
+		}(i, c)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err == nil {
+			return nil
+		}
+	}
+	return errs[0]
+}
+
+func (r *replicated) Dequeue(ctx context.Context, req *models.DequeueRequest) (*models.DequeueResponse, error) {
+	var resp *models.DequeueResponse
+	err := r.onLeader(ctx, func(c Interface) (err error) {
+		resp, err = c.Dequeue(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+func (r *replicated) DequeueBatch(ctx context.Context, req *models.DequeueBatchRequest) (*models.DequeueBatchResponse, error) {
+	var resp *models.DequeueBatchResponse
+	err := r.onLeader(ctx, func(c Interface) (err error) {
+		resp, err = c.DequeueBatch(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+// RecordViews only reports the views to the leader, which records them in the store, so that they
+// are not counted more than once; the standbys pick them up with their resyncs.
+func (r *replicated) RecordViews(ctx context.Context, req *models.RecordViewsRequest) error {
+	return r.onLeader(ctx, func(c Interface) error {
+		return c.RecordViews(ctx, req)
+	})
+}
+
+// Health succeeds if the leader is healthy.
+func (r *replicated) Health(ctx context.Context) error {
+	return r.onLeader(ctx, func(c Interface) error {
+		return c.Health(ctx)
+	})
+}
+
+// onLeader makes the call to the leader, looking for it from the last known one.
+func (r *replicated) onLeader(ctx context.Context, call func(Interface) error) error {
+	start := int(atomic.LoadInt32(&r.leader))
+	err := ErrNotLeader
+	for k := range r.replicas {
+		i := (start + k) % len(r.replicas)
+		switch replicaErr := call(r.replicas[i]); replicaErr {
+		case nil, ErrNoData:
+			atomic.StoreInt32(&r.leader, int32(i))
+			return replicaErr
+		case ErrNotLeader:
+		default:
+			err = replicaErr
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return err
+}
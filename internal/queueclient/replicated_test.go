@@ -0,0 +1,44 @@
+package queueclient
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+	"github.com/pkg/errors"
+)
+
+func TestReplicated(t *testing.T) {
+	ctx := context.Background()
+	replicas := []*fakeShard{{follower: true}, {err: errors.New("unavailable")}, {}}
+	c := NewReplicated([]Interface{replicas[0], replicas[1], replicas[2]})
+	if err := c.Sync(ctx, &models.SyncRequest{Id: "a"}); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if len(replicas[0].synced) != 1 || len(replicas[2].synced) != 1 {
+		t.Fatal("expecting every available replica to be synced")
+	}
+	if resp, err := c.Dequeue(ctx, &models.DequeueRequest{}); err != nil || resp.Id != "a" {
+		t.Fatalf("expecting a from the leader; got %v, %v", resp, err)
+	}
+
+	if err := c.RecordViews(ctx, &models.RecordViewsRequest{Views: []models.View{{Id: "a"}}}); err != nil {
+		t.Fatalf("record views: %v", err)
+	}
+	if len(replicas[0].viewed) != 0 || len(replicas[2].viewed) != 1 {
+		t.Fatal("expecting the views to be reported to the leader only")
+	}
+
+	// a new leader is found after a failover
+	replicas[0].follower, replicas[2].follower = false, true
+	if resp, err := c.Dequeue(ctx, &models.DequeueRequest{}); err != nil || resp.Id != "a" {
+		t.Fatalf("expecting a from the new leader; got %v, %v", resp, err)
+	}
+	replicas[0].follower = true
+	if _, err := c.Dequeue(ctx, &models.DequeueRequest{}); err == nil || err == ErrNoData {
+		t.Fatalf("expecting an error without a leader; got %v", err)
+	}
+	if err := c.Health(ctx); err == nil {
+		t.Fatal("expecting the queue to be unhealthy without a leader")
+	}
+}
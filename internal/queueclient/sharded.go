@@ -0,0 +1,157 @@
+package queueclient
+
+import (
+	"context"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/lichuan0620/secret-keeper-backend/internal/shard"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/telemetry/log"
+	"github.com/pkg/errors"
+)
+
+// unhealthyCooldown is how long a shard that has failed is tried last.
+const unhealthyCooldown = 10 * time.Second
+
+type sharded struct {
+	ring   *shard.Ring
+	shards []*shardClient
+	logger logr.Logger
+}
+
+type shardClient struct {
+	Interface
+	// unhealthyUntil is the time in UnixNano until which the shard is considered unhealthy
+	unhealthyUntil int64
+}
+
+// NewSharded returns an Interface that talks to a sharded queue, given the clients of the shards
+// in the order of their shard indexes. Sync and Remove go to the shard owning the Box, while
+// Dequeue tries the healthy shards in random order until one of them hands out a Box.
+func NewSharded(shards []Interface) Interface {
+	ret := &sharded{
+		ring:   shard.NewRing(len(shards)),
+		shards: make([]*shardClient, len(shards)),
+		logger: log.New().WithName("queueclient"),
+	}
+	for i, c := range shards {
+		ret.shards[i] = &shardClient{Interface: c}
+	}
+	return ret
+}
+
+func (s *sharded) Sync(ctx context.Context, req *models.SyncRequest) error {
+	i := s.ring.Owner(req.Id)
+	return s.observe(i, s.shards[i].Sync(ctx, req))
+}
+
+func (s *sharded) Remove(ctx context.Context, req *models.RemoveRequest) error {
+	i := s.ring.Owner(req.Id)
+	return s.observe(i, s.shards[i].Remove(ctx, req))
+}
+
+func (s *sharded) Dequeue(ctx context.Context, req *models.DequeueRequest) (*models.DequeueResponse, error) {
+	var resp *models.DequeueResponse
+	err := s.any(ctx, func(c Interface) (err error) {
+		resp, err = c.Dequeue(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+// DequeueBatch takes the whole batch from one shard, which is enough as batches are taken often.
+func (s *sharded) DequeueBatch(ctx context.Context, req *models.DequeueBatchRequest) (*models.DequeueBatchResponse, error) {
+	var resp *models.DequeueBatchResponse
+	err := s.any(ctx, func(c Interface) (err error) {
+		resp, err = c.DequeueBatch(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+// RecordViews reports the views to the shards owning the Boxes. If some shards fail, the views
+// of those shards are returned in a *ViewsError.
+func (s *sharded) RecordViews(ctx context.Context, req *models.RecordViewsRequest) error {
+	views := make(map[int][]models.View)
+	for _, v := range req.Views {
+		i := s.ring.Owner(v.Id)
+		views[i] = append(views[i], v)
+	}
+	var err *ViewsError
+	for i, shardViews := range views {
+		shardErr := s.observe(i, s.shards[i].RecordViews(ctx, &models.RecordViewsRequest{Views: shardViews}))
+		if shardErr == nil {
+			continue
+		}
+		if err == nil {
+			err = &ViewsError{Err: shardErr}
+		}
+		var shardViewsErr *ViewsError
+		if errors.As(shardErr, &shardViewsErr) {
+			shardViews = shardViewsErr.Failed
+		}
+		err.Failed = append(err.Failed, shardViews...)
+	}
+	if err == nil {
+		return nil
+	}
+	return err
+}
+
+// Health succeeds if any shard is healthy, in which case Dequeue succeeds too.
+func (s *sharded) Health(ctx context.Context) error {
+	return s.any(ctx, func(c Interface) error {
+		return c.Health(ctx)
+	})
+}
+
+// any tries the shards until the call succeeds with one of them; it returns ErrNoData if every
+// shard is empty.
+func (s *sharded) any(ctx context.Context, call func(Interface) error) error {
+	err := ErrNoData
+	for _, i := range s.order() {
+		shardErr := s.observe(i, call(s.shards[i]))
+		if shardErr == nil {
+			return nil
+		}
+		if shardErr != ErrNoData {
+			err = shardErr
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return err
+}
+
+// order returns the shard indexes to try, with the healthy shards in random order first.
+func (s *sharded) order() []int {
+	now := time.Now().UnixNano()
+	healthy := make([]int, 0, len(s.shards))
+	var unhealthy []int
+	for _, i := range rand.Perm(len(s.shards)) {
+		if atomic.LoadInt64(&s.shards[i].unhealthyUntil) > now {
+			unhealthy = append(unhealthy, i)
+		} else {
+			healthy = append(healthy, i)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+// observe updates the health of a shard from the result of a call and returns the error of the
+// call. An empty shard is healthy.
+func (s *sharded) observe(i int, err error) error {
+	c := s.shards[i]
+	if err == nil || err == ErrNoData {
+		atomic.StoreInt64(&c.unhealthyUntil, 0)
+		return err
+	}
+	if atomic.SwapInt64(&c.unhealthyUntil, time.Now().Add(unhealthyCooldown).UnixNano()) == 0 {
+		s.logger.Error(err, "queue shard is unhealthy", "shard", i)
+	}
+	return errors.Wrapf(err, "queue shard %d", i)
+}
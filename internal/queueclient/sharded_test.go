@@ -0,0 +1,152 @@
+package queueclient
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/lichuan0620/secret-keeper-backend/internal/shard"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+	"github.com/pkg/errors"
+)
+
+// fakeShard records the Boxes synced to it and hands out the first ones unless it is a follower.
+type fakeShard struct {
+	synced   []string
+	viewed   []string
+	err      error
+	follower bool
+}
+
+func (f *fakeShard) Sync(_ context.Context, req *models.SyncRequest) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.synced = append(f.synced, req.Id)
+	return nil
+}
+
+func (f *fakeShard) Dequeue(context.Context, *models.DequeueRequest) (*models.DequeueResponse, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if f.follower {
+		return nil, ErrNotLeader
+	}
+	if len(f.synced) == 0 {
+		return nil, ErrNoData
+	}
+	return &models.DequeueResponse{Id: f.synced[0]}, nil
+}
+
+func (f *fakeShard) DequeueBatch(_ context.Context, req *models.DequeueBatchRequest) (*models.DequeueBatchResponse, error) {
+	if _, err := f.Dequeue(context.TODO(), &models.DequeueRequest{}); err != nil {
+		return nil, err
+	}
+	ids := f.synced
+	if len(ids) > req.Count {
+		ids = ids[:req.Count]
+	}
+	return &models.DequeueBatchResponse{Ids: ids}, nil
+}
+
+func (f *fakeShard) RecordViews(_ context.Context, req *models.RecordViewsRequest) error {
+	if f.err != nil {
+		return f.err
+	}
+	if f.follower {
+		return ErrNotLeader
+	}
+	for _, v := range req.Views {
+		f.viewed = append(f.viewed, v.Id)
+	}
+	return nil
+}
+
+func (f *fakeShard) Remove(context.Context, *models.RemoveRequest) error {
+	return f.err
+}
+
+func (f *fakeShard) Health(context.Context) error {
+	if f.err == nil && f.follower {
+		return ErrNotLeader
+	}
+	return f.err
+}
+
+func TestSharded(t *testing.T) {
+	ctx := context.Background()
+	shards := []*fakeShard{{}, {}, {}}
+	c := NewSharded([]Interface{shards[0], shards[1], shards[2]})
+	ring := shard.NewRing(len(shards))
+	for i := 0; i < 30; i++ {
+		if err := c.Sync(ctx, &models.SyncRequest{Id: fmt.Sprint(i)}); err != nil {
+			t.Fatalf("sync: %v", err)
+		}
+	}
+	for i, s := range shards {
+		for _, id := range s.synced {
+			if ring.Owner(id) != i {
+				t.Fatalf("%s of shard %d was synced to shard %d", id, ring.Owner(id), i)
+			}
+		}
+	}
+
+	// views go to the shards owning the Boxes
+	var views []models.View
+	for i := 0; i < 30; i++ {
+		views = append(views, models.View{Id: fmt.Sprint(i)})
+	}
+	if err := c.RecordViews(ctx, &models.RecordViewsRequest{Views: views}); err != nil {
+		t.Fatalf("record views: %v", err)
+	}
+	for i, s := range shards {
+		if len(s.viewed) != len(s.synced) {
+			t.Fatalf("expecting %d views on shard %d; got %d", len(s.synced), i, len(s.viewed))
+		}
+	}
+
+	// a failing shard is skipped, and so is an empty one
+	shards[0].err = errors.New("unavailable")
+	// only the views of the failing shard are to be reported again
+	for _, s := range shards {
+		s.viewed = nil
+	}
+	err := c.RecordViews(ctx, &models.RecordViewsRequest{Views: views})
+	var viewsErr *ViewsError
+	if !errors.As(err, &viewsErr) || len(viewsErr.Failed) != len(shards[0].synced) {
+		t.Fatalf("expecting the %d views of shard 0 to fail; got %v", len(shards[0].synced), err)
+	}
+	for _, v := range viewsErr.Failed {
+		if ring.Owner(v.Id) != 0 {
+			t.Fatalf("expecting only views of shard 0 to fail; got %s of shard %d", v.Id, ring.Owner(v.Id))
+		}
+	}
+	if len(shards[1].viewed)+len(shards[2].viewed)+len(viewsErr.Failed) != len(views) {
+		t.Fatal("expecting the views of the other shards to be reported")
+	}
+	shards[1].synced = nil
+	for i := 0; i < 10; i++ {
+		resp, err := c.Dequeue(ctx, &models.DequeueRequest{})
+		if err != nil {
+			t.Fatalf("dequeue: %v", err)
+		}
+		if ring.Owner(resp.Id) != 2 {
+			t.Fatalf("expecting a Box of shard 2; got %s of shard %d", resp.Id, ring.Owner(resp.Id))
+		}
+	}
+	if err := c.Sync(ctx, &models.SyncRequest{Id: shards[2].synced[0]}); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	shards[2].synced = nil
+	if _, err := c.Dequeue(ctx, &models.DequeueRequest{}); err == nil || err == ErrNoData {
+		t.Fatalf("expecting the error of the failing shard; got %v", err)
+	}
+	if err := c.Health(ctx); err != nil {
+		t.Fatalf("expecting the queue to be healthy with a healthy shard; got %v", err)
+	}
+	shards[0].err, shards[0].synced = nil, nil
+	if _, err := c.Dequeue(ctx, &models.DequeueRequest{}); err != ErrNoData {
+		t.Fatalf("expecting ErrNoData; got %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+// Package shard splits the Boxes between the queue shards.
+//
+// Every Box ID hashes to one of a fixed number of slots, which is stored with the Box so that a
+// shard can query its own Boxes. The slots are assigned to the shards by consistent hashing, so
+// that adding or removing a shard only moves the slots of that shard.
+package shard
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+const (
+	// Slots is the number of slots the Box IDs hash to. It must never change, since the slot is
+	// persisted with every Box.
+	Slots = 1024
+	// replicas is the number of points each shard has on the ring, which evens out the number of
+	// slots each shard gets.
+	replicas = 128
+)
+
+// Slot returns the slot of a Box ID.
+func Slot(id string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(id))
+	return int(h.Sum32() % Slots)
+}
+
+// Ring assigns the slots to a number of shards by consistent hashing.
+type Ring struct {
+	shards int
+	owners [Slots]int
+}
+
+// NewRing returns a Ring of the given number of shards, which must be positive.
+func NewRing(shards int) *Ring {
+	if shards < 1 {
+		panic("shard: a ring needs at least one shard")
+	}
+	type point struct {
+		hash  uint64
+		shard int
+	}
+	points := make([]point, 0, shards*replicas)
+	for i := 0; i < shards; i++ {
+		for j := 0; j < replicas; j++ {
+			points = append(points, point{hash: hash("shard-" + strconv.Itoa(i) + "-" + strconv.Itoa(j)), shard: i})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].hash < points[j].hash
+	})
+	ret := Ring{shards: shards}
+	for slot := range ret.owners {
+		h := hash("slot-" + strconv.Itoa(slot))
+		i := sort.Search(len(points), func(i int) bool {
+			return points[i].hash >= h
+		})
+		if i == len(points) {
+			i = 0
+		}
+		ret.owners[slot] = points[i].shard
+	}
+	return &ret
+}
+
+// Shards returns the number of shards.
+func (r *Ring) Shards() int {
+	return r.shards
+}
+
+// Owner returns the shard owning a Box ID.
+func (r *Ring) Owner(id string) int {
+	return r.owners[Slot(id)]
+}
+
+// Slots returns the slots owned by a shard in ascending order.
+func (r *Ring) Slots(shard int) []int {
+	var ret []int
+	for slot, owner := range r.owners {
+		if owner == shard {
+			ret = append(ret, slot)
+		}
+	}
+	return ret
+}
+
+// Partition is the part of the Boxes owned by a shard.
+type Partition struct {
+	Ring  *Ring
+	Shard int
+}
+
+// Owns tells if the Box ID belongs to the Partition. A nil Partition owns every Box.
+func (p *Partition) Owns(id string) bool {
+	return p == nil || p.Ring.Owner(id) == p.Shard
+}
+
+// Slots returns the slots of the Partition, or nil for a nil Partition, which owns every slot.
+func (p *Partition) Slots() []int {
+	if p == nil {
+		return nil
+	}
+	return p.Ring.Slots(p.Shard)
+}
+
+func hash(key string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	// fnv alone spreads similar keys poorly; finish with the mixer of splitmix64
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,69 @@
+package shard
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRing(t *testing.T) {
+	for _, shards := range []int{1, 3, 8} {
+		r := NewRing(shards)
+		counts := make([]int, shards)
+		var total int
+		for i := 0; i < shards; i++ {
+			slots := r.Slots(i)
+			counts[i] = len(slots)
+			total += len(slots)
+			for _, slot := range slots {
+				if r.owners[slot] != i {
+					t.Fatalf("slot %d is listed for shard %d but owned by %d", slot, i, r.owners[slot])
+				}
+			}
+		}
+		if total != Slots {
+			t.Fatalf("expecting %d slots in total; got %d", Slots, total)
+		}
+		for i, count := range counts {
+			if expected := Slots / shards; count < expected/2 || count > expected*2 {
+				t.Fatalf("shard %d of %d owns %d slots; expecting about %d", i, shards, count, expected)
+			}
+		}
+	}
+}
+
+func TestRingResize(t *testing.T) {
+	// growing from 4 to 5 shards only moves slots to the new shard
+	before, after := NewRing(4), NewRing(5)
+	var moved int
+	for slot := 0; slot < Slots; slot++ {
+		if before.owners[slot] != after.owners[slot] {
+			if after.owners[slot] != 4 {
+				t.Fatalf("slot %d moved from shard %d to %d", slot, before.owners[slot], after.owners[slot])
+			}
+			moved++
+		}
+	}
+	if moved == 0 || moved > Slots/2 {
+		t.Fatalf("unexpected number of moved slots %d", moved)
+	}
+}
+
+func TestPartition(t *testing.T) {
+	var all *Partition
+	if !all.Owns("a") || all.Slots() != nil {
+		t.Fatal("expecting a nil Partition to own everything")
+	}
+	r := NewRing(3)
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprint(i)
+		var owners int
+		for shard := 0; shard < 3; shard++ {
+			if (&Partition{Ring: r, Shard: shard}).Owns(id) {
+				owners++
+			}
+		}
+		if owners != 1 {
+			t.Fatalf("expecting %s to be owned by one shard; got %d", id, owners)
+		}
+	}
+}
@@ -0,0 +1,691 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lichuan0620/secret-keeper-backend/internal/shard"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+	"github.com/pkg/errors"
+)
+
+type memoryBoxStore struct {
+	boxes map[string]*models.Box
+	// tombstones holds the deletion time of the deleted Boxes; unlike with MongoDB they do not expire
+	tombstones map[string]time.Time
+	// changes holds the latest changes for Watch; the last one has the sequence number changeSeq
+	changes   []BoxChange
+	changeSeq uint64
+	// changed is closed and replaced whenever a change is made
+	changed chan struct{}
+	lock    sync.RWMutex
+}
+
+// maxChanges is the number of changes kept for the watchers of a memory BoxStore.
+const maxChanges = 1024
+
+// NewMemoryBoxStore returns a BoxStore that keeps everything in memory. It is meant for tests
+// and local development; nothing is persisted.
+func NewMemoryBoxStore() BoxStore {
+	return &memoryBoxStore{
+		boxes:      make(map[string]*models.Box),
+		tombstones: make(map[string]time.Time),
+		changed:    make(chan struct{}),
+	}
+}
+
+func (s *memoryBoxStore) Create(_ context.Context, box *models.Box) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, exists := s.boxes[box.Id]; exists {
+		return errors.Errorf("duplicated Box %s", box.Id)
+	}
+	if box.ModifiedAt == nil {
+		now := time.Now()
+		box.ModifiedAt = &now
+	}
+	if box.Partition == nil {
+		slot := shard.Slot(box.Id)
+		box.Partition = &slot
+	}
+	s.boxes[box.Id] = copyBox(box)
+	delete(s.tombstones, box.Id)
+	s.recordChange(box.Id, box)
+	return nil
+}
+
+func (s *memoryBoxStore) Get(_ context.Context, id string) (*models.Box, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	box, exists := s.boxes[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return copyBox(box), nil
+}
+
+func (s *memoryBoxStore) GetMany(_ context.Context, ids []string) ([]models.Box, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	var ret []models.Box
+	for _, id := range ids {
+		if box, exists := s.boxes[id]; exists {
+			ret = append(ret, *copyBox(box))
+		}
+	}
+	return ret, nil
+}
+
+func (s *memoryBoxStore) AddEmoji(_ context.Context, id string, feedbacks map[string]uint) (*models.Box, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	box, exists := s.boxes[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	if len(feedbacks) > 0 && box.EmojiFeedbacks == nil {
+		box.EmojiFeedbacks = make(map[string]uint, len(feedbacks))
+	}
+	for k, v := range feedbacks {
+		box.EmojiFeedbacks[k] += v
+	}
+	s.touch(box)
+	return copyBox(box), nil
+}
+
+func (s *memoryBoxStore) MarkViewed(_ context.Context, views []BoxViews) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, v := range views {
+		box, exists := s.boxes[v.Id]
+		if !exists {
+			continue
+		}
+		if box.LastViewed == nil || box.LastViewed.Before(v.LastViewed) {
+			lastViewed := v.LastViewed
+			box.LastViewed = &lastViewed
+		}
+		box.Views += v.Count
+		s.touch(box)
+	}
+	return nil
+}
+
+func (s *memoryBoxStore) Update(_ context.Context, id string, update *BoxUpdate) (*models.Box, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	box, exists := s.boxes[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	if update.Body != nil {
+		box.Body = *update.Body
+	}
+	if update.Status != nil {
+		box.Status = *update.Status
+	}
+	if update.ClearReports {
+		box.ReportCount, box.ReportReasons = 0, nil
+	}
+	s.touch(box)
+	return copyBox(box), nil
+}
+
+func (s *memoryBoxStore) IncrementReplyCount(_ context.Context, id string, limit uint) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	box, exists := s.boxes[id]
+	if !exists {
+		return ErrNotFound
+	}
+	if box.ReplyCount >= limit {
+		return ErrLimitExceeded
+	}
+	box.ReplyCount++
+	s.touch(box)
+	return nil
+}
+
+func (s *memoryBoxStore) DecrementReplyCount(_ context.Context, id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	box, exists := s.boxes[id]
+	if !exists {
+		return ErrNotFound
+	}
+	if box.ReplyCount > 0 {
+		box.ReplyCount--
+	}
+	s.touch(box)
+	return nil
+}
+
+func (s *memoryBoxStore) AddReport(_ context.Context, id, reason string) (*models.Box, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	box, exists := s.boxes[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	if box.ReportReasons == nil {
+		box.ReportReasons = make(map[string]uint)
+	}
+	box.ReportCount++
+	box.ReportReasons[reason]++
+	s.touch(box)
+	return copyBox(box), nil
+}
+
+func (s *memoryBoxStore) List(_ context.Context, filter *BoxFilter, offset, limit int) ([]models.Box, error) {
+	s.lock.RLock()
+	var boxes []models.Box
+	for _, box := range s.boxes {
+		if filter.Match(box) {
+			boxes = append(boxes, *copyBox(box))
+		}
+	}
+	s.lock.RUnlock()
+	sort.Slice(boxes, func(i, j int) bool {
+		a, b := boxes[i].CreatedAt, boxes[j].CreatedAt
+		if a == nil || b == nil || a.Equal(*b) {
+			if (a == nil) != (b == nil) {
+				return b == nil
+			}
+			return boxes[i].Id < boxes[j].Id
+		}
+		return a.After(*b)
+	})
+	return paginate(boxes, offset, limit), nil
+}
+
+func (s *memoryBoxStore) ListReported(_ context.Context, minCount uint, offset, limit int) ([]models.Box, error) {
+	if minCount == 0 {
+		minCount = 1
+	}
+	s.lock.RLock()
+	var boxes []models.Box
+	for _, box := range s.boxes {
+		if box.ReportCount >= minCount {
+			boxes = append(boxes, *copyBox(box))
+		}
+	}
+	s.lock.RUnlock()
+	sort.Slice(boxes, func(i, j int) bool {
+		if boxes[i].ReportCount != boxes[j].ReportCount {
+			return boxes[i].ReportCount > boxes[j].ReportCount
+		}
+		return boxes[i].Id < boxes[j].Id
+	})
+	return paginate(boxes, offset, limit), nil
+}
+
+func (s *memoryBoxStore) ListLeastRecentlyViewed(_ context.Context, limit int) ([]models.Box, error) {
+	now := time.Now()
+	s.lock.RLock()
+	var boxes []models.Box
+	for _, box := range s.boxes {
+		if box.Approved() && !box.Expired(now) && !box.Exhausted() {
+			boxes = append(boxes, *copyBox(box))
+		}
+	}
+	s.lock.RUnlock()
+	sort.Slice(boxes, func(i, j int) bool {
+		a, b := boxes[i].LastViewed, boxes[j].LastViewed
+		if a == nil || b == nil {
+			if a != b {
+				return a == nil
+			}
+		} else if !a.Equal(*b) {
+			return a.Before(*b)
+		}
+		return boxes[i].Id < boxes[j].Id
+	})
+	return paginate(boxes, 0, limit), nil
+}
+
+func (s *memoryBoxStore) Delete(_ context.Context, id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, exists := s.boxes[id]; !exists {
+		return ErrNotFound
+	}
+	delete(s.boxes, id)
+	s.tombstones[id] = time.Now()
+	s.recordChange(id, nil)
+	return nil
+}
+
+func (s *memoryBoxStore) Scan(_ context.Context, slots []int, fn func(*models.Box) error) error {
+	inSlots := slotMatcher(slots)
+	s.lock.RLock()
+	buf := make([]*models.Box, 0, len(s.boxes))
+	for _, box := range s.boxes {
+		if inSlots(box.Id) {
+			buf = append(buf, copyBox(box))
+		}
+	}
+	s.lock.RUnlock()
+	for _, box := range buf {
+		if err := fn(box); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memoryBoxStore) ScanModified(_ context.Context, since time.Time, slots []int, fn func(*models.Box) error) error {
+	inSlots := slotMatcher(slots)
+	s.lock.RLock()
+	var buf []*models.Box
+	for _, box := range s.boxes {
+		if box.ModifiedAt != nil && !box.ModifiedAt.Before(since) && inSlots(box.Id) {
+			buf = append(buf, copyBox(box))
+		}
+	}
+	s.lock.RUnlock()
+	sort.Slice(buf, func(i, j int) bool {
+		return buf[i].ModifiedAt.Before(*buf[j].ModifiedAt)
+	})
+	for _, box := range buf {
+		if err := fn(box); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memoryBoxStore) ScanDeleted(_ context.Context, since time.Time, fn func(id string) error) error {
+	s.lock.RLock()
+	var buf []string
+	for id, deletedAt := range s.tombstones {
+		if !deletedAt.Before(since) {
+			buf = append(buf, id)
+		}
+	}
+	s.lock.RUnlock()
+	for _, id := range buf {
+		if err := fn(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memoryBoxStore) Watch(ctx context.Context, token []byte, fn func(*BoxChange) error) error {
+	s.lock.RLock()
+	next := s.changeSeq + 1
+	s.lock.RUnlock()
+	if token != nil {
+		seq, err := strconv.ParseUint(string(token), 10, 64)
+		if err != nil {
+			return errors.Wrap(err, "invalid resume token")
+		}
+		next = seq + 1
+	}
+	for {
+		s.lock.RLock()
+		first := s.changeSeq + 1 - uint64(len(s.changes))
+		if next < first {
+			s.lock.RUnlock()
+			return ErrHistoryLost
+		}
+		var buf []BoxChange
+		if next <= s.changeSeq {
+			buf = append(buf, s.changes[next-first:]...)
+		}
+		changed := s.changed
+		s.lock.RUnlock()
+		for i := range buf {
+			change := buf[i]
+			if change.Box != nil {
+				change.Box = copyBox(change.Box)
+			}
+			if err := fn(&change); err != nil {
+				return err
+			}
+			next++
+		}
+		if len(buf) == 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-changed:
+			}
+		}
+	}
+}
+
+// slotMatcher returns a function telling if a Box ID is in the given slots; every ID is if slots
+// is nil.
+func slotMatcher(slots []int) func(id string) bool {
+	if slots == nil {
+		return func(string) bool {
+			return true
+		}
+	}
+	set := make(map[int]struct{}, len(slots))
+	for _, slot := range slots {
+		set[slot] = struct{}{}
+	}
+	return func(id string) bool {
+		_, ok := set[shard.Slot(id)]
+		return ok
+	}
+}
+
+// touch updates the modification time of a Box and records the change; the caller must hold
+// the write lock.
+func (s *memoryBoxStore) touch(box *models.Box) {
+	now := time.Now()
+	box.ModifiedAt = &now
+	s.recordChange(box.Id, box)
+}
+
+// recordChange makes a change available to the watchers; the caller must hold the write lock.
+func (s *memoryBoxStore) recordChange(id string, box *models.Box) {
+	s.changeSeq++
+	change := BoxChange{Id: id, Token: []byte(strconv.FormatUint(s.changeSeq, 10))}
+	if box != nil {
+		change.Box = copyBox(box)
+	}
+	if len(s.changes) == maxChanges {
+		copy(s.changes, s.changes[1:])
+		s.changes = s.changes[:maxChanges-1]
+	}
+	s.changes = append(s.changes, change)
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func copyBox(box *models.Box) *models.Box {
+	ret := *box
+	if box.CreatedAt != nil {
+		createdAt := *box.CreatedAt
+		ret.CreatedAt = &createdAt
+	}
+	if box.LastViewed != nil {
+		lastViewed := *box.LastViewed
+		ret.LastViewed = &lastViewed
+	}
+	if box.ExpiresAt != nil {
+		expiresAt := *box.ExpiresAt
+		ret.ExpiresAt = &expiresAt
+	}
+	if box.ModifiedAt != nil {
+		modifiedAt := *box.ModifiedAt
+		ret.ModifiedAt = &modifiedAt
+	}
+	if box.Partition != nil {
+		partition := *box.Partition
+		ret.Partition = &partition
+	}
+	ret.EmojiFeedbacks = copyCounters(box.EmojiFeedbacks)
+	ret.ReportReasons = copyCounters(box.ReportReasons)
+	return &ret
+}
+
+func copyCounters(counters map[string]uint) map[string]uint {
+	if counters == nil {
+		return nil
+	}
+	ret := make(map[string]uint, len(counters))
+	for k, v := range counters {
+		ret[k] = v
+	}
+	return ret
+}
+
+func paginate(boxes []models.Box, offset, limit int) []models.Box {
+	if offset >= len(boxes) {
+		return nil
+	}
+	boxes = boxes[offset:]
+	if limit > 0 && len(boxes) > limit {
+		boxes = boxes[:limit]
+	}
+	return boxes
+}
+
+type memoryReplyStore struct {
+	replies map[string]*models.Reply
+	lock    sync.RWMutex
+}
+
+// NewMemoryReplyStore returns a ReplyStore that keeps everything in memory. It is meant for
+// tests and local development; nothing is persisted.
+func NewMemoryReplyStore() ReplyStore {
+	return &memoryReplyStore{
+		replies: make(map[string]*models.Reply),
+	}
+}
+
+func (s *memoryReplyStore) Create(_ context.Context, reply *models.Reply) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, exists := s.replies[reply.Id]; exists {
+		return errors.Errorf("duplicated Reply %s", reply.Id)
+	}
+	if reply.ParentId != "" {
+		parent, exists := s.replies[reply.ParentId]
+		if !exists {
+			return ErrNotFound
+		}
+		parent.ReplyCount++
+	}
+	s.replies[reply.Id] = copyReply(reply)
+	return nil
+}
+
+func (s *memoryReplyStore) Get(_ context.Context, id string) (*models.Reply, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	reply, exists := s.replies[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return copyReply(reply), nil
+}
+
+func (s *memoryReplyStore) List(
+	_ context.Context, boxID, parentID string, after *ReplyCursor, limit int,
+) ([]models.Reply, error) {
+	s.lock.RLock()
+	var replies []models.Reply
+	for _, reply := range s.replies {
+		if reply.BoxId == boxID && reply.ParentId == parentID {
+			replies = append(replies, *copyReply(reply))
+		}
+	}
+	s.lock.RUnlock()
+	sort.Slice(replies, func(i, j int) bool {
+		return replyBefore(&replies[i], replies[j].CreatedAt, replies[j].Id)
+	})
+	if after != nil {
+		i := sort.Search(len(replies), func(i int) bool {
+			return !replyBefore(&replies[i], &after.CreatedAt, after.Id) &&
+				(replies[i].Id != after.Id || !replies[i].CreatedAt.Equal(after.CreatedAt))
+		})
+		replies = replies[i:]
+	}
+	if len(replies) > limit {
+		replies = replies[:limit]
+	}
+	return replies, nil
+}
+
+func (s *memoryReplyStore) DeleteByBox(_ context.Context, boxID string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for id, reply := range s.replies {
+		if reply.BoxId == boxID {
+			delete(s.replies, id)
+		}
+	}
+	return nil
+}
+
+// replyBefore tells if the reply is ordered before the given position.
+func replyBefore(reply *models.Reply, createdAt *time.Time, id string) bool {
+	if !reply.CreatedAt.Equal(*createdAt) {
+		return reply.CreatedAt.Before(*createdAt)
+	}
+	return reply.Id < id
+}
+
+func copyReply(reply *models.Reply) *models.Reply {
+	ret := *reply
+	if reply.CreatedAt != nil {
+		createdAt := *reply.CreatedAt
+		ret.CreatedAt = &createdAt
+	}
+	return &ret
+}
+
+type memoryReportStore struct {
+	reports map[string]*models.Report
+	lock    sync.Mutex
+}
+
+// NewMemoryReportStore returns a ReportStore that keeps everything in memory. It is meant for
+// tests and local development; nothing is persisted.
+func NewMemoryReportStore() ReportStore {
+	return &memoryReportStore{
+		reports: make(map[string]*models.Report),
+	}
+}
+
+func (s *memoryReportStore) Create(_ context.Context, report *models.Report) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, exists := s.reports[report.Id]; exists {
+		return ErrDuplicated
+	}
+	cpy := *report
+	s.reports[report.Id] = &cpy
+	return nil
+}
+
+func (s *memoryReportStore) DeleteByBox(_ context.Context, boxID string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for id, report := range s.reports {
+		if report.BoxId == boxID {
+			delete(s.reports, id)
+		}
+	}
+	return nil
+}
+
+type memoryCheckpointStore struct {
+	tokens map[string][]byte
+	lock   sync.RWMutex
+}
+
+// NewMemoryCheckpointStore returns a CheckpointStore that keeps everything in memory.
+func NewMemoryCheckpointStore() CheckpointStore {
+	return &memoryCheckpointStore{tokens: make(map[string][]byte)}
+}
+
+func (s *memoryCheckpointStore) Get(_ context.Context, name string) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	token, exists := s.tokens[name]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), token...), nil
+}
+
+func (s *memoryCheckpointStore) Save(_ context.Context, name string, token []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.tokens[name] = append([]byte(nil), token...)
+	return nil
+}
+
+type memoryLeaseStore struct {
+	leases map[string]memoryLease
+	lock   sync.Mutex
+}
+
+type memoryLease struct {
+	holder    string
+	expiresAt time.Time
+}
+
+// NewMemoryLeaseStore returns a LeaseStore that keeps everything in memory.
+func NewMemoryLeaseStore() LeaseStore {
+	return &memoryLeaseStore{leases: make(map[string]memoryLease)}
+}
+
+func (s *memoryLeaseStore) Acquire(_ context.Context, name, holder string, duration time.Duration) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+	if lease, exists := s.leases[name]; exists && lease.holder != holder && now.Before(lease.expiresAt) {
+		return false, nil
+	}
+	s.leases[name] = memoryLease{holder: holder, expiresAt: now.Add(duration)}
+	return true, nil
+}
+
+func (s *memoryLeaseStore) Release(_ context.Context, name, holder string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if lease, exists := s.leases[name]; exists && lease.holder == holder {
+		delete(s.leases, name)
+	}
+	return nil
+}
+
+type memoryOutboxStore struct {
+	entries map[string]OutboxEntry
+	lock    sync.Mutex
+}
+
+// NewMemoryOutboxStore returns an OutboxStore that keeps everything in memory.
+func NewMemoryOutboxStore() OutboxStore {
+	return &memoryOutboxStore{entries: make(map[string]OutboxEntry)}
+}
+
+func (s *memoryOutboxStore) Put(_ context.Context, item *models.QueueItem) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.entries[item.Id] = OutboxEntry{Id: item.Id, Item: *item, PutAt: time.Now()}
+	return nil
+}
+
+func (s *memoryOutboxStore) List(_ context.Context, limit int) ([]OutboxEntry, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	ret := make([]OutboxEntry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		ret = append(ret, entry)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].PutAt.Before(ret[j].PutAt)
+	})
+	if len(ret) > limit {
+		ret = ret[:limit]
+	}
+	return ret, nil
+}
+
+func (s *memoryOutboxStore) Delete(_ context.Context, entry *OutboxEntry) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if existing, exists := s.entries[entry.Id]; exists && existing.PutAt.Equal(entry.PutAt) {
+		delete(s.entries, entry.Id)
+	}
+	return nil
+}
+
+func (s *memoryOutboxStore) Discard(_ context.Context, id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.entries, id)
+	return nil
+}
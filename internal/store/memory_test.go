@@ -0,0 +1,347 @@
+package store
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+)
+
+func TestMemoryBoxStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryBoxStore()
+	now := time.Now()
+	if err := s.Create(ctx, &models.Box{Id: "a", Body: "hello", CreatedAt: &now, LastViewed: &now}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := s.Create(ctx, &models.Box{Id: "a"}); err == nil {
+		t.Fatal("expecting error creating duplicated Box")
+	}
+	if _, err := s.Get(ctx, "b"); err != ErrNotFound {
+		t.Fatalf("expecting ErrNotFound; got %v", err)
+	}
+
+	box, err := s.AddEmoji(ctx, "a", map[string]uint{"smile": 2})
+	if err != nil {
+		t.Fatalf("add emoji: %v", err)
+	}
+	box.EmojiFeedbacks["smile"] = 100
+	if box, err = s.AddEmoji(ctx, "a", map[string]uint{"smile": 1, "cry": 1}); err != nil {
+		t.Fatalf("add emoji: %v", err)
+	}
+	if expected := map[string]uint{"smile": 3, "cry": 1}; !reflect.DeepEqual(box.EmojiFeedbacks, expected) {
+		t.Fatalf("expecting %v; got %v", expected, box.EmojiFeedbacks)
+	}
+	if _, err = s.AddEmoji(ctx, "b", map[string]uint{"smile": 1}); err != ErrNotFound {
+		t.Fatalf("expecting ErrNotFound; got %v", err)
+	}
+
+	viewed := now.Add(time.Minute)
+	if err = s.MarkViewed(ctx, []BoxViews{
+		{Id: "a", Count: 2, LastViewed: viewed},
+		{Id: "b", Count: 1, LastViewed: viewed},
+	}); err != nil {
+		t.Fatalf("mark viewed: %v", err)
+	}
+	// LastViewed never moves backward
+	if err = s.MarkViewed(ctx, []BoxViews{{Id: "a", Count: 1, LastViewed: now}}); err != nil {
+		t.Fatalf("mark viewed: %v", err)
+	}
+	if box, err = s.Get(ctx, "a"); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if !box.LastViewed.Equal(viewed) || box.Views != 3 {
+		t.Fatalf("expecting LastViewed %v and 3 views; got %v and %d", viewed, box.LastViewed, box.Views)
+	}
+
+	if err = s.Create(ctx, &models.Box{Id: "b"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	boxes, err := s.GetMany(ctx, []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatalf("get many: %v", err)
+	}
+	if len(boxes) != 2 {
+		t.Fatalf("expecting 2 Boxes; got %d", len(boxes))
+	}
+	scanned := make(map[string]bool)
+	if err = s.Scan(ctx, nil, func(box *models.Box) error {
+		scanned[box.Id] = true
+		return nil
+	}); err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	if expected := map[string]bool{"a": true, "b": true}; !reflect.DeepEqual(scanned, expected) {
+		t.Fatalf("expecting %v; got %v", expected, scanned)
+	}
+
+	body := "updated"
+	if box, err = s.Update(ctx, "a", &BoxUpdate{Body: &body}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if box.Body != body || box.Views != 3 {
+		t.Fatalf("unexpected Box after update: %+v", box)
+	}
+	if _, err = s.Update(ctx, "c", &BoxUpdate{Body: &body}); err != ErrNotFound {
+		t.Fatalf("expecting ErrNotFound; got %v", err)
+	}
+	if err = s.Delete(ctx, "a"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err = s.Delete(ctx, "a"); err != ErrNotFound {
+		t.Fatalf("expecting ErrNotFound; got %v", err)
+	}
+	if _, err = s.Get(ctx, "a"); err != ErrNotFound {
+		t.Fatalf("expecting ErrNotFound; got %v", err)
+	}
+}
+
+func TestMemoryBoxListing(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryBoxStore()
+	now := time.Now()
+	for i, box := range []models.Box{
+		{Id: "a", Status: models.BoxStatusApproved, EmojiFeedbacks: map[string]uint{"smile": 3}},
+		{Id: "b", Status: models.BoxStatusHidden},
+		{Id: "c", EmojiFeedbacks: map[string]uint{"smile": 1}},
+	} {
+		createdAt := now.Add(time.Duration(i) * time.Minute)
+		box.CreatedAt = &createdAt
+		if err := s.Create(ctx, &box); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+	after, before := now.Add(time.Second), now.Add(2*time.Minute)
+	for _, tc := range []struct {
+		Filter        BoxFilter
+		Offset, Limit int
+		Expected      []string
+	}{
+		{Expected: []string{"c", "b", "a"}},
+		{Offset: 1, Limit: 1, Expected: []string{"b"}},
+		{Filter: BoxFilter{CreatedAfter: &after}, Expected: []string{"c", "b"}},
+		{Filter: BoxFilter{CreatedBefore: &before}, Expected: []string{"b", "a"}},
+		{Filter: BoxFilter{Status: models.BoxStatusApproved}, Expected: []string{"c", "a"}},
+		{Filter: BoxFilter{Status: models.BoxStatusHidden}, Expected: []string{"b"}},
+		{Filter: BoxFilter{Emoji: "smile", MinEmojiCount: 2}, Expected: []string{"a"}},
+	} {
+		boxes, err := s.List(ctx, &tc.Filter, tc.Offset, tc.Limit)
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		var ids []string
+		for _, box := range boxes {
+			ids = append(ids, box.Id)
+		}
+		if !reflect.DeepEqual(ids, tc.Expected) {
+			t.Fatalf("%+v: expecting %v; got %v", tc, tc.Expected, ids)
+		}
+	}
+}
+
+func TestMemoryLeastRecentlyViewed(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryBoxStore()
+	now := time.Now()
+	earlier, expired := now.Add(-time.Hour), now.Add(-time.Minute)
+	for _, box := range []models.Box{
+		{Id: "a", LastViewed: &now},
+		{Id: "b", LastViewed: &earlier},
+		{Id: "c"},
+		{Id: "d", Status: models.BoxStatusHidden},
+		{Id: "e", ExpiresAt: &expired},
+		{Id: "f", MaxViews: 1, Views: 2},
+		{Id: "g", MaxViews: 2, Views: 2},
+		{Id: "h", MaxViews: 2, Views: 1, LastViewed: &now},
+	} {
+		if err := s.Create(ctx, &box); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+	for _, tc := range []struct {
+		Limit    int
+		Expected []string
+	}{
+		{Expected: []string{"c", "b", "a", "h"}},
+		{Limit: 2, Expected: []string{"c", "b"}},
+	} {
+		boxes, err := s.ListLeastRecentlyViewed(ctx, tc.Limit)
+		if err != nil {
+			t.Fatalf("list least recently viewed: %v", err)
+		}
+		var ids []string
+		for _, box := range boxes {
+			ids = append(ids, box.Id)
+		}
+		if !reflect.DeepEqual(ids, tc.Expected) {
+			t.Fatalf("%+v: expecting %v; got %v", tc, tc.Expected, ids)
+		}
+	}
+}
+
+func TestMemoryReports(t *testing.T) {
+	ctx := context.Background()
+	bs, rs := NewMemoryBoxStore(), NewMemoryReportStore()
+	for _, id := range []string{"a", "b", "c"} {
+		if err := bs.Create(ctx, &models.Box{Id: id}); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+	for _, r := range []struct{ Box, Reason string }{{"a", "Spam"}, {"b", "Spam"}, {"b", "Abuse"}} {
+		if _, err := bs.AddReport(ctx, r.Box, r.Reason); err != nil {
+			t.Fatalf("add report: %v", err)
+		}
+	}
+	if _, err := bs.AddReport(ctx, "d", "Spam"); err != ErrNotFound {
+		t.Fatalf("expecting ErrNotFound; got %v", err)
+	}
+	for _, tc := range []struct {
+		MinCount      uint
+		Offset, Limit int
+		Expected      []string
+	}{
+		{Expected: []string{"b", "a"}},
+		{MinCount: 2, Expected: []string{"b"}},
+		{Limit: 1, Expected: []string{"b"}},
+		{Offset: 1, Expected: []string{"a"}},
+		{Offset: 2},
+	} {
+		boxes, err := bs.ListReported(ctx, tc.MinCount, tc.Offset, tc.Limit)
+		if err != nil {
+			t.Fatalf("list reported: %v", err)
+		}
+		var ids []string
+		for _, box := range boxes {
+			ids = append(ids, box.Id)
+		}
+		if !reflect.DeepEqual(ids, tc.Expected) {
+			t.Fatalf("%+v: expecting %v; got %v", tc, tc.Expected, ids)
+		}
+	}
+
+	if err := rs.Create(ctx, &models.Report{Id: "x", BoxId: "a"}); err != nil {
+		t.Fatalf("create report: %v", err)
+	}
+	if err := rs.Create(ctx, &models.Report{Id: "x", BoxId: "a"}); err != ErrDuplicated {
+		t.Fatalf("expecting ErrDuplicated; got %v", err)
+	}
+	if err := rs.DeleteByBox(ctx, "a"); err != nil {
+		t.Fatalf("delete by Box: %v", err)
+	}
+	if err := rs.Create(ctx, &models.Report{Id: "x", BoxId: "a"}); err != nil {
+		t.Fatalf("create report after deletion: %v", err)
+	}
+}
+
+func TestMemoryBoxChanges(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryBoxStore()
+	for _, id := range []string{"a", "b", "c"} {
+		if err := s.Create(ctx, &models.Box{Id: id}); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+	since := time.Now()
+	if err := s.MarkViewed(ctx, []BoxViews{{Id: "b", Count: 1, LastViewed: since}}); err != nil {
+		t.Fatalf("mark viewed: %v", err)
+	}
+	if _, err := s.AddEmoji(ctx, "a", map[string]uint{"+1": 1}); err != nil {
+		t.Fatalf("add emoji: %v", err)
+	}
+	if err := s.Delete(ctx, "c"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	var modified []string
+	if err := s.ScanModified(ctx, since, nil, func(box *models.Box) error {
+		modified = append(modified, box.Id)
+		return nil
+	}); err != nil {
+		t.Fatalf("scan modified: %v", err)
+	}
+	if !reflect.DeepEqual(modified, []string{"b", "a"}) {
+		t.Fatalf("expecting modified Boxes in order of modification; got %v", modified)
+	}
+	var deleted []string
+	if err := s.ScanDeleted(ctx, since, func(id string) error {
+		deleted = append(deleted, id)
+		return nil
+	}); err != nil {
+		t.Fatalf("scan deleted: %v", err)
+	}
+	if !reflect.DeepEqual(deleted, []string{"c"}) {
+		t.Fatalf("expecting deleted Box c; got %v", deleted)
+	}
+}
+
+func TestMemoryReplyStore(t *testing.T) {
+	ctx := context.Background()
+	bs, rs := NewMemoryBoxStore(), NewMemoryReplyStore()
+	if err := bs.Create(ctx, &models.Box{Id: "box"}); err != nil {
+		t.Fatalf("create Box: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := bs.IncrementReplyCount(ctx, "box", 2); err != nil {
+			t.Fatalf("increment reply count: %v", err)
+		}
+	}
+	if err := bs.IncrementReplyCount(ctx, "box", 2); err != ErrLimitExceeded {
+		t.Fatalf("expecting ErrLimitExceeded; got %v", err)
+	}
+	if err := bs.IncrementReplyCount(ctx, "unknown", 2); err != ErrNotFound {
+		t.Fatalf("expecting ErrNotFound; got %v", err)
+	}
+
+	now := time.Now()
+	for _, reply := range []models.Reply{
+		{Id: "c", BoxId: "box", CreatedAt: &now},
+		{Id: "a", BoxId: "box", CreatedAt: &now},
+		{Id: "b", BoxId: "box", CreatedAt: func() *time.Time { t := now.Add(-time.Second); return &t }()},
+		{Id: "d", BoxId: "box", ParentId: "a", CreatedAt: &now},
+		{Id: "e", BoxId: "other", CreatedAt: &now},
+	} {
+		reply := reply
+		if err := rs.Create(ctx, &reply); err != nil {
+			t.Fatalf("create Reply: %v", err)
+		}
+	}
+	if err := rs.Create(ctx, &models.Reply{Id: "f", BoxId: "box", ParentId: "unknown", CreatedAt: &now}); err != ErrNotFound {
+		t.Fatalf("expecting ErrNotFound; got %v", err)
+	}
+	if parent, err := rs.Get(ctx, "a"); err != nil || parent.ReplyCount != 1 {
+		t.Fatalf("expecting parent Reply with 1 reply; got %+v, %v", parent, err)
+	}
+
+	var (
+		ids   []string
+		after *ReplyCursor
+	)
+	for {
+		page, err := rs.List(ctx, "box", "", after, 2)
+		if err != nil {
+			t.Fatalf("list Replies: %v", err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		for _, reply := range page {
+			ids = append(ids, reply.Id)
+		}
+		last := page[len(page)-1]
+		after = &ReplyCursor{CreatedAt: *last.CreatedAt, Id: last.Id}
+	}
+	if expected := []string{"b", "a", "c"}; !reflect.DeepEqual(ids, expected) {
+		t.Fatalf("expecting %v; got %v", expected, ids)
+	}
+
+	if err := rs.DeleteByBox(ctx, "box"); err != nil {
+		t.Fatalf("delete Replies: %v", err)
+	}
+	if _, err := rs.Get(ctx, "d"); err != ErrNotFound {
+		t.Fatalf("expecting ErrNotFound; got %v", err)
+	}
+	if _, err := rs.Get(ctx, "e"); err != nil {
+		t.Fatalf("expecting Replies of other Boxes to be kept; got %v", err)
+	}
+}
@@ -0,0 +1,624 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/lichuan0620/secret-keeper-backend/internal/shard"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/mongo"
+	"github.com/pkg/errors"
+)
+
+type mongoBoxStore struct{}
+
+// NewMongoBoxStore returns a BoxStore backed by the MongoDB connection from pkg/mongo, which
+// must have been initialized beforehand.
+func NewMongoBoxStore() BoxStore {
+	return mongoBoxStore{}
+}
+
+func (mongoBoxStore) Create(_ context.Context, box *models.Box) error {
+	db := mongo.DB()
+	defer db.Session.Close()
+	if box.ModifiedAt == nil {
+		now := time.Now()
+		box.ModifiedAt = &now
+	}
+	if box.Partition == nil {
+		slot := shard.Slot(box.Id)
+		box.Partition = &slot
+	}
+	return db.C(mongo.CollectionBox).Insert(box)
+}
+
+func (mongoBoxStore) Get(_ context.Context, id string) (*models.Box, error) {
+	db := mongo.DB()
+	defer db.Session.Close()
+	var box models.Box
+	if err := db.C(mongo.CollectionBox).FindId(id).One(&box); err != nil {
+		return nil, convertError(err)
+	}
+	return &box, nil
+}
+
+func (mongoBoxStore) GetMany(_ context.Context, ids []string) ([]models.Box, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	db := mongo.DB()
+	defer db.Session.Close()
+	var boxes []models.Box
+	if err := db.C(mongo.CollectionBox).Find(bson.M{"_id": bson.M{"$in": ids}}).All(&boxes); err != nil {
+		return nil, convertError(err)
+	}
+	return boxes, nil
+}
+
+func (mongoBoxStore) AddEmoji(_ context.Context, id string, feedbacks map[string]uint) (*models.Box, error) {
+	db := mongo.DB()
+	defer db.Session.Close()
+	var box models.Box
+	if len(feedbacks) == 0 {
+		if err := db.C(mongo.CollectionBox).FindId(id).One(&box); err != nil {
+			return nil, convertError(err)
+		}
+		return &box, nil
+	}
+	incOpt := make(bson.M, len(feedbacks))
+	for k, v := range feedbacks {
+		incOpt["EmojiFeedbacks."+k] = v
+	}
+	if _, err := db.C(mongo.CollectionBox).FindId(id).Apply(mgo.Change{
+		Update:    bson.M{"$inc": incOpt, "$currentDate": currentModifiedAt},
+		ReturnNew: true,
+	}, &box); err != nil {
+		return nil, convertError(err)
+	}
+	return &box, nil
+}
+
+func (mongoBoxStore) MarkViewed(_ context.Context, views []BoxViews) error {
+	if len(views) == 0 {
+		return nil
+	}
+	db := mongo.DB()
+	defer db.Session.Close()
+	bulk := db.C(mongo.CollectionBox).Bulk()
+	bulk.Unordered()
+	for _, v := range views {
+		bulk.Update(bson.M{"_id": v.Id}, bson.M{
+			"$max":         bson.M{"LastViewed": v.LastViewed},
+			"$inc":         bson.M{"Views": v.Count},
+			"$currentDate": currentModifiedAt,
+		})
+	}
+	if _, err := bulk.Run(); err != nil {
+		return convertViewsError(views, err)
+	}
+	return nil
+}
+
+// convertViewsError tells which of the views failed from the error of the unordered bulk write
+// recording them; every view may have failed unless the error tells otherwise.
+func convertViewsError(views []BoxViews, err error) error {
+	bulkErr, ok := err.(*mgo.BulkError)
+	if !ok {
+		return convertError(err)
+	}
+	cases := bulkErr.Cases()
+	failed := make([]BoxViews, 0, len(cases))
+	for _, c := range cases {
+		if c.Index < 0 || c.Index >= len(views) {
+			return err
+		}
+		failed = append(failed, views[c.Index])
+	}
+	return &ViewsError{Failed: failed, Err: err}
+}
+
+func (mongoBoxStore) Update(_ context.Context, id string, update *BoxUpdate) (*models.Box, error) {
+	db := mongo.DB()
+	defer db.Session.Close()
+	set := bson.M{}
+	if update.Body != nil {
+		set["Body"] = *update.Body
+	}
+	if update.Status != nil {
+		set["Status"] = *update.Status
+	}
+	change := bson.M{"$currentDate": currentModifiedAt}
+	if len(set) > 0 {
+		change["$set"] = set
+	}
+	if update.ClearReports {
+		change["$unset"] = bson.M{"ReportCount": "", "ReportReasons": ""}
+	}
+	var box models.Box
+	if len(change) == 1 {
+		if err := db.C(mongo.CollectionBox).FindId(id).One(&box); err != nil {
+			return nil, convertError(err)
+		}
+		return &box, nil
+	}
+	if _, err := db.C(mongo.CollectionBox).FindId(id).Apply(mgo.Change{
+		Update:    change,
+		ReturnNew: true,
+	}, &box); err != nil {
+		return nil, convertError(err)
+	}
+	return &box, nil
+}
+
+func (mongoBoxStore) IncrementReplyCount(_ context.Context, id string, limit uint) error {
+	db := mongo.DB()
+	defer db.Session.Close()
+	err := db.C(mongo.CollectionBox).Update(bson.M{
+		"_id": id,
+		"$or": []bson.M{
+			{"ReplyCount": bson.M{"$lt": limit}},
+			{"ReplyCount": bson.M{"$exists": false}},
+		},
+	}, bson.M{"$inc": bson.M{"ReplyCount": 1}, "$currentDate": currentModifiedAt})
+	if err != mgo.ErrNotFound {
+		return err
+	}
+	// tell a missing Box from one that has reached the limit
+	if n, err := db.C(mongo.CollectionBox).FindId(id).Count(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return ErrLimitExceeded
+}
+
+func (mongoBoxStore) DecrementReplyCount(_ context.Context, id string) error {
+	db := mongo.DB()
+	defer db.Session.Close()
+	return convertError(db.C(mongo.CollectionBox).Update(
+		bson.M{"_id": id, "ReplyCount": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"ReplyCount": -1}, "$currentDate": currentModifiedAt},
+	))
+}
+
+func (mongoBoxStore) AddReport(_ context.Context, id, reason string) (*models.Box, error) {
+	db := mongo.DB()
+	defer db.Session.Close()
+	var box models.Box
+	if _, err := db.C(mongo.CollectionBox).FindId(id).Apply(mgo.Change{
+		Update: bson.M{
+			"$inc":         bson.M{"ReportCount": 1, "ReportReasons." + reason: 1},
+			"$currentDate": currentModifiedAt,
+		},
+		ReturnNew: true,
+	}, &box); err != nil {
+		return nil, convertError(err)
+	}
+	return &box, nil
+}
+
+func (mongoBoxStore) List(_ context.Context, filter *BoxFilter, offset, limit int) ([]models.Box, error) {
+	db := mongo.DB()
+	defer db.Session.Close()
+	query := bson.M{}
+	created := bson.M{}
+	if filter.CreatedAfter != nil {
+		created["$gte"] = *filter.CreatedAfter
+	}
+	if filter.CreatedBefore != nil {
+		created["$lt"] = *filter.CreatedBefore
+	}
+	if len(created) > 0 {
+		query["CreatedAt"] = created
+	}
+	if filter.Status == models.BoxStatusApproved {
+		query["Status"] = bson.M{"$in": []interface{}{models.BoxStatusApproved, nil}}
+	} else if filter.Status != "" {
+		query["Status"] = filter.Status
+	}
+	if filter.Emoji != "" {
+		query["EmojiFeedbacks."+filter.Emoji] = bson.M{"$gte": filter.MinEmojiCount}
+	}
+	var boxes []models.Box
+	if err := db.C(mongo.CollectionBox).
+		Find(query).
+		Sort("-CreatedAt", "_id").
+		Skip(offset).
+		Limit(limit).
+		All(&boxes); err != nil {
+		return nil, err
+	}
+	return boxes, nil
+}
+
+func (mongoBoxStore) ListReported(_ context.Context, minCount uint, offset, limit int) ([]models.Box, error) {
+	db := mongo.DB()
+	defer db.Session.Close()
+	if minCount == 0 {
+		minCount = 1
+	}
+	var boxes []models.Box
+	if err := db.C(mongo.CollectionBox).
+		Find(bson.M{"ReportCount": bson.M{"$gte": minCount}}).
+		Sort("-ReportCount", "_id").
+		Skip(offset).
+		Limit(limit).
+		All(&boxes); err != nil {
+		return nil, err
+	}
+	return boxes, nil
+}
+
+func (mongoBoxStore) ListLeastRecentlyViewed(_ context.Context, limit int) ([]models.Box, error) {
+	db := mongo.DB()
+	defer db.Session.Close()
+	// the conditions of Box.Approved, Box.Expired and Box.Exhausted; a missing LastViewed comes
+	// first in ascending order
+	query := bson.M{
+		"Status": bson.M{"$in": []interface{}{models.BoxStatusApproved, nil}},
+		"$and": []bson.M{
+			{"$or": []bson.M{{"ExpiresAt": nil}, {"ExpiresAt": bson.M{"$gt": time.Now()}}}},
+			{"$or": []bson.M{{"MaxViews": nil}, {"$expr": bson.M{"$lt": []string{"$Views", "$MaxViews"}}}}},
+		},
+	}
+	var boxes []models.Box
+	if err := db.C(mongo.CollectionBox).
+		Find(query).
+		Sort("LastViewed", "_id").
+		Limit(limit).
+		All(&boxes); err != nil {
+		return nil, err
+	}
+	return boxes, nil
+}
+
+func (mongoBoxStore) Delete(_ context.Context, id string) error {
+	db := mongo.DB()
+	defer db.Session.Close()
+	if err := db.C(mongo.CollectionBox).RemoveId(id); err != nil {
+		return convertError(err)
+	}
+	_, err := db.C(mongo.CollectionBoxTombstone).UpsertId(id, bson.M{
+		"$currentDate": bson.M{"DeletedAt": true},
+	})
+	return errors.Wrap(err, "record Box tombstone")
+}
+
+func (mongoBoxStore) Scan(_ context.Context, slots []int, fn func(*models.Box) error) error {
+	db := mongo.DB()
+	defer db.Session.Close()
+	return scanBoxes(db.C(mongo.CollectionBox).Find(partitionQuery(bson.M{}, slots)).Iter(), fn)
+}
+
+func (mongoBoxStore) ScanModified(_ context.Context, since time.Time, slots []int, fn func(*models.Box) error) error {
+	db := mongo.DB()
+	defer db.Session.Close()
+	return scanBoxes(db.C(mongo.CollectionBox).
+		Find(partitionQuery(bson.M{"ModifiedAt": bson.M{"$gte": since}}, slots)).
+		Sort("ModifiedAt").
+		Iter(), fn)
+}
+
+// partitionQuery restricts a query to the Boxes in the given slots and the ones without a slot.
+func partitionQuery(query bson.M, slots []int) bson.M {
+	if slots != nil {
+		query["$or"] = []bson.M{
+			{"Partition": bson.M{"$in": slots}},
+			{"Partition": bson.M{"$exists": false}},
+		}
+	}
+	return query
+}
+
+func (mongoBoxStore) ScanDeleted(_ context.Context, since time.Time, fn func(id string) error) error {
+	db := mongo.DB()
+	defer db.Session.Close()
+	iter := db.C(mongo.CollectionBoxTombstone).
+		Find(bson.M{"DeletedAt": bson.M{"$gte": since}}).
+		Select(bson.M{"_id": 1}).
+		Iter()
+	var tombstone struct {
+		Id string `bson:"_id"`
+	}
+	for iter.Next(&tombstone) {
+		if err := fn(tombstone.Id); err != nil {
+			_ = iter.Close()
+			return err
+		}
+	}
+	return errors.Wrap(iter.Close(), "iterate Box tombstone")
+}
+
+// Watch tails the change stream of the Box collection, which requires MongoDB to run as a
+// replica set.
+func (mongoBoxStore) Watch(ctx context.Context, token []byte, fn func(*BoxChange) error) error {
+	db := mongo.DB()
+	defer db.Session.Close()
+	opts := mgo.ChangeStreamOptions{
+		FullDocument:   mgo.UpdateLookup,
+		MaxAwaitTimeMS: time.Second,
+	}
+	if token != nil {
+		opts.ResumeAfter = &bson.Raw{Kind: 0x03, Data: token}
+	}
+	stream, err := db.C(mongo.CollectionBox).Watch([]bson.M{{
+		"$match": bson.M{"operationType": bson.M{"$in": []string{"insert", "update", "replace", "delete"}}},
+	}}, opts)
+	if err != nil {
+		return errors.Wrap(convertWatchError(err), "watch Box")
+	}
+	defer func() {
+		_ = stream.Close()
+	}()
+	for ctx.Err() == nil {
+		var event struct {
+			DocumentKey struct {
+				Id string `bson:"_id"`
+			} `bson:"documentKey"`
+			// FullDocument is missing from deletions, and from updates of Boxes that have been
+			// deleted since
+			FullDocument *models.Box `bson:"fullDocument"`
+		}
+		if !stream.Next(&event) {
+			if err = stream.Err(); err != nil {
+				return errors.Wrap(convertWatchError(err), "watch Box")
+			}
+			continue
+		}
+		change := BoxChange{Id: event.DocumentKey.Id, Box: event.FullDocument}
+		if resumeToken := stream.ResumeToken(); resumeToken != nil {
+			change.Token = resumeToken.Data
+		}
+		if err = fn(&change); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+func scanBoxes(iter *mgo.Iter, fn func(*models.Box) error) error {
+	var box models.Box
+	for iter.Next(&box) {
+		if err := fn(&box); err != nil {
+			_ = iter.Close()
+			return err
+		}
+		box = models.Box{}
+	}
+	return errors.Wrap(iter.Close(), "iterate Box")
+}
+
+// currentModifiedAt sets ModifiedAt to the current time of the database with $currentDate, so
+// that the modification times do not depend on the clocks of the servers.
+var currentModifiedAt = bson.M{"ModifiedAt": true}
+
+type mongoReplyStore struct{}
+
+// NewMongoReplyStore returns a ReplyStore backed by the MongoDB connection from pkg/mongo, which
+// must have been initialized beforehand.
+func NewMongoReplyStore() ReplyStore {
+	return mongoReplyStore{}
+}
+
+func (mongoReplyStore) Create(_ context.Context, reply *models.Reply) error {
+	db := mongo.DB()
+	defer db.Session.Close()
+	if reply.ParentId != "" {
+		if err := db.C(mongo.CollectionReply).UpdateId(
+			reply.ParentId,
+			bson.M{"$inc": bson.M{"ReplyCount": 1}},
+		); err != nil {
+			return convertError(err)
+		}
+	}
+	return db.C(mongo.CollectionReply).Insert(reply)
+}
+
+func (mongoReplyStore) Get(_ context.Context, id string) (*models.Reply, error) {
+	db := mongo.DB()
+	defer db.Session.Close()
+	var reply models.Reply
+	if err := db.C(mongo.CollectionReply).FindId(id).One(&reply); err != nil {
+		return nil, convertError(err)
+	}
+	return &reply, nil
+}
+
+func (mongoReplyStore) List(
+	_ context.Context, boxID, parentID string, after *ReplyCursor, limit int,
+) ([]models.Reply, error) {
+	db := mongo.DB()
+	defer db.Session.Close()
+	query := bson.M{"BoxId": boxID, "ParentId": parentID}
+	if after != nil {
+		query["$or"] = []bson.M{
+			{"CreatedAt": bson.M{"$gt": after.CreatedAt}},
+			{"CreatedAt": after.CreatedAt, "_id": bson.M{"$gt": after.Id}},
+		}
+	}
+	var replies []models.Reply
+	if err := db.C(mongo.CollectionReply).Find(query).Sort("CreatedAt", "_id").Limit(limit).All(&replies); err != nil {
+		return nil, err
+	}
+	return replies, nil
+}
+
+func (mongoReplyStore) DeleteByBox(_ context.Context, boxID string) error {
+	db := mongo.DB()
+	defer db.Session.Close()
+	_, err := db.C(mongo.CollectionReply).RemoveAll(bson.M{"BoxId": boxID})
+	return err
+}
+
+type mongoReportStore struct{}
+
+// NewMongoReportStore returns a ReportStore backed by the MongoDB connection from pkg/mongo,
+// which must have been initialized beforehand.
+func NewMongoReportStore() ReportStore {
+	return mongoReportStore{}
+}
+
+func (mongoReportStore) Create(_ context.Context, report *models.Report) error {
+	db := mongo.DB()
+	defer db.Session.Close()
+	return convertError(db.C(mongo.CollectionReport).Insert(report))
+}
+
+func (mongoReportStore) DeleteByBox(_ context.Context, boxID string) error {
+	db := mongo.DB()
+	defer db.Session.Close()
+	_, err := db.C(mongo.CollectionReport).RemoveAll(bson.M{"BoxId": boxID})
+	return err
+}
+
+type mongoCheckpointStore struct{}
+
+// NewMongoCheckpointStore returns a CheckpointStore backed by the MongoDB connection from
+// pkg/mongo, which must have been initialized beforehand.
+func NewMongoCheckpointStore() CheckpointStore {
+	return mongoCheckpointStore{}
+}
+
+type checkpoint struct {
+	Name      string    `bson:"_id"`
+	Token     []byte    `bson:"Token"`
+	UpdatedAt time.Time `bson:"UpdatedAt"`
+}
+
+func (mongoCheckpointStore) Get(_ context.Context, name string) ([]byte, error) {
+	db := mongo.DB()
+	defer db.Session.Close()
+	var ret checkpoint
+	if err := db.C(mongo.CollectionCheckpoint).FindId(name).One(&ret); err != nil {
+		return nil, convertError(err)
+	}
+	return ret.Token, nil
+}
+
+func (mongoCheckpointStore) Save(_ context.Context, name string, token []byte) error {
+	db := mongo.DB()
+	defer db.Session.Close()
+	_, err := db.C(mongo.CollectionCheckpoint).UpsertId(name, &checkpoint{
+		Name:      name,
+		Token:     token,
+		UpdatedAt: time.Now(),
+	})
+	return err
+}
+
+type mongoLeaseStore struct{}
+
+// NewMongoLeaseStore returns a LeaseStore backed by the MongoDB connection from pkg/mongo, which
+// must have been initialized beforehand. The leases expire by the clocks of the holders, which
+// should therefore be kept in sync.
+func NewMongoLeaseStore() LeaseStore {
+	return mongoLeaseStore{}
+}
+
+func (mongoLeaseStore) Acquire(_ context.Context, name, holder string, duration time.Duration) (bool, error) {
+	db := mongo.DB()
+	defer db.Session.Close()
+	now := time.Now()
+	// the upsert turns into an insert, which fails on the duplicated ID, if someone else holds an
+	// unexpired lease
+	_, err := db.C(mongo.CollectionLease).Upsert(bson.M{
+		"_id": name,
+		"$or": []bson.M{
+			{"Holder": holder},
+			{"ExpiresAt": bson.M{"$lt": now}},
+		},
+	}, bson.M{"$set": bson.M{"Holder": holder, "ExpiresAt": now.Add(duration)}})
+	if mgo.IsDup(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (mongoLeaseStore) Release(_ context.Context, name, holder string) error {
+	db := mongo.DB()
+	defer db.Session.Close()
+	if err := db.C(mongo.CollectionLease).Remove(bson.M{"_id": name, "Holder": holder}); err != mgo.ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+type mongoOutboxStore struct{}
+
+// NewMongoOutboxStore returns an OutboxStore backed by the MongoDB connection from pkg/mongo,
+// which must have been initialized beforehand.
+func NewMongoOutboxStore() OutboxStore {
+	return mongoOutboxStore{}
+}
+
+func (mongoOutboxStore) Put(_ context.Context, item *models.QueueItem) error {
+	db := mongo.DB()
+	defer db.Session.Close()
+	_, err := db.C(mongo.CollectionOutbox).UpsertId(item.Id, &OutboxEntry{
+		Id:    item.Id,
+		Item:  *item,
+		PutAt: time.Now(),
+	})
+	return err
+}
+
+func (mongoOutboxStore) List(_ context.Context, limit int) ([]OutboxEntry, error) {
+	db := mongo.DB()
+	defer db.Session.Close()
+	var entries []OutboxEntry
+	if err := db.C(mongo.CollectionOutbox).Find(nil).Sort("PutAt").Limit(limit).All(&entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (mongoOutboxStore) Delete(_ context.Context, entry *OutboxEntry) error {
+	db := mongo.DB()
+	defer db.Session.Close()
+	if err := db.C(mongo.CollectionOutbox).Remove(bson.M{"_id": entry.Id, "PutAt": entry.PutAt}); err != mgo.ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+func (mongoOutboxStore) Discard(_ context.Context, id string) error {
+	db := mongo.DB()
+	defer db.Session.Close()
+	if err := db.C(mongo.CollectionOutbox).RemoveId(id); err != mgo.ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+func convertError(err error) error {
+	if err == mgo.ErrNotFound {
+		return ErrNotFound
+	}
+	if mgo.IsDup(err) {
+		return ErrDuplicated
+	}
+	return err
+}
+
+// convertWatchError tells the errors about a resume token that is too old apart.
+func convertWatchError(err error) error {
+	const (
+		codeChangeStreamFatalError  = 280
+		codeChangeStreamHistoryLost = 286
+	)
+	var code int
+	switch typed := err.(type) {
+	case *mgo.QueryError:
+		code = typed.Code
+	case *mgo.LastError:
+		code = typed.Code
+	}
+	if code == codeChangeStreamFatalError || code == codeChangeStreamHistoryLost {
+		return ErrHistoryLost
+	}
+	return err
+}
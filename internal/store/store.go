@@ -0,0 +1,217 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrLimitExceeded = errors.New("limit exceeded")
+	ErrDuplicated    = errors.New("duplicated")
+	// ErrHistoryLost is returned by BoxWatcher.Watch when the changes after the resume token are
+	// no longer available; the reader has to start over from the current state.
+	ErrHistoryLost = errors.New("change history lost")
+)
+
+// BoxStore persists Boxes. Implementations must be safe for concurrent use.
+type BoxStore interface {
+	// Create stores a new Box. The Id of the Box must be set by the caller.
+	Create(ctx context.Context, box *models.Box) error
+	// Get returns the Box with the given ID, or ErrNotFound.
+	Get(ctx context.Context, id string) (*models.Box, error)
+	// GetMany returns the existing Boxes among the given IDs in no particular order.
+	GetMany(ctx context.Context, ids []string) ([]models.Box, error)
+	// AddEmoji increments the emoji feedback counters of a Box and returns the updated Box.
+	AddEmoji(ctx context.Context, id string, feedbacks map[string]uint) (*models.Box, error)
+	// MarkViewed records the views of a number of Boxes at once: it adds to the Views counter of
+	// every Box and moves its LastViewed timestamp forward. Boxes that no longer exist are skipped.
+	// A *ViewsError tells which views were not recorded when the others were; the views are not
+	// idempotent, so only those may be recorded again.
+	MarkViewed(ctx context.Context, views []BoxViews) error
+	// Update applies the non-nil fields of a BoxUpdate to a Box and returns the updated Box.
+	Update(ctx context.Context, id string, update *BoxUpdate) (*models.Box, error)
+	// IncrementReplyCount increments the ReplyCount of a Box, or returns ErrLimitExceeded if the
+	// count has already reached the given limit.
+	IncrementReplyCount(ctx context.Context, id string, limit uint) error
+	// DecrementReplyCount reverts a previous IncrementReplyCount.
+	DecrementReplyCount(ctx context.Context, id string) error
+	// AddReport increments the ReportCount of a Box and the counter of the given reason, and
+	// returns the updated Box.
+	AddReport(ctx context.Context, id, reason string) (*models.Box, error)
+	// List returns Boxes matching the filter, newest first.
+	List(ctx context.Context, filter *BoxFilter, offset, limit int) ([]models.Box, error)
+	// ListReported returns Boxes with at least minCount reports, most reported first.
+	ListReported(ctx context.Context, minCount uint, offset, limit int) ([]models.Box, error)
+	// ListLeastRecentlyViewed returns up to limit Boxes that can be viewed, i.e. approved, not
+	// expired and not exhausted, the ones viewed least recently first. It serves the viewers
+	// without the queue, so it is only as fair as the store is up to date.
+	ListLeastRecentlyViewed(ctx context.Context, limit int) ([]models.Box, error)
+	// Delete removes a Box, or returns ErrNotFound if it does not exist.
+	Delete(ctx context.Context, id string) error
+	// Scan calls fn for every stored Box in the given shard slots, or for every stored Box if
+	// slots is nil, until fn returns an error, which is then returned by Scan. It may also visit
+	// Boxes outside the slots, which the caller has to skip. The Box passed to fn must not be
+	// retained after fn returns.
+	Scan(ctx context.Context, slots []int, fn func(*models.Box) error) error
+	// ScanModified is like Scan but only visits the Boxes modified at or after the given time,
+	// in the order of modification.
+	ScanModified(ctx context.Context, since time.Time, slots []int, fn func(*models.Box) error) error
+	// ScanDeleted calls fn with the ID of every Box deleted at or after the given time, as long as
+	// the deletion happened within mongo.TombstoneRetention.
+	ScanDeleted(ctx context.Context, since time.Time, fn func(id string) error) error
+}
+
+// BoxViews are the views of a Box to be recorded.
+type BoxViews struct {
+	Id string
+	// Count is the number of views.
+	Count uint
+	// LastViewed is the time of the last view.
+	LastViewed time.Time
+}
+
+// ViewsError is returned by BoxStore.MarkViewed when some of the views were not recorded.
+type ViewsError struct {
+	// Failed are the views not recorded.
+	Failed []BoxViews
+	Err    error
+}
+
+func (e *ViewsError) Error() string {
+	return errors.Wrapf(e.Err, "%d views not recorded", len(e.Failed)).Error()
+}
+
+func (e *ViewsError) Unwrap() error {
+	return e.Err
+}
+
+// BoxChange is a change to a Box delivered by a BoxWatcher.
+type BoxChange struct {
+	Id string
+	// Box is the state of the Box after the change, or nil if the Box has been deleted.
+	Box *models.Box
+	// Token resumes watching right after this change.
+	Token []byte
+}
+
+// BoxWatcher is implemented by the BoxStores that can stream the changes made to the Boxes.
+type BoxWatcher interface {
+	// Watch calls fn with every change made after the one identified by the resume token, or
+	// made from now on if the token is nil, until ctx is done or fn returns an error. It returns
+	// ErrHistoryLost if the changes after the token are no longer available.
+	Watch(ctx context.Context, token []byte, fn func(*BoxChange) error) error
+}
+
+// BoxUpdate describes changes to a Box; nil fields are left untouched.
+type BoxUpdate struct {
+	Body   *string
+	Status *models.BoxStatus
+	// ClearReports resets the report statistics of the Box.
+	ClearReports bool
+}
+
+// BoxFilter selects Boxes in a listing; zero fields match every Box.
+type BoxFilter struct {
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// Status matches Boxes with the given status; BoxStatusApproved also matches Boxes created
+	// before moderation was introduced, which have no status.
+	Status models.BoxStatus
+	// Emoji and MinEmojiCount match Boxes that have received the emoji at least MinEmojiCount
+	// times. MinEmojiCount is ignored if Emoji is empty.
+	Emoji         string
+	MinEmojiCount uint
+}
+
+// Match tells if a Box matches the filter.
+func (f *BoxFilter) Match(box *models.Box) bool {
+	if f.CreatedAfter != nil && (box.CreatedAt == nil || box.CreatedAt.Before(*f.CreatedAfter)) {
+		return false
+	}
+	if f.CreatedBefore != nil && (box.CreatedAt == nil || !box.CreatedAt.Before(*f.CreatedBefore)) {
+		return false
+	}
+	if f.Status == models.BoxStatusApproved {
+		if !box.Approved() {
+			return false
+		}
+	} else if f.Status != "" && box.Status != f.Status {
+		return false
+	}
+	if f.Emoji != "" && box.EmojiFeedbacks[f.Emoji] < f.MinEmojiCount {
+		return false
+	}
+	return true
+}
+
+// ReplyStore persists Replies. Implementations must be safe for concurrent use.
+type ReplyStore interface {
+	// Create stores a new Reply and increments the ReplyCount of its parent Reply if it has one.
+	// The Id and CreatedAt of the Reply must be set by the caller.
+	Create(ctx context.Context, reply *models.Reply) error
+	// Get returns the Reply with the given ID, or ErrNotFound.
+	Get(ctx context.Context, id string) (*models.Reply, error)
+	// List returns up to limit Replies of a Box with the given parent (an empty parentID means
+	// top-level Replies), oldest first, starting after the given cursor if it is not nil.
+	List(ctx context.Context, boxID, parentID string, after *ReplyCursor, limit int) ([]models.Reply, error)
+	// DeleteByBox removes all Replies of a Box.
+	DeleteByBox(ctx context.Context, boxID string) error
+}
+
+// ReportStore persists Reports. Implementations must be safe for concurrent use.
+type ReportStore interface {
+	// Create stores a new Report, or returns ErrDuplicated if a Report with the same Id exists.
+	Create(ctx context.Context, report *models.Report) error
+	// DeleteByBox removes all Reports of a Box.
+	DeleteByBox(ctx context.Context, boxID string) error
+}
+
+// CheckpointStore persists the positions of the readers of change streams, so that they continue
+// where they left off after a restart. Implementations must be safe for concurrent use.
+type CheckpointStore interface {
+	// Get returns the resume token saved under the name, or ErrNotFound.
+	Get(ctx context.Context, name string) ([]byte, error)
+	// Save saves a resume token under the name, replacing the previous one.
+	Save(ctx context.Context, name string, token []byte) error
+}
+
+// LeaseStore grants named leases to one holder at a time. Implementations must be safe for
+// concurrent use.
+type LeaseStore interface {
+	// Acquire takes a lease for the holder, or extends it if the holder has it already, for the
+	// given duration. It tells if the holder has the lease, which it cannot have while another
+	// holder has an unexpired one.
+	Acquire(ctx context.Context, name, holder string, duration time.Duration) (bool, error)
+	// Release gives up a lease if the holder has it.
+	Release(ctx context.Context, name, holder string) error
+}
+
+// OutboxStore keeps the queue items whose Sync has failed until they are delivered, at most one per
+// Box. Implementations must be safe for concurrent use.
+type OutboxStore interface {
+	// Put stores an item, replacing the pending one of the same Box.
+	Put(ctx context.Context, item *models.QueueItem) error
+	// List returns up to limit pending entries, the oldest first.
+	List(ctx context.Context, limit int) ([]OutboxEntry, error)
+	// Delete removes a delivered entry unless it has been replaced since it was listed.
+	Delete(ctx context.Context, entry *OutboxEntry) error
+	// Discard removes the pending entry of a Box if there is one.
+	Discard(ctx context.Context, id string) error
+}
+
+// OutboxEntry is a queue item waiting in an OutboxStore.
+type OutboxEntry struct {
+	Id    string           `bson:"_id"`
+	Item  models.QueueItem `bson:"Item"`
+	PutAt time.Time        `bson:"PutAt"`
+}
+
+// ReplyCursor marks a position in a Reply listing.
+type ReplyCursor struct {
+	CreatedAt time.Time
+	Id        string
+}
@@ -36,4 +36,27 @@ app: secret-keeper-queue
 app: secret-keeper-queue
 app.kubernetes.io/name: {{ .Chart.Name }}
 app.kubernetes.io/instance: {{ .Release.Name }}
-{{- end -}}
\ No newline at end of file
+{{- end -}}
+
+{{/*
+the queue Pods are addressed one by one through the headless Service; the replicas of a shard are
+the Pods whose ordinals differ by a multiple of the number of shards
+*/}}
+{{- define "queue.endpoints" -}}
+{{- $name := include "queue.name" . -}}
+{{- $shards := int .Values.queue.shards -}}
+{{- $replicas := int .Values.queue.replicas -}}
+{{- if or (gt $shards 1) (gt $replicas 1) -}}
+{{- $endpoints := list -}}
+{{- range $i := until $shards -}}
+{{- $members := list -}}
+{{- range $j := until $replicas -}}
+{{- $members = append $members (printf "%s-%d.%s-headless:8080" $name (add $i (mul $j $shards)) $name) -}}
+{{- end -}}
+{{- $endpoints = append $endpoints (join "|" $members) -}}
+{{- end -}}
+{{- join "," $endpoints -}}
+{{- else -}}
+{{- printf "%s:8080" $name -}}
+{{- end -}}
+{{- end -}}
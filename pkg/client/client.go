@@ -0,0 +1,5 @@
+// Package client calls the secret-keeper server from Go. The Client is generated from the Actions
+// the server registers; the admin Actions need the bearer token in service.ClientOptions.Header.
+package client
+
+//go:generate go run generator/main.go
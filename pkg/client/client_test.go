@@ -0,0 +1,68 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lichuan0620/secret-keeper-backend/cmd/server/service"
+	"github.com/lichuan0620/secret-keeper-backend/internal/queue"
+	"github.com/lichuan0620/secret-keeper-backend/internal/queueclient"
+	"github.com/lichuan0620/secret-keeper-backend/internal/store"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+	pkgservice "github.com/lichuan0620/secret-keeper-backend/pkg/service"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/clientgen"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/standard"
+	"github.com/pkg/errors"
+)
+
+func TestGenerated(t *testing.T) {
+	source, err := clientgen.Generate(service.NewBuilder(&service.Options{}).Actions(), &clientgen.Options{
+		Package:   "client",
+		TypeName:  "Client",
+		Generator: "client generator",
+	})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if generated, _ := ioutil.ReadFile("generated.client.go"); !bytes.Equal(generated, source) {
+		t.Fatal("generated.client.go is out of date; run go generate")
+	}
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	bs := store.NewMemoryBoxStore()
+	handler, err := service.Build(&service.Options{
+		QueueClient: queueclient.NewLocal(queue.New(bs, nil)),
+		Boxes:       bs,
+		Replies:     store.NewMemoryReplyStore(),
+		Reports:     store.NewMemoryReportStore(),
+		AdminToken:  "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	c := NewClient(pkgservice.NewClient(server.URL, nil))
+	created, err := c.CreateBox(ctx, &models.CreateBoxRequest{Body: "hello"})
+	if err != nil {
+		t.Fatalf("create Box: %v", err)
+	}
+	var callErr *pkgservice.CallError
+	if _, err = c.GetBox(ctx, &models.GetBoxRequest{Id: created.Id}); !errors.As(err, &callErr) ||
+		callErr.Err.GetCode() != standard.InvalidAuthorization().GetCode() {
+		t.Fatalf("expecting the admin Action to be rejected without the token; got %v", err)
+	}
+	admin := NewClient(pkgservice.NewClient(server.URL, &pkgservice.ClientOptions{
+		Header: http.Header{"Authorization": []string{"Bearer secret"}},
+	}))
+	if box, err := admin.GetBox(ctx, &models.GetBoxRequest{Id: created.Id}); err != nil || box.Body != "hello" {
+		t.Fatalf("expecting the created Box; got %+v, %v", box, err)
+	}
+}
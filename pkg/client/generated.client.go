@@ -0,0 +1,202 @@
+// Code generated by client generator. DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+
+	"github.com/lichuan0620/secret-keeper-backend/pkg/models"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/model"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/openapi"
+)
+
+// Client calls the Actions of the service.
+type Client struct {
+	*service.Client
+}
+
+// NewClient returns the Client making the calls with c.
+func NewClient(c *service.Client) *Client {
+	return &Client{Client: c}
+}
+
+// AddBoxEmoji calls the AddBoxEmoji Action of version 2021-12-23.
+func (c *Client) AddBoxEmoji(ctx context.Context, body *models.AddBoxEmojiRequest) (*models.AddBoxEmojiResponse, error) {
+	var ret *models.AddBoxEmojiResponse
+	_, err := c.Call(ctx, &service.Request{
+		Action:  "AddBoxEmoji",
+		Version: "2021-12-23",
+		Body:    body,
+	}, &ret)
+	return ret, err
+}
+
+// Batch calls the Batch Action of version 2021-12-23.
+func (c *Client) Batch(ctx context.Context, body *model.BatchRequest) (*model.BatchResponse, error) {
+	var ret *model.BatchResponse
+	_, err := c.Call(ctx, &service.Request{
+		Action:  "Batch",
+		Version: "2021-12-23",
+		Body:    body,
+	}, &ret)
+	return ret, err
+}
+
+// CreateBox calls the CreateBox Action of version 2021-12-23.
+func (c *Client) CreateBox(ctx context.Context, body *models.CreateBoxRequest) (*models.CreateBoxResponse, error) {
+	var ret *models.CreateBoxResponse
+	_, err := c.Call(ctx, &service.Request{
+		Action:  "CreateBox",
+		Version: "2021-12-23",
+		Body:    body,
+	}, &ret)
+	return ret, err
+}
+
+// CreateReply calls the CreateReply Action of version 2021-12-23.
+func (c *Client) CreateReply(ctx context.Context, body *models.CreateReplyRequest) (*models.CreateReplyResponse, error) {
+	var ret *models.CreateReplyResponse
+	_, err := c.Call(ctx, &service.Request{
+		Action:  "CreateReply",
+		Version: "2021-12-23",
+		Body:    body,
+	}, &ret)
+	return ret, err
+}
+
+// DeleteBox calls the DeleteBox Action of version 2021-12-23.
+func (c *Client) DeleteBox(ctx context.Context, body *models.DeleteBoxRequest) (models.DeleteBoxResponse, error) {
+	var ret models.DeleteBoxResponse
+	_, err := c.Call(ctx, &service.Request{
+		Action:  "DeleteBox",
+		Version: "2021-12-23",
+		Body:    body,
+	}, &ret)
+	return ret, err
+}
+
+// DescribeAPI calls the DescribeAPI Action of version 2021-12-23.
+func (c *Client) DescribeAPI(ctx context.Context) (*openapi.Document, error) {
+	var ret *openapi.Document
+	_, err := c.Call(ctx, &service.Request{
+		Action:  "DescribeAPI",
+		Version: "2021-12-23",
+	}, &ret)
+	return ret, err
+}
+
+// GetBox calls the GetBox Action of version 2021-12-23.
+func (c *Client) GetBox(ctx context.Context, body *models.GetBoxRequest) (*models.GetBoxResponse, error) {
+	var ret *models.GetBoxResponse
+	_, err := c.Call(ctx, &service.Request{
+		Action:  "GetBox",
+		Version: "2021-12-23",
+		Body:    body,
+	}, &ret)
+	return ret, err
+}
+
+// HideBox calls the HideBox Action of version 2021-12-23.
+func (c *Client) HideBox(ctx context.Context, body *models.HideBoxRequest) (*models.HideBoxResponse, error) {
+	var ret *models.HideBoxResponse
+	_, err := c.Call(ctx, &service.Request{
+		Action:  "HideBox",
+		Version: "2021-12-23",
+		Body:    body,
+	}, &ret)
+	return ret, err
+}
+
+// ListBoxes calls the ListBoxes Action of version 2021-12-23.
+func (c *Client) ListBoxes(ctx context.Context, body *models.ListBoxesRequest) (*models.ListBoxesResponse, error) {
+	var ret *models.ListBoxesResponse
+	_, err := c.Call(ctx, &service.Request{
+		Action:  "ListBoxes",
+		Version: "2021-12-23",
+		Body:    body,
+	}, &ret)
+	return ret, err
+}
+
+// ListReplies calls the ListReplies Action of version 2021-12-23.
+func (c *Client) ListReplies(ctx context.Context, body *models.ListRepliesRequest) (*models.ListRepliesResponse, error) {
+	var ret *models.ListRepliesResponse
+	_, err := c.Call(ctx, &service.Request{
+		Action:  "ListReplies",
+		Version: "2021-12-23",
+		Body:    body,
+	}, &ret)
+	return ret, err
+}
+
+// ListReportedBoxes calls the ListReportedBoxes Action of version 2021-12-23.
+func (c *Client) ListReportedBoxes(ctx context.Context, body *models.ListReportedBoxesRequest) (*models.ListReportedBoxesResponse, error) {
+	var ret *models.ListReportedBoxesResponse
+	_, err := c.Call(ctx, &service.Request{
+		Action:  "ListReportedBoxes",
+		Version: "2021-12-23",
+		Body:    body,
+	}, &ret)
+	return ret, err
+}
+
+// PurgeBox calls the PurgeBox Action of version 2021-12-23.
+func (c *Client) PurgeBox(ctx context.Context, body *models.PurgeBoxRequest) (models.PurgeBoxResponse, error) {
+	var ret models.PurgeBoxResponse
+	_, err := c.Call(ctx, &service.Request{
+		Action:  "PurgeBox",
+		Version: "2021-12-23",
+		Body:    body,
+	}, &ret)
+	return ret, err
+}
+
+// ReportBox calls the ReportBox Action of version 2021-12-23.
+func (c *Client) ReportBox(ctx context.Context, xReporterFingerprint string, body *models.ReportBoxRequest) (*models.ReportBoxResponse, error) {
+	var ret *models.ReportBoxResponse
+	_, err := c.Call(ctx, &service.Request{
+		Action:  "ReportBox",
+		Version: "2021-12-23",
+		Header: map[string]interface{}{
+			"X-Reporter-Fingerprint": xReporterFingerprint,
+		},
+		Body: body,
+	}, &ret)
+	return ret, err
+}
+
+// UnhideBox calls the UnhideBox Action of version 2021-12-23.
+func (c *Client) UnhideBox(ctx context.Context, body *models.UnhideBoxRequest) (*models.UnhideBoxResponse, error) {
+	var ret *models.UnhideBoxResponse
+	_, err := c.Call(ctx, &service.Request{
+		Action:  "UnhideBox",
+		Version: "2021-12-23",
+		Body:    body,
+	}, &ret)
+	return ret, err
+}
+
+// UpdateBox calls the UpdateBox Action of version 2021-12-23.
+func (c *Client) UpdateBox(ctx context.Context, body *models.UpdateBoxRequest) (*models.UpdateBoxResponse, error) {
+	var ret *models.UpdateBoxResponse
+	_, err := c.Call(ctx, &service.Request{
+		Action:  "UpdateBox",
+		Version: "2021-12-23",
+		Body:    body,
+	}, &ret)
+	return ret, err
+}
+
+// ViewBox calls the ViewBox Action of version 2021-12-23.
+func (c *Client) ViewBox(ctx context.Context, xViewerId string) (*models.ViewBoxResponse, error) {
+	var ret *models.ViewBoxResponse
+	_, err := c.Call(ctx, &service.Request{
+		Action:  "ViewBox",
+		Version: "2021-12-23",
+		Header: map[string]interface{}{
+			"X-Viewer-Id": xViewerId,
+		},
+	}, &ret)
+	return ret, err
+}
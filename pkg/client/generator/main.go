@@ -0,0 +1,30 @@
+package main
+
+import (
+	"io/ioutil"
+
+	"github.com/lichuan0620/secret-keeper-backend/cmd/server/service"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/clientgen"
+	"github.com/pkg/errors"
+)
+
+func genClient() error {
+	source, err := clientgen.Generate(service.NewBuilder(&service.Options{}).Actions(), &clientgen.Options{
+		Package:   "client",
+		TypeName:  "Client",
+		Generator: "client generator",
+	})
+	if err != nil {
+		return errors.WithMessage(err, "gen client")
+	}
+	if err = ioutil.WriteFile("generated.client.go", source, 0644); err != nil {
+		return errors.WithMessage(err, "write file")
+	}
+	return nil
+}
+
+func main() {
+	if err := genClient(); err != nil {
+		panic(err)
+	}
+}
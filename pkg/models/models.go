@@ -6,28 +6,155 @@ const (
 	Version = "2021-12-23"
 )
 
+// BoxStatus is the moderation status of a Box.
+type BoxStatus string
+
+const (
+	// BoxStatusPending means the Box is waiting for review and must not be served.
+	BoxStatusPending BoxStatus = "Pending"
+	// BoxStatusApproved means the Box can be served. Boxes created before moderation was
+	// introduced have no status and are treated as approved.
+	BoxStatusApproved BoxStatus = "Approved"
+	// BoxStatusRejected means the Box has been refused by moderation.
+	BoxStatusRejected BoxStatus = "Rejected"
+	// BoxStatusHidden means the Box has been taken down after being reported.
+	BoxStatusHidden BoxStatus = "Hidden"
+)
+
 type Box struct {
 	Id             string          `json:"Id,omitempty" bson:"_id,omitempty"`
 	CreatedAt      *time.Time      `json:"CreatedAt,omitempty" bson:"CreatedAt,omitempty"`
 	Body           string          `json:"Body,omitempty" bson:"Body,omitempty"`
 	EmojiFeedbacks map[string]uint `json:"EmojiFeedbacks,omitempty" bson:"EmojiFeedbacks,omitempty"`
 	LastViewed     *time.Time      `json:"LastViewed,omitempty" bson:"LastViewed,omitempty"`
+	ExpiresAt      *time.Time      `json:"ExpiresAt,omitempty" bson:"ExpiresAt,omitempty"`
+	MaxViews       uint            `json:"MaxViews,omitempty" bson:"MaxViews,omitempty"`
+	Views          uint            `json:"Views,omitempty" bson:"Views,omitempty"`
+	ReplyCount     uint            `json:"ReplyCount,omitempty" bson:"ReplyCount,omitempty"`
+	Status         BoxStatus       `json:"Status,omitempty" bson:"Status,omitempty"`
+	ReportCount    uint            `json:"ReportCount,omitempty" bson:"ReportCount,omitempty"`
+	ReportReasons  map[string]uint `json:"ReportReasons,omitempty" bson:"ReportReasons,omitempty"`
+	TokenHash      string          `json:"-" bson:"TokenHash,omitempty"`
+	// ModifiedAt is the time of the last change to the Box.
+	ModifiedAt *time.Time `json:"ModifiedAt,omitempty" bson:"ModifiedAt,omitempty"`
+	// Partition is the slot the Box ID hashes to, see internal/shard; it is missing from the
+	// Boxes created before the queue was sharded.
+	Partition *int `json:"-" bson:"Partition,omitempty"`
+}
+
+// Approved tells if the Box has passed moderation.
+func (b *Box) Approved() bool {
+	return b.Status == "" || b.Status == BoxStatusApproved
+}
+
+// Expired tells if the Box has passed its expiration time.
+func (b *Box) Expired(now time.Time) bool {
+	return b.ExpiresAt != nil && !now.Before(*b.ExpiresAt)
+}
+
+// Exhausted tells if the Box has no view left, like QueueItem.Available.
+func (b *Box) Exhausted() bool {
+	return b.MaxViews > 0 && b.Views >= b.MaxViews
+}
+
+// Reply is a response to a Box, or to another Reply of the same Box when ParentId is set.
+type Reply struct {
+	Id         string     `json:"Id,omitempty" bson:"_id,omitempty"`
+	BoxId      string     `json:"BoxId,omitempty" bson:"BoxId,omitempty"`
+	ParentId   string     `json:"ParentId,omitempty" bson:"ParentId"`
+	CreatedAt  *time.Time `json:"CreatedAt,omitempty" bson:"CreatedAt,omitempty"`
+	Body       string     `json:"Body,omitempty" bson:"Body,omitempty"`
+	ReplyCount uint       `json:"ReplyCount,omitempty" bson:"ReplyCount,omitempty"`
+}
+
+// ReportReasons are the accepted values of Report.Reason.
+var ReportReasons = []string{"Spam", "Abuse", "Sexual", "Violence", "SelfHarm", "Other"}
+
+// Report is an abuse report on a Box. Every reporter can only report a Box once.
+type Report struct {
+	// Id is derived from the Box ID and the reporter fingerprint.
+	Id        string     `json:"Id,omitempty" bson:"_id,omitempty"`
+	BoxId     string     `json:"BoxId,omitempty" bson:"BoxId,omitempty"`
+	Reason    string     `json:"Reason,omitempty" bson:"Reason,omitempty"`
+	Comment   string     `json:"Comment,omitempty" bson:"Comment,omitempty"`
+	CreatedAt *time.Time `json:"CreatedAt,omitempty" bson:"CreatedAt,omitempty"`
 }
 
 type QueueItem struct {
-	Id    string `json:"Id"`
-	Score int64  `json:"Score"`
+	Id        string `json:"Id"`
+	Score     int64  `json:"Score"`
+	ExpiresAt int64  `json:"ExpiresAt,omitempty"`
+	MaxViews  uint   `json:"MaxViews,omitempty"`
+	Views     uint   `json:"Views,omitempty"`
+	// Engagement is the total number of emoji feedbacks of the Box.
+	Engagement uint `json:"Engagement,omitempty"`
+	// CreatedAt is the creation time of the Box in Unix nanoseconds.
+	CreatedAt int64 `json:"CreatedAt,omitempty"`
+}
+
+// NewQueueItem builds the QueueItem representing the given Box.
+func NewQueueItem(box *Box) *QueueItem {
+	item := QueueItem{
+		Id:       box.Id,
+		MaxViews: box.MaxViews,
+		Views:    box.Views,
+	}
+	if box.LastViewed != nil {
+		item.Score = box.LastViewed.UnixNano()
+	}
+	if box.ExpiresAt != nil {
+		item.ExpiresAt = box.ExpiresAt.UnixNano()
+	}
+	if box.CreatedAt != nil {
+		item.CreatedAt = box.CreatedAt.UnixNano()
+	}
+	for _, count := range box.EmojiFeedbacks {
+		item.Engagement += count
+	}
+	return &item
+}
+
+// Available tells if the item can still be handed out at the given time (in Unix nanoseconds).
+func (item *QueueItem) Available(now int64) bool {
+	if item.ExpiresAt != 0 && now >= item.ExpiresAt {
+		return false
+	}
+	return item.MaxViews == 0 || item.Views < item.MaxViews
 }
 
 type CreateBoxRequest struct {
-	Body string `json:"Body,omitempty"`
+	Body      string     `json:"Body,omitempty" validate:"required"`
+	ExpiresAt *time.Time `json:"ExpiresAt,omitempty"`
+	MaxViews  uint       `json:"MaxViews,omitempty"`
 }
 
-type CreateBoxResponse Box
+type CreateBoxResponse struct {
+	Box
+	// ManagementToken is required to update or delete the Box later. It is only returned once;
+	// the server keeps nothing but a hash of it.
+	ManagementToken string `json:"ManagementToken"`
+}
+
+type DeleteBoxRequest struct {
+	Id              string `json:"Id,omitempty" validate:"required"`
+	ManagementToken string `json:"ManagementToken,omitempty"`
+}
+
+type DeleteBoxResponse struct{}
+
+type UpdateBoxRequest struct {
+	Id              string `json:"Id,omitempty" validate:"required"`
+	ManagementToken string `json:"ManagementToken,omitempty"`
+	Body            string `json:"Body,omitempty" validate:"required"`
+}
+
+type UpdateBoxResponse Box
 
 type AddBoxEmoji struct {
-	Id             string          `json:"Id,omitempty"`
-	EmojiFeedbacks map[string]uint `json:"EmojiFeedbacks,omitempty"`
+	Id string `json:"Id,omitempty" validate:"required"`
+	// EmojiFeedbacks are named by up to 32 characters other than '.' and '$', which are
+	// reserved in the field names of the database.
+	EmojiFeedbacks map[string]uint `json:"EmojiFeedbacks,omitempty" validate:"max=16,values,max=100,keys,max=32,pattern=^[^.$]+$"`
 }
 
 type AddBoxEmojiRequest AddBoxEmoji
@@ -36,10 +163,132 @@ type AddBoxEmojiResponse AddBoxEmoji
 
 type ViewBoxResponse Box
 
+type ReportBoxRequest struct {
+	Id string `json:"Id,omitempty" validate:"required"`
+	// Reason is one of ReportReasons.
+	Reason  string `json:"Reason,omitempty" validate:"required,oneof=Spam Abuse Sexual Violence SelfHarm Other"`
+	Comment string `json:"Comment,omitempty" validate:"max=500"`
+}
+
+type ReportBoxResponse struct{}
+
+type ListReportedBoxesRequest struct {
+	MinReportCount uint `json:"MinReportCount,omitempty"`
+	Offset         int  `json:"Offset,omitempty" validate:"min=0"`
+	Limit          int  `json:"Limit,omitempty" validate:"min=0,max=100"`
+}
+
+type ListReportedBoxesResponse struct {
+	Boxes []Box `json:"Boxes"`
+}
+
+type ListBoxesRequest struct {
+	CreatedAfter  *time.Time `json:"CreatedAfter,omitempty"`
+	CreatedBefore *time.Time `json:"CreatedBefore,omitempty"`
+	Status        BoxStatus  `json:"Status,omitempty" validate:"oneof=Pending Approved Rejected Hidden"`
+	Emoji         string     `json:"Emoji,omitempty"`
+	MinEmojiCount uint       `json:"MinEmojiCount,omitempty"`
+	Offset        int        `json:"Offset,omitempty" validate:"min=0"`
+	Limit         int        `json:"Limit,omitempty" validate:"min=0,max=100"`
+}
+
+type ListBoxesResponse struct {
+	Boxes []Box `json:"Boxes"`
+}
+
+type GetBoxRequest struct {
+	Id string `json:"Id,omitempty" validate:"required"`
+}
+
+type GetBoxResponse Box
+
+type HideBoxRequest struct {
+	Id string `json:"Id,omitempty" validate:"required"`
+}
+
+type HideBoxResponse Box
+
+type UnhideBoxRequest struct {
+	Id string `json:"Id,omitempty" validate:"required"`
+}
+
+type UnhideBoxResponse Box
+
+type PurgeBoxRequest struct {
+	Id string `json:"Id,omitempty" validate:"required"`
+}
+
+type PurgeBoxResponse struct{}
+
+type CreateReplyRequest struct {
+	BoxId    string `json:"BoxId,omitempty" validate:"required"`
+	ParentId string `json:"ParentId,omitempty"`
+	Body     string `json:"Body,omitempty" validate:"required"`
+}
+
+type CreateReplyResponse Reply
+
+type ListRepliesRequest struct {
+	BoxId    string `json:"BoxId,omitempty" validate:"required"`
+	ParentId string `json:"ParentId,omitempty"`
+	Cursor   string `json:"Cursor,omitempty"`
+	Limit    int    `json:"Limit,omitempty" validate:"min=0,max=100"`
+}
+
+type ListRepliesResponse struct {
+	Replies []Reply `json:"Replies"`
+	// NextCursor is used to fetch the next page; it is empty on the last page.
+	NextCursor string `json:"NextCursor,omitempty"`
+}
+
 type SyncRequest QueueItem
 
 type SyncResponse struct{}
 
+type DequeueRequest struct {
+	ViewerId string `json:"ViewerId,omitempty"`
+	// Strategy overrides the dequeue strategy of the queue, see internal/queue.Strategies.
+	Strategy string `json:"Strategy,omitempty"`
+}
+
 type DequeueResponse struct {
 	Id string `json:"Id"`
 }
+
+type DequeueBatchRequest struct {
+	// Count is the number of Boxes wanted; fewer are returned if the queue runs short.
+	Count    int    `json:"Count" validate:"required,min=1"`
+	Strategy string `json:"Strategy,omitempty"`
+}
+
+type DequeueBatchResponse struct {
+	Ids []string `json:"Ids"`
+}
+
+// View is a view of a Box handed out through DequeueBatch.
+type View struct {
+	Id       string    `json:"Id"`
+	ViewerId string    `json:"ViewerId,omitempty"`
+	ViewedAt time.Time `json:"ViewedAt"`
+}
+
+type RecordViewsRequest struct {
+	Views []View `json:"Views"`
+}
+
+type RecordViewsResponse struct{}
+
+type RemoveRequest struct {
+	Id string `json:"Id"`
+}
+
+type RemoveResponse struct{}
+
+type ResyncRequest struct {
+	// Full rebuilds the queue from every Box instead of reading only the changed ones.
+	Full bool `json:"Full,omitempty"`
+}
+
+type ResyncResponse struct{}
+
+type HealthResponse struct{}
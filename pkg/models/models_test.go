@@ -0,0 +1,21 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestReportReasons checks that ReportBoxRequest accepts exactly the ReportReasons.
+func TestReportReasons(t *testing.T) {
+	field, _ := reflect.TypeOf(ReportBoxRequest{}).FieldByName("Reason")
+	var accepted []string
+	for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+		if strings.HasPrefix(rule, "oneof=") {
+			accepted = strings.Fields(strings.TrimPrefix(rule, "oneof="))
+		}
+	}
+	if !reflect.DeepEqual(accepted, ReportReasons) {
+		t.Fatalf("ReportBoxRequest.Reason accepts %v; expecting ReportReasons %v", accepted, ReportReasons)
+	}
+}
@@ -4,12 +4,30 @@ import (
 	"time"
 
 	"github.com/globalsign/mgo"
+	"github.com/pkg/errors"
 )
 
 const (
 	dbName = "secret-keeper"
 
-	CollectionBox = "box"
+	CollectionBox    = "box"
+	CollectionReply  = "reply"
+	CollectionReport = "report"
+	// CollectionBoxTombstone records deleted Boxes for a while so that incremental readers can
+	// learn about the deletions.
+	CollectionBoxTombstone = "box_tombstone"
+	// CollectionCheckpoint holds the resume tokens of the change stream readers.
+	CollectionCheckpoint = "checkpoint"
+	// CollectionLease holds the leases of the leader elections.
+	CollectionLease = "lease"
+	// CollectionOutbox holds the queue items that are yet to be delivered to the queue.
+	CollectionOutbox = "outbox"
+
+	// TombstoneRetention is how long the tombstone of a deleted Box is kept.
+	TombstoneRetention = 7 * 24 * time.Hour
+	// OutboxRetention is how long an undelivered queue item is kept; the queue has caught up with
+	// its resyncs long before.
+	OutboxRetention = 24 * time.Hour
 )
 
 var baseSession *mgo.Session
@@ -34,6 +52,55 @@ func Init(url string) error {
 		return err
 	}
 	baseSession.SetSyncTimeout(timeout)
+	return ensureIndexes()
+}
+
+func ensureIndexes() error {
+	db := DB()
+	defer db.Session.Close()
+	// Boxes are removed by MongoDB shortly after their ExpiresAt time; boxes without the field
+	// are not affected.
+	if err := db.C(CollectionBox).EnsureIndex(mgo.Index{
+		Key:         []string{"ExpiresAt"},
+		ExpireAfter: time.Second,
+	}); err != nil {
+		return errors.Wrap(err, "ensure Box TTL index")
+	}
+	if err := db.C(CollectionReply).EnsureIndex(mgo.Index{
+		Key: []string{"BoxId", "ParentId", "CreatedAt", "_id"},
+	}); err != nil {
+		return errors.Wrap(err, "ensure Reply listing index")
+	}
+	if err := db.C(CollectionBox).EnsureIndexKey("Partition"); err != nil {
+		return errors.Wrap(err, "ensure Box partition index")
+	}
+	if err := db.C(CollectionBox).EnsureIndexKey("ModifiedAt"); err != nil {
+		return errors.Wrap(err, "ensure Box modification index")
+	}
+	if err := db.C(CollectionBoxTombstone).EnsureIndex(mgo.Index{
+		Key:         []string{"DeletedAt"},
+		ExpireAfter: TombstoneRetention,
+	}); err != nil {
+		return errors.Wrap(err, "ensure Box tombstone TTL index")
+	}
+	if err := db.C(CollectionOutbox).EnsureIndex(mgo.Index{
+		Key:         []string{"PutAt"},
+		ExpireAfter: OutboxRetention,
+	}); err != nil {
+		return errors.Wrap(err, "ensure outbox TTL index")
+	}
+	if err := db.C(CollectionReport).EnsureIndexKey("BoxId"); err != nil {
+		return errors.Wrap(err, "ensure Report index")
+	}
+	if err := db.C(CollectionBox).EnsureIndexKey("-ReportCount"); err != nil {
+		return errors.Wrap(err, "ensure Box report count index")
+	}
+	if err := db.C(CollectionBox).EnsureIndexKey("-CreatedAt", "_id"); err != nil {
+		return errors.Wrap(err, "ensure Box listing index")
+	}
+	if err := db.C(CollectionBox).EnsureIndexKey("LastViewed", "_id"); err != nil {
+		return errors.Wrap(err, "ensure Box view order index")
+	}
 	return nil
 }
 
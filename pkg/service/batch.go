@@ -0,0 +1,179 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/model"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/standard"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/telemetry/log"
+	"github.com/pkg/errors"
+)
+
+// BatchActionName is the name of the built-in Batch Action.
+const BatchActionName = "Batch"
+
+const (
+	defaultBatchMaxEntries  = 20
+	defaultBatchConcurrency = 4
+)
+
+// BatchOptions configure the built-in Batch Action, which takes a model.BatchRequest and makes
+// the request of each of its entries as if it were received on its own, except that they share
+// the header of the Batch request and the GlobalMiddlewares of the Builder only wrap the Batch
+// request. The entries are independent of each other, so they are run concurrently and in no
+// particular order; their responses are returned in a model.BatchResponse.
+type BatchOptions struct {
+	// Version is the version of the Batch Action, and that of the entries not specifying one.
+	Version string
+	// Middlewares wrap the Batch Action; the Middlewares of the Actions wrap every entry.
+	Middlewares []model.Middleware
+	// MaxEntries is the maximum number of entries in a request; a request with more fails with
+	// an ExceededLimit error. It defaults to 20.
+	MaxEntries int
+	// Concurrency is the maximum number of entries run at the same time; it defaults to 4.
+	Concurrency int
+}
+
+type batch struct {
+	version     string
+	maxEntries  int
+	concurrency int
+	// handlers are those of the Builder, by indexAction
+	handlers map[uint64]http.Handler
+}
+
+// batchAction returns the Batch Action dispatching the entries to the given handlers.
+func (builder *Builder) batchAction(handlers map[uint64]http.Handler) model.Action {
+	b := &batch{
+		version:     builder.Batch.Version,
+		maxEntries:  builder.Batch.MaxEntries,
+		concurrency: builder.Batch.Concurrency,
+		handlers:    handlers,
+	}
+	if b.maxEntries <= 0 {
+		b.maxEntries = defaultBatchMaxEntries
+	}
+	if b.concurrency <= 0 {
+		b.concurrency = defaultBatchConcurrency
+	}
+	action := TypedAction(BatchActionName, b.serve)
+	action.Version = b.version
+	return action
+}
+
+func (b *batch) serve(ctx context.Context, req *model.BatchRequest) (*model.BatchResponse, standard.Error) {
+	if len(req.Entries) > b.maxEntries {
+		return nil, standard.ExceededLimit("BatchEntries")
+	}
+	ret := &model.BatchResponse{
+		Responses: make([]model.Response, len(req.Entries)),
+	}
+	header := GetHeader(ctx)
+	sem := make(chan struct{}, b.concurrency)
+	var wg sync.WaitGroup
+	for i := range req.Entries {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(entry *model.BatchEntry, resp *model.Response) {
+			defer func() {
+				// a panic would otherwise bring down the server, not just the request
+				if r := recover(); r != nil {
+					log.FromContext(ctx).Error(errors.Errorf("%v", r), "panic serving batch entry", "action", entry.Action)
+					*resp = model.Response{Metadata: resp.Metadata}
+					setError(resp, standard.InternalServiceError())
+				}
+				<-sem
+				wg.Done()
+			}()
+			b.serveEntry(ctx, header, entry, resp)
+		}(&req.Entries[i], &ret.Responses[i])
+	}
+	wg.Wait()
+	return ret, nil
+}
+
+// serveEntry makes the request of an entry and writes its response into resp.
+func (b *batch) serveEntry(ctx context.Context, header http.Header, entry *model.BatchEntry, resp *model.Response) {
+	version := entry.Version
+	if version == "" {
+		version = b.version
+	}
+	resp.Metadata = model.ResponseMetadata{
+		Action:  entry.Action,
+		Version: version,
+	}
+	handler, exists := b.handlers[indexAction(entry.Action, version)]
+	if !exists || (entry.Action == BatchActionName && version == b.version) {
+		setError(resp, standard.InvalidActionOrVersion(entry.Action, version))
+		return
+	}
+	var body []byte
+	if entry.Body != nil {
+		var err error
+		if body, err = json.Marshal(entry.Body); err != nil {
+			setError(resp, standard.MalformedParameter("Body"))
+			return
+		}
+	}
+
+	query := make(url.Values, len(entry.Params)+2)
+	for k, v := range entry.Params {
+		query.Set(k, v)
+	}
+	query.Set(model.QueryParameterAction, entry.Action)
+	query.Set(model.QueryParameterVersion, version)
+	entryHeader := header.Clone()
+	if entryHeader == nil {
+		entryHeader = make(http.Header)
+	}
+	entryHeader.Del("Content-Length")
+	entryHeader.Del(model.HeaderContentEncoding)
+	entryHeader.Set(model.HeaderContentType, model.ContentTypeJSON)
+	entryCtx, _ := newRequestContext(ctx, query, entryHeader, entry.Action, version)
+	req, err := http.NewRequestWithContext(entryCtx, http.MethodPost, "/?"+query.Encode(), bytes.NewReader(body))
+	if err != nil {
+		setError(resp, standard.InternalServiceError())
+		return
+	}
+	req.Header = entryHeader
+
+	w := &entryWriter{header: make(http.Header), resp: resp}
+	handler.ServeHTTP(w, req)
+	if !w.written {
+		// the response was not written by writeResponse
+		setError(resp, standard.InternalServiceError())
+	}
+}
+
+// entryWriter is the http.ResponseWriter of a batch entry; writeResponse keeps the response in it
+// instead of encoding it.
+type entryWriter struct {
+	header  http.Header
+	resp    *model.Response
+	written bool
+}
+
+func (w *entryWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *entryWriter) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func (w *entryWriter) WriteHeader(int) {}
+
+// keep copies a response, which may be reused once written.
+func (w *entryWriter) keep(resp *model.Response) {
+	*w.resp = *resp
+	if resp.Error != nil {
+		copied := *resp.Error
+		w.resp.Error = &copied
+	}
+	w.written = true
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/model"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/standard"
+)
+
+func TestBatch(t *testing.T) {
+	var (
+		calls             int32
+		active, maxActive int32
+		mu                sync.Mutex
+	)
+	builder := &Builder{
+		Batch: &BatchOptions{
+			Version:     "20211206",
+			MaxEntries:  8,
+			Concurrency: 2,
+		},
+	}
+	h, err := builder.AddActionGroup(model.ActionGroup{
+		Mutator: func(action *model.Action) {
+			action.Version = "20211206"
+		},
+		Middlewares: []model.Middleware{
+			func(ctx context.Context, next func(context.Context)) {
+				atomic.AddInt32(&calls, 1)
+				next(ctx)
+			},
+		},
+		Actions: []model.Action{
+			TypedAction("Greet", greet),
+			{
+				Name: "Wait",
+				Parameters: []model.Parameter{{
+					Source: model.ParameterSourceQuery,
+					Name:   "Name",
+				}},
+				Handler: func(_ context.Context, name string) (*greetResponse, standard.Error) {
+					n := atomic.AddInt32(&active, 1)
+					mu.Lock()
+					if n > maxActive {
+						maxActive = n
+					}
+					mu.Unlock()
+					time.Sleep(10 * time.Millisecond)
+					atomic.AddInt32(&active, -1)
+					return &greetResponse{Greeting: "bye " + name}, nil
+				},
+			},
+		},
+	}).Build()
+	if err != nil {
+		t.Fatalf("build error: %v", err)
+	}
+	if actions := builder.Actions(); actions[len(actions)-1].Name != BatchActionName {
+		t.Fatalf("expecting the Batch Action among the Actions")
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+	c := NewClient(server.URL, nil)
+	call := func(entries ...model.BatchEntry) (*model.BatchResponse, error) {
+		var resp *model.BatchResponse
+		_, err := c.Call(context.Background(), &Request{
+			Action:  BatchActionName,
+			Version: "20211206",
+			Body:    &model.BatchRequest{Entries: entries},
+		}, &resp)
+		return resp, err
+	}
+
+	resp, err := call(
+		model.BatchEntry{Action: "Greet", Body: &greetRequest{Name: "world"}},
+		model.BatchEntry{Action: "Greet", Body: &greetRequest{Name: "nobody"}},
+		model.BatchEntry{Action: "Greet", Body: &greetRequest{}},
+		model.BatchEntry{Action: "Wait", Params: map[string]string{"Name": "world"}},
+		model.BatchEntry{Action: "Greet", Version: "20200101"},
+		model.BatchEntry{Action: BatchActionName, Body: &model.BatchRequest{}},
+	)
+	if err != nil {
+		t.Fatalf("call: %v", err)
+	}
+	for i, expected := range []struct {
+		Code     string
+		Greeting string
+	}{
+		{Greeting: "hello world"},
+		{Code: "ResourceNotFound"},
+		{Code: "InvalidParameter"},
+		{Greeting: "bye world"},
+		{Code: "InvalidActionOrVersion"},
+		{Code: "InvalidActionOrVersion"},
+	} {
+		got := resp.Responses[i]
+		if got.Metadata.Version == "" {
+			t.Errorf("entry %d: missing metadata", i)
+		}
+		if expected.Code != "" {
+			if got.Error == nil || got.Error.Code != expected.Code {
+				t.Errorf("entry %d: expecting error %s; got %+v", i, expected.Code, got.Error)
+			}
+			continue
+		}
+		if got.Error != nil {
+			t.Errorf("entry %d: unexpected error %+v", i, got.Error)
+		} else if greeting := got.Result.(map[string]interface{})["Greeting"]; greeting != expected.Greeting {
+			t.Errorf("entry %d: expecting %s; got %v", i, expected.Greeting, greeting)
+		}
+	}
+	// the middlewares of the Actions wrap every entry reaching them
+	if calls != 4 {
+		t.Fatalf("expecting the middleware to be called 4 times; got %d", calls)
+	}
+
+	var entries []model.BatchEntry
+	for i := 0; i < 8; i++ {
+		entries = append(entries, model.BatchEntry{Action: "Wait", Params: map[string]string{"Name": "world"}})
+	}
+	if _, err = call(entries...); err != nil {
+		t.Fatalf("call: %v", err)
+	}
+	if maxActive > 2 {
+		t.Fatalf("expecting at most 2 entries at the same time; got %d", maxActive)
+	}
+
+	for _, tc := range []struct {
+		Entries    []model.BatchEntry
+		ExpectCode string
+	}{
+		{Entries: append(entries, model.BatchEntry{Action: "Wait"}), ExpectCode: "ExceededLimit"},
+		{Entries: nil, ExpectCode: "InvalidParameter"},
+		{Entries: []model.BatchEntry{{}}, ExpectCode: "InvalidParameter"},
+	} {
+		_, err = call(tc.Entries...)
+		if callErr, ok := err.(*CallError); !ok || callErr.Err.GetCode() != tc.ExpectCode {
+			t.Errorf("%d entries: expecting %s; got %v", len(tc.Entries), tc.ExpectCode, err)
+		}
+	}
+}
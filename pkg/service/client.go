@@ -0,0 +1,165 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"time"
+
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/model"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/standard"
+	"github.com/pkg/errors"
+)
+
+// ClientOptions configure a Client; the zero value is valid.
+type ClientOptions struct {
+	// HTTPClient sends the requests; http.DefaultClient is used if it is nil.
+	HTTPClient *http.Client
+	// Header is added to every request, e.g. to carry an Authorization header.
+	Header http.Header
+}
+
+// Client calls the Actions of a service built with Builder: every call is a POST request to the
+// endpoint with the Action and Version in the query string, answered with a model.Response.
+type Client struct {
+	endpoint string
+	client   *http.Client
+	header   http.Header
+}
+
+// NewClient returns a Client calling the service at the given URL.
+func NewClient(endpoint string, opts *ClientOptions) *Client {
+	if opts == nil {
+		opts = &ClientOptions{}
+	}
+	ret := &Client{
+		endpoint: endpoint,
+		client:   opts.HTTPClient,
+		header:   opts.Header,
+	}
+	if ret.client == nil {
+		ret.client = http.DefaultClient
+	}
+	return ret
+}
+
+// Request is a call to an Action.
+type Request struct {
+	Action, Version string
+	// Query and Header hold the values of the Query and Header Parameters by their names. The
+	// values are formatted the way the Converters parse them; nil pointers are left out.
+	Query  map[string]interface{}
+	Header map[string]interface{}
+	// Body is sent as JSON unless it is nil.
+	Body interface{}
+}
+
+// CallError is returned by Client when an Action fails.
+type CallError struct {
+	Action, Version string
+	// Err is the standard.Error rebuilt from the response. Its Code is empty if the response
+	// carries no standard error, e.g. when it comes from a proxy in front of the service.
+	Err standard.Error
+}
+
+func (e *CallError) Error() string {
+	return fmt.Sprintf("action %s version %s failed with status %d: %s: %s",
+		e.Action, e.Version, e.Err.GetHTTPCode(), e.Err.GetCode(), e.Err.GetMessage())
+}
+
+// Call calls an Action and decodes the Result of the response into result, unless it is nil. It
+// returns a *CallError if the Action fails, and other errors if the call does not go through.
+func (c *Client) Call(ctx context.Context, req *Request, result interface{}) (model.ResponseMetadata, error) {
+	var body io.Reader
+	if req.Body != nil {
+		encoded, err := json.Marshal(req.Body)
+		if err != nil {
+			return model.ResponseMetadata{}, errors.Wrap(err, "encode JSON object")
+		}
+		body = bytes.NewReader(encoded)
+	}
+	query := url.Values{
+		model.QueryParameterAction:  []string{req.Action},
+		model.QueryParameterVersion: []string{req.Version},
+	}
+	for name, value := range req.Query {
+		if values := formatParameter(value); values != nil {
+			query[name] = values
+		}
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, c.endpoint+"?"+query.Encode(), body)
+	if err != nil {
+		return model.ResponseMetadata{}, errors.Wrapf(err, "build request for action %s", req.Action)
+	}
+	for name, values := range c.header {
+		httpReq.Header[name] = values
+	}
+	for name, value := range req.Header {
+		for _, v := range formatParameter(value) {
+			httpReq.Header.Add(name, v)
+		}
+	}
+	httpReq.Header.Set(model.HeaderContentType, model.ContentTypeJSON)
+	httpReq.Header.Set(model.HeaderAccept, model.ContentTypeCompactJSON)
+	resp, err := c.client.Do(httpReq.WithContext(ctx))
+	if err != nil {
+		return model.ResponseMetadata{}, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return model.ResponseMetadata{}, errors.Wrap(err, "read response body")
+	}
+	response := model.Response{Result: result}
+	decodeErr := json.Unmarshal(respBody, &response)
+	if resp.StatusCode != http.StatusOK {
+		callErr := &CallError{Action: req.Action, Version: req.Version}
+		if decodeErr == nil && response.Error != nil {
+			callErr.Err = standard.NewError(resp.StatusCode,
+				response.Error.Code, response.Error.Message, response.Error.Data)
+		} else {
+			callErr.Err = standard.NewError(resp.StatusCode, "", http.StatusText(resp.StatusCode), nil)
+		}
+		return response.Metadata, callErr
+	}
+	if decodeErr != nil {
+		return model.ResponseMetadata{}, errors.Wrap(decodeErr, "decode JSON object")
+	}
+	return response.Metadata, nil
+}
+
+// formatParameter formats the value of a Query or Header Parameter the way its Converter parses
+// it; it returns nil for a nil pointer.
+func formatParameter(value interface{}) []string {
+	switch v := value.(type) {
+	case time.Time:
+		return []string{v.Format(time.RFC3339Nano)}
+	case time.Duration:
+		return []string{v.String()}
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return nil
+		}
+		return formatParameter(rv.Elem().Interface())
+	case reflect.Slice:
+		ret := make([]string, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			ret = append(ret, formatParameter(rv.Index(i).Interface())...)
+		}
+		return ret
+	}
+	return []string{fmt.Sprint(value)}
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/model"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/standard"
+	"github.com/pkg/errors"
+)
+
+type echoed struct {
+	Count  int
+	Since  time.Time
+	Tags   []string
+	Name   *string
+	Token  string
+	Body   map[string]string
+	Header string
+}
+
+func TestClient(t *testing.T) {
+	const action, version = "Echo", "20211206"
+	h, err := (&Builder{}).AddActionGroup(model.ActionGroup{
+		Actions: []model.Action{{
+			Name:    action,
+			Version: version,
+			Parameters: []model.Parameter{
+				{Source: model.ParameterSourceQuery, Name: "Count"},
+				{Source: model.ParameterSourceQuery, Name: "Since"},
+				{Source: model.ParameterSourceQuery, Name: "Tags"},
+				{Source: model.ParameterSourceQuery, Name: "Name", Optional: true},
+				{Source: model.ParameterSourceHeader, Name: "X-Token"},
+				{Source: model.ParameterSourceBody, Name: "Body"},
+			},
+			Handler: func(ctx context.Context, count int, since time.Time, tags []string, name *string, token string, body map[string]string) (*echoed, standard.Error) {
+				if count < 0 {
+					return nil, standard.InvalidParameter("Count")
+				}
+				return &echoed{
+					Count:  count,
+					Since:  since,
+					Tags:   tags,
+					Name:   name,
+					Token:  token,
+					Body:   body,
+					Header: GetHeader(ctx).Get("Authorization"),
+				}, nil
+			},
+		}},
+	}).Build()
+	if err != nil {
+		t.Fatalf("build error: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+	c := NewClient(server.URL, &ClientOptions{Header: http.Header{"Authorization": []string{"Bearer secret"}}})
+
+	since := time.Date(2021, 12, 6, 8, 0, 0, 0, time.UTC)
+	req := &Request{
+		Action:  action,
+		Version: version,
+		Query: map[string]interface{}{
+			"Count": 3,
+			"Since": since,
+			"Tags":  []string{"a", "b"},
+			"Name":  (*string)(nil),
+		},
+		Header: map[string]interface{}{"X-Token": "token"},
+		Body:   map[string]string{"key": "value"},
+	}
+	var result echoed
+	metadata, err := c.Call(context.Background(), req, &result)
+	if err != nil {
+		t.Fatalf("call: %v", err)
+	}
+	expected := echoed{
+		Count:  3,
+		Since:  since,
+		Tags:   []string{"a", "b"},
+		Token:  "token",
+		Body:   map[string]string{"key": "value"},
+		Header: "Bearer secret",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("expecting %+v; got %+v", expected, result)
+	}
+	if metadata.Action != action || metadata.Version != version {
+		t.Fatalf("unexpected metadata: %+v", metadata)
+	}
+
+	// the standard error is rebuilt from the response
+	req.Query["Count"] = -1
+	_, err = c.Call(context.Background(), req, nil)
+	var callErr *CallError
+	if !errors.As(err, &callErr) {
+		t.Fatalf("expecting a CallError; got %v", err)
+	}
+	if expectedErr := standard.InvalidParameter("Count"); callErr.Err.GetCode() != expectedErr.GetCode() ||
+		callErr.Err.GetHTTPCode() != expectedErr.GetHTTPCode() ||
+		!reflect.DeepEqual(callErr.Err.GetData(), expectedErr.GetData()) {
+		t.Fatalf("expecting %+v; got %+v", expectedErr, callErr.Err)
+	}
+	_, err = c.Call(context.Background(), &Request{Action: "Unknown", Version: version}, nil)
+	if !errors.As(err, &callErr) || callErr.Err.GetCode() != standard.InvalidActionOrVersion("", "").GetCode() {
+		t.Fatalf("expecting InvalidActionOrVersion; got %v", err)
+	}
+}
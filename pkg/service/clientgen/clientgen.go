@@ -0,0 +1,272 @@
+// Package clientgen generates typed Go clients for the Actions registered to a service.Builder.
+// Every Action becomes a method that takes its Parameters as arguments, in order, and returns its
+// result type, on a struct embedding a *service.Client.
+package clientgen
+
+import (
+	"bytes"
+	"go/format"
+	"go/token"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/model"
+	"github.com/pkg/errors"
+)
+
+const servicePackage = "github.com/lichuan0620/secret-keeper-backend/pkg/service"
+
+// Options configure the generated code.
+type Options struct {
+	// Package is the name of the package of the generated file.
+	Package string
+	// TypeName is the name of the generated client type; it defaults to Client.
+	TypeName string
+	// Generator is named in the header of the generated file; it defaults to clientgen.
+	Generator string
+}
+
+type file struct {
+	Package, TypeName, Generator string
+	Imports                      []imported
+	Methods                      []method
+}
+
+type imported struct {
+	Alias, Path string
+}
+
+type method struct {
+	Name, Action, Version string
+	Params                []param
+	Result                string
+	Body                  string
+	Query, Header         []param
+}
+
+type param struct {
+	Name, Type, Key string
+}
+
+var fileTemplate = template.Must(template.New("client").Parse(`// Code generated by {{ .Generator }}. DO NOT EDIT.
+
+package {{ .Package }}
+
+import (
+	"context"
+{{ range .Imports }}
+	{{ if .Alias }}{{ .Alias }} {{ end }}"{{ .Path }}"
+{{- end }}
+)
+
+// {{ .TypeName }} calls the Actions of the service.
+type {{ .TypeName }} struct {
+	*service.Client
+}
+
+// New{{ .TypeName }} returns the {{ .TypeName }} making the calls with c.
+func New{{ .TypeName }}(c *service.Client) *{{ .TypeName }} {
+	return &{{ .TypeName }}{Client: c}
+}
+{{ range .Methods }}
+// {{ .Name }} calls the {{ .Action }} Action of version {{ .Version }}.
+func (c *{{ $.TypeName }}) {{ .Name }}(ctx context.Context{{ range .Params }}, {{ .Name }} {{ .Type }}{{ end }}) ({{ .Result }}, error) {
+	var ret {{ .Result }}
+	_, err := c.Call(ctx, &service.Request{
+		Action:  "{{ .Action }}",
+		Version: "{{ .Version }}",
+{{- if .Query }}
+		Query: map[string]interface{}{
+{{- range .Query }}
+			"{{ .Key }}": {{ .Name }},
+{{- end }}
+		},
+{{- end }}
+{{- if .Header }}
+		Header: map[string]interface{}{
+{{- range .Header }}
+			"{{ .Key }}": {{ .Name }},
+{{- end }}
+		},
+{{- end }}
+{{- if .Body }}
+		Body: {{ .Body }},
+{{- end }}
+	}, &ret)
+	return ret, err
+}
+{{ end -}}
+`))
+
+// Generate returns the source of a client for the given Actions, e.g. those of
+// service.Builder.Actions, formatted with gofmt.
+func Generate(actions []model.Action, opts *Options) ([]byte, error) {
+	if opts == nil || opts.Package == "" {
+		return nil, errors.New("missing package name")
+	}
+	data := file{
+		Package:   opts.Package,
+		TypeName:  opts.TypeName,
+		Generator: opts.Generator,
+	}
+	if data.TypeName == "" {
+		data.TypeName = "Client"
+	}
+	if data.Generator == "" {
+		data.Generator = "clientgen"
+	}
+	imports := importSet{"service": servicePackage}
+	versions := make(map[string]int)
+	for i := range actions {
+		versions[actions[i].Name]++
+	}
+	for i := range actions {
+		m, err := buildMethod(&actions[i], imports)
+		if err != nil {
+			return nil, errors.Wrapf(err, "action %s version %s", actions[i].Name, actions[i].Version)
+		}
+		// an Action registered with several versions gets a method for each of them
+		if versions[m.Action] > 1 {
+			m.Name += "V" + m.Version
+		}
+		data.Methods = append(data.Methods, m)
+	}
+	sort.Slice(data.Methods, func(i, j int) bool {
+		return data.Methods[i].Name < data.Methods[j].Name
+	})
+	for alias, pkgPath := range imports {
+		if path.Base(pkgPath) == alias {
+			alias = ""
+		}
+		data.Imports = append(data.Imports, imported{Alias: alias, Path: pkgPath})
+	}
+	sort.Slice(data.Imports, func(i, j int) bool {
+		return data.Imports[i].Path < data.Imports[j].Path
+	})
+	var buf bytes.Buffer
+	if err := fileTemplate.Execute(&buf, &data); err != nil {
+		return nil, errors.Wrap(err, "execute template")
+	}
+	ret, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(err, "format generated code")
+	}
+	return ret, nil
+}
+
+func buildMethod(action *model.Action, imports importSet) (method, error) {
+	ret := method{
+		Name:    exported(action.Name),
+		Action:  action.Name,
+		Version: action.Version,
+	}
+	handler := reflect.TypeOf(action.Handler)
+	if handler == nil || handler.Kind() != reflect.Func {
+		return ret, errors.New("handler must be a function")
+	}
+	if handler.NumIn() != len(action.Parameters)+1 || handler.NumOut() != 2 {
+		return ret, errors.New("handler does not match the parameters")
+	}
+	var err error
+	if ret.Result, err = imports.typeName(handler.Out(0)); err != nil {
+		return ret, err
+	}
+	names := map[string]bool{"ctx": true, "c": true, "ret": true, "err": true}
+	for i := range action.Parameters {
+		parameter := &action.Parameters[i]
+		p := param{Name: unexported(parameter.Name), Key: parameter.Name}
+		for names[p.Name] || token.Lookup(p.Name).IsKeyword() {
+			p.Name += "Param"
+		}
+		names[p.Name] = true
+		if p.Type, err = imports.typeName(handler.In(i + 1)); err != nil {
+			return ret, err
+		}
+		ret.Params = append(ret.Params, p)
+		switch parameter.Source {
+		case model.ParameterSourceQuery:
+			ret.Query = append(ret.Query, p)
+		case model.ParameterSourceHeader:
+			ret.Header = append(ret.Header, p)
+		case model.ParameterSourceBody:
+			ret.Body = p.Name
+		default:
+			return ret, errors.Errorf("invalid source for parameter %s", parameter.Name)
+		}
+	}
+	return ret, nil
+}
+
+// importSet maps the aliases of the imported packages to their paths.
+type importSet map[string]string
+
+// typeName returns the name of a type in the generated code, importing its package if needed.
+func (s importSet) typeName(t reflect.Type) (string, error) {
+	if t.Name() != "" {
+		if t.PkgPath() == "" {
+			return t.Name(), nil
+		}
+		if !token.IsExported(t.Name()) {
+			return "", errors.Errorf("unexported type %s", t)
+		}
+		// the package name is not known from the path, but it prefixes the name of the type
+		name := strings.SplitN(t.String(), ".", 2)[0]
+		alias := name
+		for i := 2; s[alias] != "" && s[alias] != t.PkgPath(); i++ {
+			alias = name + strconv.Itoa(i)
+		}
+		s[alias] = t.PkgPath()
+		return alias + "." + t.Name(), nil
+	}
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice:
+		elem, err := s.typeName(t.Elem())
+		if err != nil {
+			return "", err
+		}
+		if t.Kind() == reflect.Ptr {
+			return "*" + elem, nil
+		}
+		return "[]" + elem, nil
+	case reflect.Map:
+		key, err := s.typeName(t.Key())
+		if err != nil {
+			return "", err
+		}
+		elem, err := s.typeName(t.Elem())
+		if err != nil {
+			return "", err
+		}
+		return "map[" + key + "]" + elem, nil
+	}
+	return "", errors.Errorf("unsupported type %s", t)
+}
+
+// unexported turns a Parameter name, e.g. ViewerId or X-Viewer-Id, into an argument name.
+func unexported(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i := range words {
+		if i == 0 {
+			words[i] = strings.ToLower(words[i][:1]) + words[i][1:]
+		} else {
+			words[i] = strings.ToUpper(words[i][:1]) + words[i][1:]
+		}
+	}
+	ret := strings.Join(words, "")
+	if ret == "" || unicode.IsDigit(rune(ret[0])) {
+		ret = "p" + ret
+	}
+	return ret
+}
+
+func exported(name string) string {
+	ret := unexported(name)
+	return strings.ToUpper(ret[:1]) + ret[1:]
+}
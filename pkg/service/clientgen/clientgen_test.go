@@ -0,0 +1,87 @@
+package clientgen
+
+import (
+	"context"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/model"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/standard"
+)
+
+type Result struct{}
+
+type result struct{}
+
+func TestGenerate(t *testing.T) {
+	actions := []model.Action{
+		{
+			Name:    "View",
+			Version: "20211206",
+			Parameters: []model.Parameter{
+				{Source: model.ParameterSourceHeader, Name: "X-Viewer-Id"},
+				{Source: model.ParameterSourceQuery, Name: "type"},
+				{Source: model.ParameterSourceQuery, Name: "Since"},
+			},
+			Handler: func(context.Context, string, *string, time.Time) (*Result, standard.Error) {
+				return nil, nil
+			},
+		},
+		{
+			Name:       "List",
+			Version:    "20211206",
+			Parameters: []model.Parameter{{Source: model.ParameterSourceBody, Name: "Body"}},
+			Handler: func(context.Context, map[string][]int) ([]Result, standard.Error) {
+				return nil, nil
+			},
+		},
+		{
+			Name:    "List",
+			Version: "20220101",
+			Handler: func(context.Context) (Result, standard.Error) {
+				return Result{}, nil
+			},
+		},
+	}
+	source, err := Generate(actions, &Options{Package: "example"})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if _, err = parser.ParseFile(token.NewFileSet(), "", source, 0); err != nil {
+		t.Fatalf("generated code does not parse: %v\n%s", err, source)
+	}
+	for _, expected := range []string{
+		`"github.com/lichuan0620/secret-keeper-backend/pkg/service/clientgen"`,
+		`"time"`,
+		"func NewClient(c *service.Client) *Client {",
+		"func (c *Client) View(ctx context.Context, xViewerId string, typeParam *string, since time.Time) (*clientgen.Result, error) {",
+		`"X-Viewer-Id": xViewerId,`,
+		`"type":  typeParam,`,
+		"func (c *Client) ListV20211206(ctx context.Context, body map[string][]int) ([]clientgen.Result, error) {",
+		"func (c *Client) ListV20220101(ctx context.Context) (clientgen.Result, error) {",
+	} {
+		if !strings.Contains(string(source), expected) {
+			t.Fatalf("expecting %s in the generated code:\n%s", expected, source)
+		}
+	}
+
+	if _, err = Generate(actions, nil); err == nil {
+		t.Fatal("expecting an error without a package name")
+	}
+	for _, handler := range []interface{}{
+		func(context.Context, struct{}, *string, time.Time) (*Result, standard.Error) {
+			return nil, nil
+		},
+		func(context.Context, string, *string, time.Time) (*result, standard.Error) {
+			return nil, nil
+		},
+	} {
+		actions[0].Handler = handler
+		if _, err = Generate(actions, &Options{Package: "example"}); err == nil {
+			t.Fatalf("expecting an error for handler %T", handler)
+		}
+	}
+}
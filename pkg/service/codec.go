@@ -0,0 +1,298 @@
+package service
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/model"
+	"github.com/pkg/errors"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec encodes and decodes the bodies of a media type. The codec of a request body is chosen by
+// its Content-Type, and that of a response by the Accept header of the request.
+type Codec struct {
+	// ContentType is the media type of the bodies. Its parameters must be in the Accept header
+	// for the codec to be chosen for a response, e.g. model.ContentTypeCompactJSON; they are
+	// ignored for request bodies.
+	ContentType string
+	// Decode decodes a request body into the value pointed to by v; it is nil if request bodies
+	// cannot be of the type.
+	Decode func(r io.Reader, v interface{}) error
+	// Encode encodes a response, a *model.Response; it is nil if responses cannot be of the type.
+	Encode func(w io.Writer, v interface{}) error
+}
+
+// codecs are in order of preference; the first one is used unless the request accepts another.
+var codecs = []*Codec{
+	{
+		ContentType: model.ContentTypeJSON,
+		Decode:      decodeJSON,
+		Encode: func(w io.Writer, v interface{}) error {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "    ")
+			return encoder.Encode(v)
+		},
+	},
+	{
+		ContentType: model.ContentTypeCompactJSON,
+		Decode:      decodeJSON,
+		Encode: func(w io.Writer, v interface{}) error {
+			return json.NewEncoder(w).Encode(v)
+		},
+	},
+	{
+		ContentType: model.ContentTypeMessagePack,
+		Decode: func(r io.Reader, v interface{}) error {
+			decoder := msgpack.NewDecoder(r)
+			decoder.SetCustomStructTag("json")
+			return decoder.Decode(v)
+		},
+		Encode: func(w io.Writer, v interface{}) error {
+			encoder := msgpack.NewEncoder(w)
+			encoder.SetCustomStructTag("json")
+			return encoder.Encode(v)
+		},
+	},
+	{
+		ContentType: model.ContentTypeProtoJSON,
+		Decode:      decodeProtoJSON,
+		Encode:      encodeProtoJSON,
+	},
+	{
+		ContentType: model.ContentTypeForm,
+		Decode:      decodeForm,
+	},
+}
+
+// RegisterCodec adds a codec, or replaces the one of the same ContentType. It is not safe to call
+// while requests are being served; call it before building the handlers, e.g. in an init function.
+func RegisterCodec(codec Codec) {
+	for i := range codecs {
+		if codecs[i].ContentType == codec.ContentType {
+			codecs[i] = &codec
+			return
+		}
+	}
+	codecs = append(codecs, &codec)
+}
+
+// decoderFor returns the codec of a request body of the given Content-Type, or nil if none can
+// decode it.
+func decoderFor(contentType string) *Codec {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	for _, codec := range codecs {
+		if codec.Decode != nil && baseType(codec.ContentType) == mediaType {
+			return codec
+		}
+	}
+	return nil
+}
+
+// decodableTypes lists the media types of the request bodies, e.g. for an UnsupportedContentType
+// error.
+func decodableTypes() string {
+	var ret []string
+	seen := make(map[string]bool)
+	for _, codec := range codecs {
+		if base := baseType(codec.ContentType); codec.Decode != nil && !seen[base] {
+			seen[base] = true
+			ret = append(ret, base)
+		}
+	}
+	return strings.Join(ret, ", ")
+}
+
+// encoderFor returns the codec of the response to a request with the given Accept header. The
+// first codec is used if the request accepts none of them.
+func encoderFor(accept string) *Codec {
+	type acceptable struct {
+		mediaType string
+		params    map[string]string
+		quality   float64
+	}
+	var entries []acceptable
+	for _, entry := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(entry)
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, exists := params["q"]; exists {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil || quality <= 0 {
+				continue
+			}
+			delete(params, "q")
+		}
+		entries = append(entries, acceptable{mediaType: mediaType, params: params, quality: quality})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].quality > entries[j].quality
+	})
+	for _, entry := range entries {
+		var (
+			ret     *Codec
+			matched = -1
+		)
+		for _, codec := range codecs {
+			if codec.Encode == nil {
+				continue
+			}
+			mediaType, params, _ := mime.ParseMediaType(codec.ContentType)
+			if !matchMediaType(entry.mediaType, mediaType) {
+				continue
+			}
+			if entry.mediaType != mediaType {
+				// a wildcard only matches the codecs without parameters
+				if len(params) == 0 {
+					return codec
+				}
+				continue
+			}
+			match := true
+			for k, v := range params {
+				match = match && entry.params[k] == v
+			}
+			// the codec with the most parameters in common is the most specific one
+			if match && len(params) > matched {
+				ret, matched = codec, len(params)
+			}
+		}
+		if ret != nil {
+			return ret
+		}
+	}
+	return codecs[0]
+}
+
+func matchMediaType(pattern, mediaType string) bool {
+	if pattern == "*/*" || pattern == mediaType {
+		return true
+	}
+	return strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mediaType, pattern[:len(pattern)-1])
+}
+
+func baseType(contentType string) string {
+	return strings.TrimSpace(strings.Split(contentType, ";")[0])
+}
+
+func decodeJSON(r io.Reader, v interface{}) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+// decodeProtoJSON decodes protocol buffer messages with protojson, and anything else as JSON.
+func decodeProtoJSON(r io.Reader, v interface{}) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Ptr && !value.IsNil() {
+		if message, ok := value.Interface().(proto.Message); ok {
+			return protojson.Unmarshal(data, message)
+		}
+		// allocate the message pointed to, e.g. when decoding into a **pb.Message
+		if elem := value.Elem(); elem.Kind() == reflect.Ptr && elem.IsNil() {
+			elem.Set(reflect.New(elem.Type().Elem()))
+		}
+		value = value.Elem()
+	}
+	return json.Unmarshal(data, v)
+}
+
+// encodeProtoJSON encodes a response as JSON with its Result encoded by protojson if it is a
+// protocol buffer message.
+func encodeProtoJSON(w io.Writer, v interface{}) error {
+	if resp, ok := v.(*model.Response); ok {
+		if message, ok := resp.Result.(proto.Message); ok {
+			result, err := protojson.Marshal(message)
+			if err != nil {
+				return err
+			}
+			copied := *resp
+			copied.Result = json.RawMessage(result)
+			v = &copied
+		}
+	}
+	return json.NewEncoder(w).Encode(v)
+}
+
+// basicTypes are the predeclared types with Converters by their kinds.
+var basicTypes = func() map[reflect.Kind]reflect.Type {
+	ret := make(map[reflect.Kind]reflect.Type)
+	for t := range converters {
+		if t.PkgPath() == "" && t.Name() != "" {
+			ret[t.Kind()] = t
+		}
+	}
+	return ret
+}()
+
+// decodeForm decodes a form into a struct whose fields have Converters, named by their JSON
+// names; the fields missing from the form are left unchanged.
+func decodeForm(r io.Reader, v interface{}) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	form, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return errors.New("cannot decode form into a nil pointer")
+		}
+		if elem := value.Elem(); elem.Kind() == reflect.Ptr && elem.IsNil() {
+			elem.Set(reflect.New(elem.Type().Elem()))
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return errors.Errorf("cannot decode form into %s", value.Type())
+	}
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if field.PkgPath != "" || tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+		values := form[name]
+		if len(values) == 0 {
+			continue
+		}
+		converter, err := ConverterFor(field.Type)
+		if err != nil {
+			// a named type, e.g. an enum, is converted like its underlying basic type
+			basic, exists := basicTypes[field.Type.Kind()]
+			if !exists {
+				return errors.Wrapf(err, "field %s", name)
+			}
+			converter = MustConverterFor(basic)
+		}
+		converted, err := converter(values)
+		if err != nil {
+			return errors.Wrapf(err, "field %s", name)
+		}
+		value.Field(i).Set(reflect.ValueOf(converted).Convert(field.Type))
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/model"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/standard"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type codecStatus string
+
+type codecRequest struct {
+	Name   string      `json:"Name,omitempty"`
+	Count  int         `json:"Count,omitempty"`
+	Status codecStatus `json:"Status,omitempty"`
+	Tags   []string    `json:"Tags,omitempty"`
+}
+
+func TestEncoderFor(t *testing.T) {
+	for _, tc := range []struct {
+		Accept string
+		Expect string
+	}{
+		{Accept: "", Expect: model.ContentTypeJSON},
+		{Accept: "*/*", Expect: model.ContentTypeJSON},
+		{Accept: "text/html", Expect: model.ContentTypeJSON},
+		{Accept: "application/json", Expect: model.ContentTypeJSON},
+		{Accept: "application/json; format=compact", Expect: model.ContentTypeCompactJSON},
+		{Accept: "application/json; format=other", Expect: model.ContentTypeJSON},
+		{Accept: "application/json;q=0.5, application/msgpack", Expect: model.ContentTypeMessagePack},
+		{Accept: "application/msgpack;q=0, application/*", Expect: model.ContentTypeJSON},
+		// request bodies only
+		{Accept: model.ContentTypeForm, Expect: model.ContentTypeJSON},
+	} {
+		if codec := encoderFor(tc.Accept); codec.ContentType != tc.Expect {
+			t.Errorf("%q: expecting %s; got %s", tc.Accept, tc.Expect, codec.ContentType)
+		}
+	}
+}
+
+func TestContentEncodingFor(t *testing.T) {
+	for _, tc := range []struct {
+		Accept string
+		Expect string
+	}{
+		{Accept: "", Expect: ""},
+		{Accept: "identity", Expect: ""},
+		{Accept: "gzip", Expect: model.ContentEncodingGzip},
+		{Accept: "gzip, deflate, br", Expect: model.ContentEncodingBrotli},
+		{Accept: "gzip, br;q=0.5", Expect: model.ContentEncodingGzip},
+		{Accept: "gzip;q=0, *", Expect: model.ContentEncodingBrotli},
+		{Accept: "br;q=0", Expect: ""},
+	} {
+		if encoding := contentEncodingFor(tc.Accept); encoding != tc.Expect {
+			t.Errorf("%q: expecting %q; got %q", tc.Accept, tc.Expect, encoding)
+		}
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	h, err := (&Builder{}).AddActionGroup(model.ActionGroup{
+		Mutator: func(action *model.Action) {
+			action.Version = "20211206"
+		},
+		Actions: []model.Action{
+			TypedAction("Echo", func(_ context.Context, req *codecRequest) (*codecRequest, standard.Error) {
+				return req, nil
+			}),
+			TypedAction("Proto", func(_ context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, standard.Error) {
+				return wrapperspb.String(req.Value + "!"), nil
+			}),
+		},
+	}).Build()
+	if err != nil {
+		t.Fatalf("build error: %v", err)
+	}
+	serve := func(action, contentType string, body []byte, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/?Action="+action+"&Version=20211206", bytes.NewReader(body))
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		req.Header.Set(model.HeaderContentType, contentType)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+	expected := codecRequest{Name: "name", Count: 3, Status: "Active", Tags: []string{"a", "b"}}
+
+	msgpackBody, err := msgpack.Marshal(map[string]interface{}{"Name": "name", "Count": 3, "Status": "Active", "Tags": []string{"a", "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		Name        string
+		ContentType string
+		Body        []byte
+		Accept      string
+		Decode      func([]byte, interface{}) error
+	}{
+		{
+			Name:        "JSON",
+			ContentType: model.ContentTypeJSON + "; charset=utf-8",
+			Body:        []byte(`{"Name":"name","Count":3,"Status":"Active","Tags":["a","b"]}`),
+			Decode:      json.Unmarshal,
+		},
+		{
+			Name:        "Compact JSON",
+			ContentType: model.ContentTypeJSON,
+			Body:        []byte(`{"Name":"name","Count":3,"Status":"Active","Tags":["a","b"]}`),
+			Accept:      model.ContentTypeCompactJSON,
+			Decode:      json.Unmarshal,
+		},
+		{
+			Name:        "MessagePack",
+			ContentType: model.ContentTypeMessagePack,
+			Body:        msgpackBody,
+			Accept:      model.ContentTypeMessagePack,
+			Decode: func(data []byte, v interface{}) error {
+				decoder := msgpack.NewDecoder(bytes.NewReader(data))
+				decoder.SetCustomStructTag("json")
+				return decoder.Decode(v)
+			},
+		},
+		{
+			Name:        "Form",
+			ContentType: model.ContentTypeForm,
+			Body:        []byte("Name=name&Count=3&Status=Active&Tags=a&Tags=b&Unknown=1"),
+			Decode:      json.Unmarshal,
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			w := serve("Echo", tc.ContentType, tc.Body, http.Header{model.HeaderAccept: []string{tc.Accept}})
+			if w.Code != http.StatusOK {
+				t.Fatalf("expecting status %d; got %d: %s", http.StatusOK, w.Code, w.Body)
+			}
+			if expectedType := encoderFor(tc.Accept).ContentType; w.Header().Get(model.HeaderContentType) != expectedType {
+				t.Fatalf("expecting content type %s; got %s", expectedType, w.Header().Get(model.HeaderContentType))
+			}
+			var result codecRequest
+			if err := tc.Decode(w.Body.Bytes(), &model.Response{Result: &result}); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if result.Name != expected.Name || result.Count != expected.Count || result.Status != expected.Status ||
+				strings.Join(result.Tags, ",") != strings.Join(expected.Tags, ",") {
+				t.Fatalf("expecting %+v; got %+v", expected, result)
+			}
+		})
+	}
+
+	// protocol buffer messages are encoded by protojson
+	w := serve("Proto", model.ContentTypeProtoJSON, []byte(`"hello"`), http.Header{model.HeaderAccept: []string{model.ContentTypeProtoJSON}})
+	var protoResp struct {
+		Result string
+	}
+	if err = json.Unmarshal(w.Body.Bytes(), &protoResp); err != nil || protoResp.Result != "hello!" {
+		t.Fatalf("expecting hello! as the result; got %s", w.Body)
+	}
+
+	// the error lists the accepted types
+	w = serve("Echo", "text/plain", []byte("hello"), nil)
+	var errResp model.Response
+	if err = json.Unmarshal(w.Body.Bytes(), &errResp); err != nil || w.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expecting status %d; got %d: %s", http.StatusUnsupportedMediaType, w.Code, w.Body)
+	}
+	if types := errResp.Error.Data["ContentTypes"]; types != decodableTypes() || !strings.Contains(types, model.ContentTypeMessagePack) {
+		t.Fatalf("unexpected accepted types %q", types)
+	}
+
+	// large responses are compressed
+	large, _ := json.Marshal(&codecRequest{Name: strings.Repeat("x", minCompressedSize)})
+	for _, tc := range []struct {
+		Encoding string
+		Reader   func(io.Reader) (io.Reader, error)
+	}{
+		{Encoding: model.ContentEncodingGzip, Reader: func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{Encoding: model.ContentEncodingBrotli, Reader: func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil }},
+	} {
+		w = serve("Echo", model.ContentTypeJSON, large, http.Header{model.HeaderAcceptEncoding: []string{tc.Encoding}})
+		if encoding := w.Header().Get(model.HeaderContentEncoding); encoding != tc.Encoding {
+			t.Fatalf("expecting content encoding %s; got %q", tc.Encoding, encoding)
+		}
+		r, err := tc.Reader(w.Body)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Encoding, err)
+		}
+		decompressed, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Encoding, err)
+		}
+		var result codecRequest
+		if err = json.Unmarshal(decompressed, &model.Response{Result: &result}); err != nil || len(result.Name) != minCompressedSize {
+			t.Fatalf("%s: unexpected response %s", tc.Encoding, decompressed)
+		}
+	}
+	// small ones are not worth it
+	w = serve("Echo", model.ContentTypeJSON, []byte(`{}`), http.Header{model.HeaderAcceptEncoding: []string{"gzip"}})
+	if encoding := w.Header().Get(model.HeaderContentEncoding); encoding != "" {
+		t.Fatalf("expecting no content encoding; got %s", encoding)
+	}
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/model"
+)
+
+// minCompressedSize is the size below which responses are not worth compressing.
+const minCompressedSize = 1024
+
+var (
+	bufferPool = sync.Pool{
+		New: func() interface{} {
+			return new(bytes.Buffer)
+		},
+	}
+	gzipPool = sync.Pool{
+		New: func() interface{} {
+			return gzip.NewWriter(nil)
+		},
+	}
+	brotliPool = sync.Pool{
+		New: func() interface{} {
+			return brotli.NewWriterLevel(nil, brotli.DefaultCompression)
+		},
+	}
+)
+
+// compressor is implemented by the writers of gzipPool and brotliPool.
+type compressor interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+// writeResponse writes a response with the Codec accepted by the request, compressed if the
+// request accepts a content encoding.
+func writeResponse(w http.ResponseWriter, req *http.Request, status int, resp *model.Response) {
+	if entry, ok := w.(*entryWriter); ok {
+		// the response of a batch entry is encoded with the others
+		entry.keep(resp)
+		return
+	}
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer bufferPool.Put(buf)
+	codec := encoderFor(req.Header.Get(model.HeaderAccept))
+	if err := codec.Encode(buf, resp); err != nil && codec != codecs[0] {
+		// e.g. a result the codec cannot encode
+		buf.Reset()
+		codec = codecs[0]
+		_ = codec.Encode(buf, resp)
+	}
+
+	header := w.Header()
+	header.Set(model.HeaderContentType, codec.ContentType)
+	header.Add(model.HeaderVary, model.HeaderAccept)
+	header.Add(model.HeaderVary, model.HeaderAcceptEncoding)
+	var pool *sync.Pool
+	if buf.Len() >= minCompressedSize {
+		switch contentEncodingFor(req.Header.Get(model.HeaderAcceptEncoding)) {
+		case model.ContentEncodingBrotli:
+			header.Set(model.HeaderContentEncoding, model.ContentEncodingBrotli)
+			pool = &brotliPool
+		case model.ContentEncodingGzip:
+			header.Set(model.HeaderContentEncoding, model.ContentEncodingGzip)
+			pool = &gzipPool
+		}
+	}
+	w.WriteHeader(status)
+	if pool == nil {
+		_, _ = buf.WriteTo(w)
+		return
+	}
+	writer := pool.Get().(compressor)
+	writer.Reset(w)
+	_, _ = buf.WriteTo(writer)
+	_ = writer.Close()
+	writer.Reset(nil)
+	pool.Put(writer)
+}
+
+// contentEncodingFor returns the preferred content encoding accepted by the Accept-Encoding header
+// of a request, or an empty string for none; brotli is preferred over gzip at equal quality.
+func contentEncodingFor(accept string) string {
+	var (
+		ret     string
+		quality float64
+	)
+	for _, entry := range strings.Split(accept, ",") {
+		fields := strings.Split(entry, ";")
+		encoding, q := strings.ToLower(strings.TrimSpace(fields[0])), 1.0
+		for _, param := range fields[1:] {
+			if param = strings.TrimSpace(param); strings.HasPrefix(param, "q=") {
+				var err error
+				if q, err = strconv.ParseFloat(param[2:], 64); err != nil {
+					q = 0
+				}
+			}
+		}
+		switch encoding {
+		case "*":
+			encoding = model.ContentEncodingBrotli
+		case model.ContentEncodingBrotli, model.ContentEncodingGzip:
+		default:
+			continue
+		}
+		if q > quality || (q == quality && q > 0 && encoding == model.ContentEncodingBrotli) {
+			ret, quality = encoding, q
+		}
+	}
+	return ret
+}
@@ -2,11 +2,9 @@ package service
 
 import (
 	"context"
-	"encoding/json"
 	"net/http"
 	"net/textproto"
 	"reflect"
-	"strings"
 	"sync"
 
 	"github.com/lichuan0620/secret-keeper-backend/pkg/service/model"
@@ -20,6 +18,8 @@ type parameter struct {
 	defaultValue interface{}
 	optional     bool
 	targetType   reflect.Type
+	// validator is nil if there is nothing to validate
+	validator *validator
 }
 
 type middleware struct {
@@ -59,7 +59,9 @@ type actionHandler struct {
 	middlewareLn *middleware
 	parameters   []parameter
 	handler      reflect.Value
-	respPool     sync.Pool
+	// call is set for the handlers of TypedAction, which are called without reflection
+	call     func(context.Context, *http.Request) (interface{}, standard.Error)
+	respPool sync.Pool
 }
 
 // NewActionHandler builds a http.Handler that handles requests for one Action. In most cases, you
@@ -80,12 +82,17 @@ func NewActionHandler(action *model.Action, middlewares ...model.Middleware) (ht
 		if err := validateParameter(param, handlerIn); err != nil {
 			return nil, err
 		}
+		v, err := newValidator(handlerIn, param.Validate)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid validation rules of parameter %s", param.Name)
+		}
 		parameters = append(parameters, parameter{
 			source:       param.Source,
 			name:         param.Name,
 			defaultValue: param.Default,
 			optional:     param.Optional,
 			targetType:   handlerIn,
+			validator:    v,
 		})
 	}
 
@@ -104,6 +111,12 @@ func NewActionHandler(action *model.Action, middlewares ...model.Middleware) (ht
 		parameters:   parameters,
 		handler:      handler,
 	}
+	if typed, ok := action.Handler.(typedHandler); ok {
+		if len(parameters) != 1 || parameters[0].source != model.ParameterSourceBody {
+			return nil, errors.New("typed handler must take exactly one body parameter")
+		}
+		ret.call = typed.caller(parameters[0].validator)
+	}
 	ret.respPool.New = func() interface{} {
 		return &model.Response{
 			Metadata: model.ResponseMetadata{
@@ -116,30 +129,64 @@ func NewActionHandler(action *model.Action, middlewares ...model.Middleware) (ht
 }
 
 func (exec *actionHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	exec.middlewareLn.execute(req.Context(), func(ctx context.Context) {
-		// prepare response
-		response := exec.respPool.Get().(*model.Response)
-		defer func() {
-			exec.respPool.Put(response)
-		}()
-
-		// parse parameters
-		paramValues, err := exec.parseParameters(req)
-		if err != nil {
-			writeError(w, response, err)
-			req.WithContext(context.WithValue(req.Context(), contextKeyError, err))
-			return
-		}
-		paramValues[0] = reflect.ValueOf(ctx)
+	ctx := req.Context()
+	state := getRequestState(ctx)
+	if state == nil {
+		// not served through a Builder handler
+		state = new(requestState)
+		ctx = context.WithValue(ctx, contextKeyState, state)
+		ctx = context.WithValue(ctx, contextKeyHeader, req.Header)
+		req = req.WithContext(ctx)
+	}
 
-		// execute handler
-		if out := exec.handler.Call(paramValues); out[1].IsNil() {
-			writeSuccess(w, response, out[0].Interface())
+	// prepare response
+	response := exec.respPool.Get().(*model.Response)
+	response.Metadata.Degraded = false
+	defer func() {
+		exec.respPool.Put(response)
+	}()
+
+	exec.middlewareLn.execute(ctx, func(ctx context.Context) {
+		var (
+			result interface{}
+			err    standard.Error
+		)
+		if exec.call != nil {
+			result, err = exec.call(ctx, req)
+		} else {
+			result, err = exec.callReflectively(ctx, req)
+		}
+		response.Metadata.Degraded = state.degraded
+		if err == nil {
+			writeSuccess(w, req, response, result)
 		} else {
-			writeError(w, response, out[1].Interface().(standard.Error))
-			req.WithContext(context.WithValue(req.Context(), contextKeyError, err))
+			state.err = err
+			writeError(w, req, response, err)
 		}
+		state.written = true
 	})
+
+	// a middleware rejected the request without calling the handler
+	if !state.written && state.err != nil {
+		writeError(w, req, response, state.err)
+		state.written = true
+	}
+}
+
+func (exec *actionHandler) callReflectively(ctx context.Context, req *http.Request) (interface{}, standard.Error) {
+	// parse parameters
+	paramValues, err := exec.parseParameters(req)
+	if err != nil {
+		return nil, err
+	}
+	paramValues[0] = reflect.ValueOf(ctx)
+
+	// execute handler
+	out := exec.handler.Call(paramValues)
+	if !out[1].IsNil() {
+		return nil, out[1].Interface().(standard.Error)
+	}
+	return out[0].Interface(), nil
 }
 
 func (exec *actionHandler) parseParameters(req *http.Request) ([]reflect.Value, standard.Error) {
@@ -161,12 +208,9 @@ func (exec *actionHandler) parseParameters(req *http.Request) ([]reflect.Value,
 				return nil, err
 			}
 		case model.ParameterSourceBody:
-			if !strings.HasPrefix(req.Header.Get(model.HeaderContentType), model.ContentTypeJSON) {
-				return nil, standard.UnsupportedContentType()
-			}
 			value := reflect.New(param.targetType)
-			if json.NewDecoder(req.Body).Decode(value.Interface()) != nil {
-				return nil, standard.MalformedParameter("body")
+			if err = decodeBody(req, value.Interface()); err != nil {
+				return nil, err
 			}
 			parsed = value.Elem().Interface()
 		}
@@ -178,12 +222,34 @@ func (exec *actionHandler) parseParameters(req *http.Request) ([]reflect.Value,
 			} else {
 				return nil, standard.MissingParameter(param.name)
 			}
+		} else if param.validator != nil {
+			name := param.name
+			if param.source == model.ParameterSourceBody {
+				// the fields are named as if they were parameters
+				name = ""
+			}
+			if err = param.validator.validate(name, reflect.ValueOf(parsed)); err != nil {
+				return nil, err
+			}
 		}
 		paramValues = append(paramValues, reflect.ValueOf(parsed))
 	}
 	return paramValues, nil
 }
 
+// decodeBody decodes the body of a request into the value pointed to by v with the Codec of its
+// Content-Type.
+func decodeBody(req *http.Request, v interface{}) standard.Error {
+	codec := decoderFor(req.Header.Get(model.HeaderContentType))
+	if codec == nil {
+		return standard.UnsupportedContentType(decodableTypes())
+	}
+	if codec.Decode(req.Body, v) != nil {
+		return standard.MalformedParameter("body")
+	}
+	return nil
+}
+
 func isJSONType(typ reflect.Type) bool {
 	switch typ.Kind() {
 	case reflect.Struct:
@@ -212,6 +278,9 @@ func validateParameter(param *model.Parameter, target reflect.Type) error {
 		if !isJSONType(target) {
 			return errors.Errorf("invalid type for body parameter %s", param.Name)
 		}
+		if param.Validate != "" {
+			return errors.Errorf("body parameter %s is validated by the %s tags of its fields", param.Name, TagValidate)
+		}
 	default:
 		return errors.Errorf("invalid source for parameter %s", param.Name)
 	}
@@ -2,12 +2,14 @@ package middlewares
 
 import (
 	"context"
+	"crypto/subtle"
 	"net/http"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/lichuan0620/secret-keeper-backend/pkg/service"
 	"github.com/lichuan0620/secret-keeper-backend/pkg/service/model"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/standard"
 	"github.com/lichuan0620/secret-keeper-backend/pkg/telemetry/log"
 )
 
@@ -30,6 +32,9 @@ func RequestLog(logger logr.Logger) model.Middleware {
 			logger = logger.WithValues("error_code", info.Error.GetCode()).V(log.LevelWarning)
 			httpStatusCode = int(info.Error.GetHTTPCode())
 		}
+		if info.Degraded {
+			logger = logger.WithValues("degraded", true)
+		}
 		logger.WithValues(
 			"action", info.Action,
 			"version", info.Version,
@@ -38,3 +43,17 @@ func RequestLog(logger logr.Logger) model.Middleware {
 		).Info("request handled")
 	}
 }
+
+// BearerToken rejects requests that do not carry the given token in their Authorization header
+// as "Bearer <token>". An empty token rejects every request.
+func BearerToken(token string) model.Middleware {
+	expected := []byte("Bearer " + token)
+	return func(ctx context.Context, f func(context.Context)) {
+		got := service.GetHeader(ctx).Get("Authorization")
+		if token == "" || subtle.ConstantTimeCompare([]byte(got), expected) != 1 {
+			service.Reject(ctx, standard.InvalidAuthorization())
+			return
+		}
+		f(ctx)
+	}
+}
@@ -2,11 +2,24 @@
 package model
 
 const (
-	HeaderContentType = "Content-Type"
+	HeaderContentType     = "Content-Type"
+	HeaderAccept          = "Accept"
+	HeaderAcceptEncoding  = "Accept-Encoding"
+	HeaderContentEncoding = "Content-Encoding"
+	HeaderVary            = "Vary"
 )
 
 const (
-	ContentTypeJSON = "application/json"
+	ContentTypeJSON        = "application/json"
+	ContentTypeCompactJSON = "application/json; format=compact"
+	ContentTypeMessagePack = "application/msgpack"
+	ContentTypeProtoJSON   = "application/x-protobuf+json"
+	ContentTypeForm        = "application/x-www-form-urlencoded"
+)
+
+const (
+	ContentEncodingGzip   = "gzip"
+	ContentEncodingBrotli = "br"
 )
 
 const (
@@ -53,6 +53,10 @@ type Parameter struct {
 	// missing a parameter that is required and has no Default, the request would fail with a
 	// MissingParameter error.
 	Optional bool
+	// Validate holds the validation rules of a header or query Parameter, in the format of the
+	// service.TagValidate struct tag which validates the fields of a body Parameter. A request
+	// violating them fails with an InvalidParameter or MalformedParameter error.
+	Validate string
 }
 
 // ParameterSource indicates the place from which the value of an Action parameter is parsed.
@@ -65,9 +69,9 @@ const (
 	// ParameterSourceHeader means value is from request header.
 	ParameterSourceHeader ParameterSource = "Header"
 
-	// ParameterSourceBody means value is from request body. Only JSON format is supported per
-	// our API convention. If a Body parameter is added, a request with content type other than
-	// application/json would cause a 415 error.
+	// ParameterSourceBody means value is from request body, decoded by the service.Codec of its
+	// content type; JSON is the format of our API convention. If a Body parameter is added, a
+	// request with a content type no Codec decodes would cause a 415 error.
 	ParameterSourceBody ParameterSource = "Body"
 )
 
@@ -89,4 +93,31 @@ type Response struct {
 type ResponseMetadata struct {
 	Action  string `json:"Action"`
 	Version string `json:"Version"`
+	// Degraded is set when the result comes from a fallback because a dependency of the service
+	// is unavailable; it is valid but may be of lesser quality, e.g. less fairly chosen.
+	Degraded bool `json:"Degraded,omitempty"`
+}
+
+// BatchRequest is the body of the built-in Batch Action, which makes the requests of several
+// Actions at once.
+type BatchRequest struct {
+	Entries []BatchEntry `json:"Entries" validate:"required"`
+}
+
+// BatchEntry describes a request made by a BatchRequest. The requests share the header of the
+// BatchRequest.
+type BatchEntry struct {
+	Action string `json:"Action" validate:"required"`
+	// Version defaults to the version of the Batch Action.
+	Version string `json:"Version,omitempty"`
+	// Params are the query parameters of the request.
+	Params map[string]string `json:"Params,omitempty"`
+	// Body is the body of the request, for the Actions taking one.
+	Body interface{} `json:"Body,omitempty"`
+}
+
+// BatchResponse is the result of the Batch Action. Its Responses are those of the Entries of the
+// BatchRequest, in the same order; the Batch Action succeeds even if some of them are errors.
+type BatchResponse struct {
+	Responses []Response `json:"Responses"`
 }
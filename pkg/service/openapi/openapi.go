@@ -0,0 +1,347 @@
+// Package openapi describes the Actions registered to a service.Builder with an OpenAPI 3
+// document, so that clients in other languages need not read the Go models.
+//
+// All Actions share the same path and method, which OpenAPI does not allow, so every Action has a
+// path of its own made of the path and the Action and Version query parameters, e.g.
+// "/?Action=CreateBox&Version=2021-12-23". The schemas are derived from the handler types by
+// their JSON encoding, and every standard error is documented as a response.
+package openapi
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/model"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/standard"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/telemetry/log"
+	"github.com/pkg/errors"
+)
+
+// ActionName is the name of the Action returned by NewAction.
+const ActionName = "DescribeAPI"
+
+const version = "3.0.3"
+
+// Options describe the service in the document; the zero value is valid.
+type Options struct {
+	Title       string
+	Description string
+	// Version is the version of the API; it defaults to the latest Action version.
+	Version string
+	// Path is where the service is served; it defaults to "/".
+	Path string
+	// Servers are the URLs of the service.
+	Servers []string
+}
+
+// Generate returns a document describing the given Actions, e.g. those of service.Builder.Actions.
+func Generate(actions []model.Action, opts *Options) (*Document, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	g := &generator{
+		doc: &Document{
+			OpenAPI: version,
+			Info: Info{
+				Title:       opts.Title,
+				Description: opts.Description,
+				Version:     opts.Version,
+			},
+			Paths: make(map[string]*PathItem, len(actions)),
+			Components: Components{
+				Schemas:   make(map[string]*Schema),
+				Responses: make(map[string]*Response),
+			},
+		},
+		names: make(map[reflect.Type]string),
+	}
+	for _, url := range opts.Servers {
+		g.doc.Servers = append(g.doc.Servers, Server{URL: url})
+	}
+	path := opts.Path
+	if path == "" {
+		path = "/"
+	}
+	errorResponses := g.errorResponses()
+	versions := make(map[string]int)
+	for i := range actions {
+		versions[actions[i].Name]++
+		if opts.Version == "" && actions[i].Version > g.doc.Info.Version {
+			g.doc.Info.Version = actions[i].Version
+		}
+	}
+	for i := range actions {
+		action := &actions[i]
+		operation, err := g.operation(action)
+		if err != nil {
+			return nil, errors.Wrapf(err, "action %s version %s", action.Name, action.Version)
+		}
+		if versions[action.Name] > 1 {
+			operation.OperationID += "_" + action.Version
+		}
+		for status, response := range errorResponses {
+			operation.Responses[status] = response
+		}
+		key := fmt.Sprintf("%s?%s=%s&%s=%s", path,
+			model.QueryParameterAction, action.Name, model.QueryParameterVersion, action.Version)
+		g.doc.Paths[key] = &PathItem{Post: operation}
+	}
+	return g.doc, nil
+}
+
+// NewAction returns an Action serving the document of the Actions registered to the builder,
+// including itself. The document is generated on the first call, once every Action has been
+// registered; the Version of the Action is left to the Mutator of its group.
+func NewAction(builder *service.Builder, opts *Options) model.Action {
+	var (
+		once sync.Once
+		doc  *Document
+		err  error
+	)
+	return model.Action{
+		Name: ActionName,
+		Handler: func(ctx context.Context) (*Document, standard.Error) {
+			once.Do(func() {
+				doc, err = Generate(builder.Actions(), opts)
+			})
+			if err != nil {
+				log.FromContext(ctx).Error(err, "generate OpenAPI document")
+				return nil, standard.InternalServiceError()
+			}
+			return doc, nil
+		},
+	}
+}
+
+type generator struct {
+	doc *Document
+	// names are the names of the schemas of the named struct types in the Components
+	names map[reflect.Type]string
+}
+
+func (g *generator) operation(action *model.Action) (*Operation, error) {
+	handler := reflect.TypeOf(action.Handler)
+	if handler == nil || handler.Kind() != reflect.Func {
+		return nil, errors.New("handler must be a function")
+	}
+	if handler.NumIn() != len(action.Parameters)+1 || handler.NumOut() != 2 {
+		return nil, errors.New("handler does not match the parameters")
+	}
+	ret := &Operation{
+		OperationID: action.Name,
+		Summary:     action.Name,
+		Parameters: []Parameter{
+			{
+				Name:     model.QueryParameterAction,
+				In:       "query",
+				Required: true,
+				Schema:   &Schema{Type: "string", Enum: []interface{}{action.Name}},
+			},
+			{
+				Name:     model.QueryParameterVersion,
+				In:       "query",
+				Required: true,
+				Schema:   &Schema{Type: "string", Enum: []interface{}{action.Version}},
+			},
+		},
+		Responses: map[string]*Response{
+			"200": {
+				Description: "The result of the Action.",
+				Content: jsonContent(&Schema{
+					Type: "object",
+					Properties: map[string]*Schema{
+						"ResponseMetadata": g.schemaOf(reflect.TypeOf(model.ResponseMetadata{})),
+						"Result":           g.schemaOf(handler.Out(0)),
+					},
+				}),
+			},
+		},
+	}
+	for i := range action.Parameters {
+		param, typ := &action.Parameters[i], handler.In(i+1)
+		switch param.Source {
+		case model.ParameterSourceQuery, model.ParameterSourceHeader:
+			schema := g.parameterSchema(typ)
+			schema.Default = param.Default
+			ret.Parameters = append(ret.Parameters, Parameter{
+				Name:     param.Name,
+				In:       strings.ToLower(string(param.Source)),
+				Required: !param.Optional && param.Default == nil,
+				Schema:   schema,
+			})
+		case model.ParameterSourceBody:
+			ret.RequestBody = &RequestBody{
+				Required: true,
+				Content:  jsonContent(g.schemaOf(typ)),
+			}
+		default:
+			return nil, errors.Errorf("invalid source for parameter %s", param.Name)
+		}
+	}
+	return ret, nil
+}
+
+// errorResponses adds a response to the Components for every HTTP status of the standard errors,
+// listing the errors, and returns the references to them by status.
+func (g *generator) errorResponses() map[string]*Response {
+	catalogue := standard.Catalogue()
+	sort.SliceStable(catalogue, func(i, j int) bool {
+		return catalogue[i].HTTPCode < catalogue[j].HTTPCode
+	})
+	ret := make(map[string]*Response)
+	for i := 0; i < len(catalogue); {
+		status := catalogue[i].HTTPCode
+		var (
+			codes       []interface{}
+			description strings.Builder
+		)
+		description.WriteString("The Action fails with one of the errors:\n")
+		for ; i < len(catalogue) && catalogue[i].HTTPCode == status; i++ {
+			codes = append(codes, catalogue[i].Code)
+			fmt.Fprintf(&description, "- %s: %s\n", catalogue[i].Code, strings.TrimSpace(catalogue[i].Message))
+		}
+		name := "Error" + strconv.Itoa(int(status))
+		g.doc.Components.Responses[name] = &Response{
+			Description: description.String(),
+			Content: jsonContent(&Schema{
+				Type: "object",
+				Properties: map[string]*Schema{
+					"ResponseMetadata": g.schemaOf(reflect.TypeOf(model.ResponseMetadata{})),
+					"Error": {
+						Type: "object",
+						Properties: map[string]*Schema{
+							"Code":    {Type: "string", Enum: codes},
+							"Message": {Type: "string"},
+							"Data":    {Type: "object", AdditionalProperties: &Schema{Type: "string"}},
+						},
+					},
+				},
+			}),
+		}
+		ret[strconv.Itoa(int(status))] = &Response{Ref: "#/components/responses/" + name}
+	}
+	return ret
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	documentType = reflect.TypeOf(Document{})
+)
+
+// parameterSchema returns the schema of a Query or Header Parameter, which is parsed by a
+// service.Converter rather than decoded from JSON.
+func (g *generator) parameterSchema(t reflect.Type) *Schema {
+	switch t {
+	case durationType:
+		return &Schema{Type: "string", Format: "duration"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.parameterSchema(t.Elem())
+	case reflect.Slice:
+		return &Schema{Type: "array", Items: g.parameterSchema(t.Elem())}
+	}
+	return g.schemaOf(t)
+}
+
+// schemaOf returns the schema of the JSON encoding of a type. Named struct types are added to
+// the Components and referred to.
+func (g *generator) schemaOf(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case documentType:
+		// the result of the Action returned by NewAction
+		return &Schema{Type: "object", Description: "An OpenAPI 3 document."}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schemaOf(t.Elem())
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32", Minimum: new(float64)}
+	case reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64", Minimum: new(float64)}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.objectOf(t)
+		}
+		name, exists := g.names[t]
+		if !exists {
+			name = t.Name()
+			if _, taken := g.doc.Components.Schemas[name]; taken {
+				name = t.String()
+			}
+			g.names[t] = name
+			// registered before the fields so that recursive types refer to themselves
+			g.doc.Components.Schemas[name] = &Schema{}
+			*g.doc.Components.Schemas[name] = *g.objectOf(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	// any value, e.g. of an interface
+	return &Schema{}
+}
+
+// objectOf returns the schema of a struct type, with the fields of the embedded structs.
+func (g *generator) objectOf(t reflect.Type) *Schema {
+	ret := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (field.PkgPath != "" && !field.Anonymous) {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			for k, v := range g.objectOf(fieldType).Properties {
+				if _, exists := ret.Properties[k]; !exists {
+					ret.Properties[k] = v
+				}
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		ret.Properties[name] = g.schemaOf(field.Type)
+	}
+	return ret
+}
+
+func jsonContent(schema *Schema) map[string]MediaType {
+	return map[string]MediaType{model.ContentTypeJSON: {Schema: schema}}
+}
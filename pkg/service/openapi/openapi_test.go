@@ -0,0 +1,188 @@
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/model"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/standard"
+)
+
+type Item struct {
+	ID       string `json:"Id"`
+	Children []Item
+	Since    *time.Time `json:",omitempty"`
+	Hidden   string     `json:"-"`
+	hidden   string
+	Embedded
+}
+
+type Embedded struct {
+	Count uint
+}
+
+type ListRequest struct {
+	Limit int
+}
+
+func TestGenerate(t *testing.T) {
+	actions := []model.Action{
+		{
+			Name:    "Get",
+			Version: "20211206",
+			Parameters: []model.Parameter{
+				{Source: model.ParameterSourceQuery, Name: "Id"},
+				{Source: model.ParameterSourceQuery, Name: "Timeout", Default: time.Second},
+				{Source: model.ParameterSourceHeader, Name: "X-Tags", Optional: true},
+			},
+			Handler: func(context.Context, string, time.Duration, []string) (*Item, standard.Error) {
+				return nil, nil
+			},
+		},
+		{
+			Name:       "List",
+			Version:    "20211206",
+			Parameters: []model.Parameter{{Source: model.ParameterSourceBody, Name: "Body"}},
+			Handler: func(context.Context, *ListRequest) ([]Item, standard.Error) {
+				return nil, nil
+			},
+		},
+		{
+			Name:    "List",
+			Version: "20220101",
+			Handler: func(context.Context) (map[string]Item, standard.Error) {
+				return nil, nil
+			},
+		},
+	}
+	doc, err := Generate(actions, &Options{Title: "Example", Path: "/api"})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if doc.Info.Version != "20220101" {
+		t.Fatalf("expecting the latest Action version; got %s", doc.Info.Version)
+	}
+	if len(doc.Paths) != len(actions) {
+		t.Fatalf("expecting %d paths; got %d", len(actions), len(doc.Paths))
+	}
+
+	get := doc.Paths["/api?Action=Get&Version=20211206"]
+	if get == nil || get.Post == nil {
+		t.Fatalf("missing the path of Get: %v", doc.Paths)
+	}
+	expectedParams := []Parameter{
+		{Name: "Action", In: "query", Required: true, Schema: &Schema{Type: "string", Enum: []interface{}{"Get"}}},
+		{Name: "Version", In: "query", Required: true, Schema: &Schema{Type: "string", Enum: []interface{}{"20211206"}}},
+		{Name: "Id", In: "query", Required: true, Schema: &Schema{Type: "string"}},
+		{Name: "Timeout", In: "query", Schema: &Schema{Type: "string", Format: "duration", Default: time.Second}},
+		{Name: "X-Tags", In: "header", Schema: &Schema{Type: "array", Items: &Schema{Type: "string"}}},
+	}
+	if !reflect.DeepEqual(get.Post.Parameters, expectedParams) {
+		t.Fatalf("unexpected parameters of Get: %s", marshal(get.Post.Parameters))
+	}
+	if result := get.Post.Responses["200"].Content[model.ContentTypeJSON].Schema.Properties["Result"]; result.Ref != "#/components/schemas/Item" {
+		t.Fatalf("expecting a reference to Item; got %s", marshal(result))
+	}
+	expectedItem := &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"Id":       {Type: "string"},
+			"Children": {Type: "array", Items: &Schema{Ref: "#/components/schemas/Item"}},
+			"Since":    {Type: "string", Format: "date-time"},
+			"Count":    {Type: "integer", Format: "int64", Minimum: new(float64)},
+		},
+	}
+	if !reflect.DeepEqual(doc.Components.Schemas["Item"], expectedItem) {
+		t.Fatalf("unexpected schema of Item: %s", marshal(doc.Components.Schemas["Item"]))
+	}
+
+	list := doc.Paths["/api?Action=List&Version=20211206"]
+	if list == nil || list.Post.OperationID != "List_20211206" {
+		t.Fatalf("expecting the version in the operation ID of List: %s", marshal(list))
+	}
+	if body := list.Post.RequestBody; body == nil || body.Content[model.ContentTypeJSON].Schema.Ref != "#/components/schemas/ListRequest" {
+		t.Fatalf("expecting a reference to ListRequest as the body; got %s", marshal(body))
+	}
+
+	// every standard error is documented under its status
+	for _, info := range standard.Catalogue() {
+		var found bool
+		for _, code := range errorCodes(doc, info.HTTPCode) {
+			if code == info.Code {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("missing error %s of status %d", info.Code, info.HTTPCode)
+		}
+	}
+	if response := get.Post.Responses["404"]; response == nil || response.Ref != "#/components/responses/Error404" {
+		t.Fatalf("expecting a reference to Error404; got %s", marshal(response))
+	}
+
+	actions[0].Handler = func(context.Context, string) (*Item, standard.Error) {
+		return nil, nil
+	}
+	if _, err = Generate(actions, nil); err == nil {
+		t.Fatal("expecting an error for a handler not matching the parameters")
+	}
+}
+
+func TestNewAction(t *testing.T) {
+	builder := &service.Builder{}
+	h, err := builder.AddActionGroup(model.ActionGroup{
+		Mutator: func(action *model.Action) {
+			action.Version = "20211206"
+		},
+		Actions: []model.Action{
+			NewAction(builder, nil),
+			{
+				Name: "List",
+				Handler: func(context.Context) ([]Item, standard.Error) {
+					return nil, nil
+				},
+			},
+		},
+	}).Build()
+	if err != nil {
+		t.Fatalf("build error: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	var doc Document
+	if _, err = service.NewClient(server.URL, nil).Call(context.Background(), &service.Request{
+		Action:  ActionName,
+		Version: "20211206",
+	}, &doc); err != nil {
+		t.Fatalf("call: %v", err)
+	}
+	for _, name := range []string{ActionName, "List"} {
+		if _, exists := doc.Paths["/?Action="+name+"&Version=20211206"]; !exists {
+			t.Fatalf("missing the path of %s: %s", name, marshal(doc.Paths))
+		}
+	}
+	if _, exists := doc.Components.Schemas["Document"]; exists {
+		t.Fatal("expecting the document itself not to be described")
+	}
+}
+
+func errorCodes(doc *Document, status int32) []interface{} {
+	response := doc.Components.Responses["Error"+strconv.Itoa(int(status))]
+	if response == nil {
+		return nil
+	}
+	return response.Content[model.ContentTypeJSON].Schema.Properties["Error"].Properties["Code"].Enum
+}
+
+func marshal(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
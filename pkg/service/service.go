@@ -2,7 +2,6 @@ package service
 
 import (
 	"context"
-	"encoding/json"
 	"hash/fnv"
 	"net/http"
 	"net/url"
@@ -15,11 +14,25 @@ import (
 
 var (
 	contextKeyQueryValue interface{} = new(byte)
+	contextKeyHeader     interface{} = new(byte)
 	contextKeyAction     interface{} = new(byte)
 	contextKeyVersion    interface{} = new(byte)
-	contextKeyError      interface{} = new(byte)
+	contextKeyState      interface{} = new(byte)
 )
 
+// requestState is shared by the middlewares and the handler of the same request, so that what
+// happens further down the chain is visible to the outer middlewares once they regain control.
+type requestState struct {
+	err      standard.Error
+	written  bool
+	degraded bool
+}
+
+func getRequestState(ctx context.Context) *requestState {
+	state, _ := ctx.Value(contextKeyState).(*requestState)
+	return state
+}
+
 // GetQueryValues return query values parsed from the given context. When using the http.Handler built
 // from this package, the query values are parsed when the request was first received.
 func GetQueryValues(ctx context.Context) url.Values {
@@ -30,25 +43,47 @@ func GetQueryValues(ctx context.Context) url.Values {
 	return values.(url.Values)
 }
 
+// GetHeader returns the header of the request being handled, or nil if it is not available.
+func GetHeader(ctx context.Context) http.Header {
+	header, _ := ctx.Value(contextKeyHeader).(http.Header)
+	return header
+}
+
 // GetHandlingInfo returns information about the handling of a request. Some information is only available
 // after the handler has returned (so only middlewares can use them).
 func GetHandlingInfo(ctx context.Context) HandlingInfo {
-	ret := HandlingInfo{
-		Action:  ctx.Value(contextKeyAction).(string),
-		Version: ctx.Value(contextKeyVersion).(string),
-	}
-	if err := ctx.Value(contextKeyError); err != nil {
-		if stdErr, ok := err.(standard.Error); ok {
-			ret.Error = stdErr
-		}
+	ret := HandlingInfo{}
+	ret.Action, _ = ctx.Value(contextKeyAction).(string)
+	ret.Version, _ = ctx.Value(contextKeyVersion).(string)
+	if state := getRequestState(ctx); state != nil {
+		ret.Error = state.err
+		ret.Degraded = state.degraded
 	}
 	return ret
 }
 
+// Reject makes the request fail with the given error. It is meant for Middlewares that decide
+// not to call the next handler; the error response is written once the Middleware returns.
+func Reject(ctx context.Context, err standard.Error) {
+	if state := getRequestState(ctx); state != nil && !state.written {
+		state.err = err
+	}
+}
+
+// MarkDegraded flags the response of the request as degraded, see model.ResponseMetadata. It is
+// meant for handlers that serve a request with a fallback.
+func MarkDegraded(ctx context.Context) {
+	if state := getRequestState(ctx); state != nil {
+		state.degraded = true
+	}
+}
+
 // HandlingInfo contains information about the handling of a request.
 type HandlingInfo struct {
 	Error           standard.Error
 	Action, Version string
+	// Degraded tells if the handler has called MarkDegraded.
+	Degraded bool
 }
 
 // record describes a registered Action and is used to build http.Handler later.
@@ -64,6 +99,8 @@ type Builder struct {
 	// registered with the Actions can only affect a known action; requests that cannot match a
 	// registered action can only be covered by the global middlewares.
 	GlobalMiddlewares []model.Middleware
+	// Batch enables the built-in Batch Action if it is not nil, see BatchOptions.
+	Batch *BatchOptions
 
 	records []record
 }
@@ -86,6 +123,18 @@ func (builder *Builder) Build() (http.Handler, error) {
 		}
 		handlers[index] = handler
 	}
+	if builder.Batch != nil {
+		action := builder.batchAction(handlers)
+		handler, err := NewActionHandler(&action, builder.Batch.Middlewares...)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid definition for action %s version %s", action.Name, action.Version)
+		}
+		index := indexAction(action.Name, action.Version)
+		if _, exists := handlers[index]; exists {
+			return nil, errors.Errorf("duplicated Action: name %s version %s", action.Name, action.Version)
+		}
+		handlers[index] = handler
+	}
 	globalMiddleware := parseMiddlewares(builder.GlobalMiddlewares)
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		queryValues := req.URL.Query()
@@ -98,10 +147,15 @@ func (builder *Builder) Build() (http.Handler, error) {
 		}
 		action := parse(model.QueryParameterAction)
 		version := parse(model.QueryParameterVersion)
-		reqCtx := req.Context()
-		reqCtx = context.WithValue(reqCtx, contextKeyQueryValue, queryValues)
-		reqCtx = context.WithValue(reqCtx, contextKeyAction, action)
-		reqCtx = context.WithValue(reqCtx, contextKeyVersion, version)
+		reqCtx, state := newRequestContext(req.Context(), queryValues, req.Header, action, version)
+		newResponse := func() *model.Response {
+			return &model.Response{
+				Metadata: model.ResponseMetadata{
+					Action:  action,
+					Version: version,
+				},
+			}
+		}
 		globalMiddleware.execute(
 			reqCtx,
 			func(ctx context.Context) {
@@ -109,18 +163,46 @@ func (builder *Builder) Build() (http.Handler, error) {
 				if exists {
 					handler.ServeHTTP(w, req.WithContext(ctx))
 				} else {
-					writeError(w, &model.Response{
-						Metadata: model.ResponseMetadata{
-							Action:  action,
-							Version: version,
-						},
-					}, standard.InvalidActionOrVersion(action, version))
+					state.err = standard.InvalidActionOrVersion(action, version)
+					writeError(w, req, newResponse(), state.err)
+					state.written = true
 				}
 			},
 		)
+		if !state.written && state.err != nil {
+			writeError(w, req, newResponse(), state.err)
+			state.written = true
+		}
 	}), nil
 }
 
+// newRequestContext returns the context of a request to the given Action, which the getters of
+// this package read, and the state shared by its middlewares and handler.
+func newRequestContext(
+	ctx context.Context, queryValues url.Values, header http.Header, action, version string,
+) (context.Context, *requestState) {
+	state := new(requestState)
+	ctx = context.WithValue(ctx, contextKeyQueryValue, queryValues)
+	ctx = context.WithValue(ctx, contextKeyHeader, header)
+	ctx = context.WithValue(ctx, contextKeyAction, action)
+	ctx = context.WithValue(ctx, contextKeyVersion, version)
+	ctx = context.WithValue(ctx, contextKeyState, state)
+	return ctx, state
+}
+
+// Actions returns the registered Actions, with the Mutators of their groups applied, and the Batch
+// Action if it is enabled, e.g. to generate clients with the clientgen package.
+func (builder *Builder) Actions() []model.Action {
+	ret := make([]model.Action, len(builder.records), len(builder.records)+1)
+	for i := range builder.records {
+		ret[i] = *builder.records[i].Action
+	}
+	if builder.Batch != nil {
+		ret = append(ret, builder.batchAction(nil))
+	}
+	return ret
+}
+
 // AddActionGroup registers a group of Actions to the Builder. Note that the added objects should
 // not be modified or reused afterwards.
 func (builder *Builder) AddActionGroup(group ...model.ActionGroup) *Builder {
@@ -165,23 +247,22 @@ func indexAction(action, version string) uint64 {
 	return h.Sum64()
 }
 
-func writeError(w http.ResponseWriter, resp *model.Response, err standard.Error) {
-	w.Header().Set(model.HeaderContentType, model.ContentTypeJSON)
-	w.WriteHeader(int(err.GetHTTPCode()))
+func writeError(w http.ResponseWriter, req *http.Request, resp *model.Response, err standard.Error) {
+	setError(resp, err)
+	writeResponse(w, req, int(err.GetHTTPCode()), resp)
+}
+
+// setError makes resp the response of the given error.
+func setError(resp *model.Response, err standard.Error) {
 	resp.Result = nil
 	if resp.Error == nil {
 		resp.Error = new(model.Error)
 	}
 	resp.Error.Code, resp.Error.Message, resp.Error.Data = err.GetCode(), err.GetMessage(), err.GetData()
-	_ = json.NewEncoder(w).Encode(resp)
 }
 
-func writeSuccess(w http.ResponseWriter, resp *model.Response, result interface{}) {
-	w.Header().Set(model.HeaderContentType, model.ContentTypeJSON)
-	w.WriteHeader(http.StatusOK)
+func writeSuccess(w http.ResponseWriter, req *http.Request, resp *model.Response, result interface{}) {
 	resp.Result = result
 	resp.Error = nil
-	encoder := json.NewEncoder(w)
-	encoder.SetIndent("", "    ")
-	_ = encoder.Encode(resp)
+	writeResponse(w, req, http.StatusOK, resp)
 }
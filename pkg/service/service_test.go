@@ -334,3 +334,99 @@ func TestGlobalMiddleware(t *testing.T) {
 		return ret
 	}())
 }
+
+func TestReject(t *testing.T) {
+	const action, version = "DoNothing", "20211206"
+	reject := func(ctx context.Context, f func(context.Context)) {
+		if GetHeader(ctx).Get("Token") != "secret" {
+			Reject(ctx, standard.InvalidAuthorization())
+			return
+		}
+		f(ctx)
+	}
+	var handled bool
+	for _, global := range []bool{true, false} {
+		builder, group := &Builder{}, model.ActionGroup{}
+		if global {
+			builder.GlobalMiddlewares = []model.Middleware{reject}
+		} else {
+			group.Middlewares = []model.Middleware{reject}
+		}
+		group.Actions = []model.Action{{
+			Name:    action,
+			Version: version,
+			Handler: func(context.Context) (*struct{}, standard.Error) {
+				handled = true
+				return &struct{}{}, nil
+			},
+		}}
+		h, err := builder.AddActionGroup(group).Build()
+		if err != nil {
+			t.Fatalf("build error: %v", err)
+		}
+		for _, token := range []string{"wrong", "secret"} {
+			handled = false
+			req, _ := http.NewRequest(
+				http.MethodPost,
+				fmt.Sprintf("%s?Action=%s&Version=%s", fakeURL, action, version),
+				bytes.NewBuffer(nil),
+			)
+			req.Header.Set("Token", token)
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			if expected := token == "secret"; handled != expected {
+				t.Fatalf("token %s: expecting handled %v; got %v", token, expected, handled)
+			}
+			if handled {
+				continue
+			}
+			if rr.Code != http.StatusUnauthorized {
+				t.Fatalf("expecting status %d; got %d", http.StatusUnauthorized, rr.Code)
+			}
+			var resp model.Response
+			if err = json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("unmarshal response, body: %s, err: %s", rr.Body.String(), err)
+			}
+			if resp.Error == nil || resp.Error.Code != "InvalidAuthorization" || resp.Metadata.Action != action {
+				t.Fatalf("unexpected response: %+v", resp)
+			}
+		}
+	}
+}
+
+func TestMarkDegraded(t *testing.T) {
+	const action, version = "DoSomething", "20211206"
+	h, err := (&Builder{}).AddActionGroup(model.ActionGroup{
+		Actions: []model.Action{{
+			Name:       action,
+			Version:    version,
+			Parameters: []model.Parameter{{Source: model.ParameterSourceQuery, Name: "Fallback"}},
+			Handler: func(ctx context.Context, fallback bool) (*struct{}, standard.Error) {
+				if fallback {
+					MarkDegraded(ctx)
+				}
+				return &struct{}{}, nil
+			},
+		}},
+	}).Build()
+	if err != nil {
+		t.Fatalf("build error: %v", err)
+	}
+	// the responses are reused, so a degraded response must not leak into the next one
+	for _, fallback := range []bool{true, false, true, false} {
+		req, _ := http.NewRequest(
+			http.MethodPost,
+			fmt.Sprintf("%s?Action=%s&Version=%s&Fallback=%v", fakeURL, action, version, fallback),
+			bytes.NewBuffer(nil),
+		)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		var resp model.Response
+		if err = json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("unmarshal response, body: %s, err: %s", rr.Body.String(), err)
+		}
+		if resp.Error != nil || resp.Metadata.Degraded != fallback {
+			t.Fatalf("fallback %v: unexpected response: %+v", fallback, resp)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package common
+
+import (
+	"encoding/json"
+)
+
+// ErrorInfo describes an error of the standard error catalogue.
+type ErrorInfo struct {
+	Code     string
+	HTTPCode int32
+	Message  string
+}
+
+// Catalogue returns every error of GoFiles.
+func Catalogue() []ErrorInfo {
+	var ret []ErrorInfo
+	for i := range GoFiles {
+		var infos []ErrorInfo
+		// the data is checked when it is generated
+		_ = json.Unmarshal(GoFiles[i].data, &infos)
+		ret = append(ret, infos...)
+	}
+	return ret
+}
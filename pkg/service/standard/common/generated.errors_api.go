@@ -48,7 +48,7 @@ var errors_api = bytesReader{
   {
     "Code": "UnsupportedContentType",
     "HTTPCode": 415,
-    "Message": "The specified HTTP content type is not supported",
+    "Message": "The specified HTTP content type is not supported; the supported types are {{ContentTypes}}.",
     "Comment": "不支持的Http content type"
   }
 ]`),
@@ -33,6 +33,12 @@ var errors_service = bytesReader{
     "Message": "Resource {{ResourceName}} already exists.",
     "Comment": "指定的资源已经存在"
   },
+  {
+    "Code": "ContentRejected",
+    "HTTPCode": 400,
+    "Message": "The submitted content is rejected: {{Reason}}.",
+    "Comment": "提交的内容未通过审核"
+  },
   {
     "Code": "ServiceFlowLimitExceeded",
     "HTTPCode": 429,
@@ -44,6 +50,12 @@ var errors_service = bytesReader{
     "HTTPCode": 504,
     "Message": "Internal Service is timeout. Pls Contact With Admin.",
     "Comment": "内部服务执行超时"
+  },
+  {
+    "Code": "ServiceUnavailable",
+    "HTTPCode": 503,
+    "Message": "Service is temporarily unavailable. Pls try again later.",
+    "Comment": "服务暂时不可用，请稍后重试"
   }
 ]`),
 }
@@ -253,16 +253,27 @@ type unsupportedContentType struct {
 
 // UnsupportedContentType returns a new error explained as follows
 /* 不支持的Http content type */
-func UnsupportedContentType() *unsupportedContentType {
+func UnsupportedContentType(ContentTypes string) *unsupportedContentType {
 	return &unsupportedContentType{
 		ErrorBase: common.ErrorBase{
 			HTTPCode: 415,
 			Code:     "UnsupportedContentType",
-			Message:  "The specified HTTP content type is not supported",
+			Message:  fmt.Sprintf("The specified HTTP content type is not supported; the supported types are %s.", ContentTypes),
+			DataPreset: map[string]string{
+				"ContentTypes": ContentTypes,
+			},
 		},
 	}
 }
 
+func (e *unsupportedContentType) SetStandardMessageArgs(ContentTypes string) *unsupportedContentType {
+	e.ErrorBase.Message = fmt.Sprintf("The specified HTTP content type is not supported; the supported types are %s.", ContentTypes)
+	e.ErrorBase.DataPreset = map[string]string{
+		"ContentTypes": ContentTypes,
+	}
+	return e
+}
+
 func (e *unsupportedContentType) AppendSubCode(code string) *unsupportedContentType {
 	e.Code = e.Code + "." + code
 	return e
@@ -159,6 +159,49 @@ func (e *duplicatedResource) SetData(data map[string]string) *duplicatedResource
 	return e
 }
 
+type contentRejected struct {
+	common.ErrorBase
+}
+
+// ContentRejected returns a new error explained as follows
+/* 提交的内容未通过审核 */
+func ContentRejected(Reason string) *contentRejected {
+	return &contentRejected{
+		ErrorBase: common.ErrorBase{
+			HTTPCode: 400,
+			Code:     "ContentRejected",
+			Message:  fmt.Sprintf("The submitted content is rejected: %s.", Reason),
+			DataPreset: map[string]string{
+				"Reason": Reason,
+			},
+		},
+	}
+}
+
+func (e *contentRejected) SetStandardMessageArgs(Reason string) *contentRejected {
+	e.ErrorBase.Message = fmt.Sprintf("The submitted content is rejected: %s.", Reason)
+	e.ErrorBase.DataPreset = map[string]string{
+		"Reason": Reason,
+	}
+	return e
+}
+
+func (e *contentRejected) AppendSubCode(code string) *contentRejected {
+	e.Code = e.Code + "." + code
+	return e
+}
+
+func (e *contentRejected) SetMessage(message string) *contentRejected {
+	e.ErrorBase.Message = message
+	e.ErrorBase.DataPreset = nil
+	return e
+}
+
+func (e *contentRejected) SetData(data map[string]string) *contentRejected {
+	e.ErrorBase.Data = data
+	return e
+}
+
 type serviceFlowLimitExceeded struct {
 	common.ErrorBase
 }
@@ -222,3 +265,35 @@ func (e *internalServiceTimeout) SetData(data map[string]string) *internalServic
 	e.ErrorBase.Data = data
 	return e
 }
+
+type serviceUnavailable struct {
+	common.ErrorBase
+}
+
+// ServiceUnavailable returns a new error explained as follows
+/* 服务暂时不可用，请稍后重试 */
+func ServiceUnavailable() *serviceUnavailable {
+	return &serviceUnavailable{
+		ErrorBase: common.ErrorBase{
+			HTTPCode: 503,
+			Code:     "ServiceUnavailable",
+			Message:  "Service is temporarily unavailable. Pls try again later.",
+		},
+	}
+}
+
+func (e *serviceUnavailable) AppendSubCode(code string) *serviceUnavailable {
+	e.Code = e.Code + "." + code
+	return e
+}
+
+func (e *serviceUnavailable) SetMessage(message string) *serviceUnavailable {
+	e.ErrorBase.Message = message
+	e.ErrorBase.DataPreset = nil
+	return e
+}
+
+func (e *serviceUnavailable) SetData(data map[string]string) *serviceUnavailable {
+	e.ErrorBase.Data = data
+	return e
+}
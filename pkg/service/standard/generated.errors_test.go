@@ -880,10 +880,10 @@ func TestUnsupportedContentType(t *testing.T) {
 			name: "UnsupportedContentType standard message test",
 			building: &unsupportedContentType{
 				ErrorBase: common.ErrorBase{
-					HTTPCode: UnsupportedContentType().SetData(nil).GetHTTPCode(),
-					Code:     UnsupportedContentType().SetData(nil).GetCode(),
-					Message:  UnsupportedContentType().SetData(nil).GetMessage(),
-					Data:     UnsupportedContentType().SetData(nil).GetData(),
+					HTTPCode: UnsupportedContentType("test_ContentTypes").SetStandardMessageArgs("test_ContentTypes").SetData(nil).GetHTTPCode(),
+					Code:     UnsupportedContentType("test_ContentTypes").SetStandardMessageArgs("test_ContentTypes").SetData(nil).GetCode(),
+					Message:  UnsupportedContentType("test_ContentTypes").SetStandardMessageArgs("test_ContentTypes").SetData(nil).GetMessage(),
+					Data:     UnsupportedContentType("test_ContentTypes").SetStandardMessageArgs("test_ContentTypes").SetData(nil).GetData(),
 				},
 			},
 
@@ -891,8 +891,10 @@ func TestUnsupportedContentType(t *testing.T) {
 				ErrorBase: common.ErrorBase{
 					HTTPCode: 415,
 					Code:     "UnsupportedContentType",
-					Message:  "The specified HTTP content type is not supported",
-					Data:     nil,
+					Message:  "The specified HTTP content type is not supported; the supported types are test_ContentTypes.",
+					Data: map[string]string{
+						"ContentTypes": "test_ContentTypes",
+					},
 				},
 			},
 		},
@@ -900,10 +902,10 @@ func TestUnsupportedContentType(t *testing.T) {
 			name: "UnsupportedContentType message test",
 			building: &unsupportedContentType{
 				ErrorBase: common.ErrorBase{
-					HTTPCode: UnsupportedContentType().SetMessage("test message").SetData(nil).GetHTTPCode(),
-					Code:     UnsupportedContentType().SetMessage("test message").SetData(nil).GetCode(),
-					Message:  UnsupportedContentType().SetMessage("test message").SetData(nil).GetMessage(),
-					Data:     UnsupportedContentType().SetMessage("test message").SetData(nil).GetData(),
+					HTTPCode: UnsupportedContentType("test_ContentTypes").SetMessage("test message").SetData(nil).GetHTTPCode(),
+					Code:     UnsupportedContentType("test_ContentTypes").SetMessage("test message").SetData(nil).GetCode(),
+					Message:  UnsupportedContentType("test_ContentTypes").SetMessage("test message").SetData(nil).GetMessage(),
+					Data:     UnsupportedContentType("test_ContentTypes").SetMessage("test message").SetData(nil).GetData(),
 				},
 			},
 
@@ -920,10 +922,10 @@ func TestUnsupportedContentType(t *testing.T) {
 			name: "UnsupportedContentType sub code test",
 			building: &unsupportedContentType{
 				ErrorBase: common.ErrorBase{
-					HTTPCode: UnsupportedContentType().SetMessage("test message").SetData(nil).AppendSubCode("TestCode").GetHTTPCode(),
-					Code:     UnsupportedContentType().SetMessage("test message").SetData(nil).AppendSubCode("TestCode").GetCode(),
-					Message:  UnsupportedContentType().SetMessage("test message").SetData(nil).AppendSubCode("TestCode").GetMessage(),
-					Data:     UnsupportedContentType().SetMessage("test message").SetData(nil).AppendSubCode("TestCode").GetData(),
+					HTTPCode: UnsupportedContentType("test_ContentTypes").SetMessage("test message").SetData(nil).AppendSubCode("TestCode").GetHTTPCode(),
+					Code:     UnsupportedContentType("test_ContentTypes").SetMessage("test message").SetData(nil).AppendSubCode("TestCode").GetCode(),
+					Message:  UnsupportedContentType("test_ContentTypes").SetMessage("test message").SetData(nil).AppendSubCode("TestCode").GetMessage(),
+					Data:     UnsupportedContentType("test_ContentTypes").SetMessage("test message").SetData(nil).AppendSubCode("TestCode").GetData(),
 				},
 			},
 
@@ -1569,6 +1571,85 @@ func TestDuplicatedResource(t *testing.T) {
 	}
 }
 
+func TestContentRejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		building Error
+		external Error
+	}{
+		{
+			name: "ContentRejected standard message test",
+			building: &contentRejected{
+				ErrorBase: common.ErrorBase{
+					HTTPCode: ContentRejected("test_Reason").SetStandardMessageArgs("test_Reason").SetData(nil).GetHTTPCode(),
+					Code:     ContentRejected("test_Reason").SetStandardMessageArgs("test_Reason").SetData(nil).GetCode(),
+					Message:  ContentRejected("test_Reason").SetStandardMessageArgs("test_Reason").SetData(nil).GetMessage(),
+					Data:     ContentRejected("test_Reason").SetStandardMessageArgs("test_Reason").SetData(nil).GetData(),
+				},
+			},
+
+			external: &contentRejected{
+				ErrorBase: common.ErrorBase{
+					HTTPCode: 400,
+					Code:     "ContentRejected",
+					Message:  "The submitted content is rejected: test_Reason.",
+					Data: map[string]string{
+						"Reason": "test_Reason",
+					},
+				},
+			},
+		},
+		{
+			name: "ContentRejected message test",
+			building: &contentRejected{
+				ErrorBase: common.ErrorBase{
+					HTTPCode: ContentRejected("test_Reason").SetMessage("test message").SetData(nil).GetHTTPCode(),
+					Code:     ContentRejected("test_Reason").SetMessage("test message").SetData(nil).GetCode(),
+					Message:  ContentRejected("test_Reason").SetMessage("test message").SetData(nil).GetMessage(),
+					Data:     ContentRejected("test_Reason").SetMessage("test message").SetData(nil).GetData(),
+				},
+			},
+
+			external: &contentRejected{
+				ErrorBase: common.ErrorBase{
+					HTTPCode: 400,
+					Code:     "ContentRejected",
+					Message:  "test message",
+					Data:     nil,
+				},
+			},
+		},
+		{
+			name: "ContentRejected sub code test",
+			building: &contentRejected{
+				ErrorBase: common.ErrorBase{
+					HTTPCode: ContentRejected("test_Reason").SetMessage("test message").SetData(nil).AppendSubCode("TestCode").GetHTTPCode(),
+					Code:     ContentRejected("test_Reason").SetMessage("test message").SetData(nil).AppendSubCode("TestCode").GetCode(),
+					Message:  ContentRejected("test_Reason").SetMessage("test message").SetData(nil).AppendSubCode("TestCode").GetMessage(),
+					Data:     ContentRejected("test_Reason").SetMessage("test message").SetData(nil).AppendSubCode("TestCode").GetData(),
+				},
+			},
+
+			external: &contentRejected{
+				ErrorBase: common.ErrorBase{
+					HTTPCode: 400,
+					Code:     "ContentRejected.TestCode",
+					Message:  "test message",
+					Data:     nil,
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.building, tt.external) {
+				t.Errorf("httpCode not expected. building: (%+v) expected: (%+v)", tt.building, tt.external)
+			}
+		})
+	}
+}
+
 func TestServiceFlowLimitExceeded(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -1722,3 +1803,80 @@ func TestInternalServiceTimeout(t *testing.T) {
 		})
 	}
 }
+
+func TestServiceUnavailable(t *testing.T) {
+	tests := []struct {
+		name     string
+		building Error
+		external Error
+	}{
+		{
+			name: "ServiceUnavailable standard message test",
+			building: &serviceUnavailable{
+				ErrorBase: common.ErrorBase{
+					HTTPCode: ServiceUnavailable().SetData(nil).GetHTTPCode(),
+					Code:     ServiceUnavailable().SetData(nil).GetCode(),
+					Message:  ServiceUnavailable().SetData(nil).GetMessage(),
+					Data:     ServiceUnavailable().SetData(nil).GetData(),
+				},
+			},
+
+			external: &serviceUnavailable{
+				ErrorBase: common.ErrorBase{
+					HTTPCode: 503,
+					Code:     "ServiceUnavailable",
+					Message:  "Service is temporarily unavailable. Pls try again later.",
+					Data:     nil,
+				},
+			},
+		},
+		{
+			name: "ServiceUnavailable message test",
+			building: &serviceUnavailable{
+				ErrorBase: common.ErrorBase{
+					HTTPCode: ServiceUnavailable().SetMessage("test message").SetData(nil).GetHTTPCode(),
+					Code:     ServiceUnavailable().SetMessage("test message").SetData(nil).GetCode(),
+					Message:  ServiceUnavailable().SetMessage("test message").SetData(nil).GetMessage(),
+					Data:     ServiceUnavailable().SetMessage("test message").SetData(nil).GetData(),
+				},
+			},
+
+			external: &serviceUnavailable{
+				ErrorBase: common.ErrorBase{
+					HTTPCode: 503,
+					Code:     "ServiceUnavailable",
+					Message:  "test message",
+					Data:     nil,
+				},
+			},
+		},
+		{
+			name: "ServiceUnavailable sub code test",
+			building: &serviceUnavailable{
+				ErrorBase: common.ErrorBase{
+					HTTPCode: ServiceUnavailable().SetMessage("test message").SetData(nil).AppendSubCode("TestCode").GetHTTPCode(),
+					Code:     ServiceUnavailable().SetMessage("test message").SetData(nil).AppendSubCode("TestCode").GetCode(),
+					Message:  ServiceUnavailable().SetMessage("test message").SetData(nil).AppendSubCode("TestCode").GetMessage(),
+					Data:     ServiceUnavailable().SetMessage("test message").SetData(nil).AppendSubCode("TestCode").GetData(),
+				},
+			},
+
+			external: &serviceUnavailable{
+				ErrorBase: common.ErrorBase{
+					HTTPCode: 503,
+					Code:     "ServiceUnavailable.TestCode",
+					Message:  "test message",
+					Data:     nil,
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.building, tt.external) {
+				t.Errorf("httpCode not expected. building: (%+v) expected: (%+v)", tt.building, tt.external)
+			}
+		})
+	}
+}
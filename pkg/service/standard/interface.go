@@ -19,3 +19,11 @@ func NewError(httpCode int, code, message string, data map[string]string) Error
 		Data:     data,
 	}
 }
+
+// ErrorInfo describes a standard error, with the parameters of its Message in double braces.
+type ErrorInfo = common.ErrorInfo
+
+// Catalogue returns every standard error, e.g. to document the errors of a service.
+func Catalogue() []ErrorInfo {
+	return common.Catalogue()
+}
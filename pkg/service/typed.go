@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/model"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/standard"
+)
+
+// TypedHandler handles the requests of an Action taking a single Body parameter. Unlike the
+// Handler of a model.Action, its signature is checked at compile time.
+type TypedHandler[Req, Resp any] func(ctx context.Context, req Req) (Resp, standard.Error)
+
+// TypedAction returns an Action with a Body parameter handled by the given handler. The handler
+// is called without reflection, so TypedAction is preferred over a model.Action with the
+// equivalent Handler; Actions with Query or Header parameters still need the latter. The types
+// are checked like those of any other Action when the handler is built, and the Version and
+// Middlewares are left to the ActionGroup.
+func TypedAction[Req, Resp any](name string, handler TypedHandler[Req, Resp]) model.Action {
+	return model.Action{
+		Name: name,
+		Parameters: []model.Parameter{{
+			Source: model.ParameterSourceBody,
+			Name:   "Body",
+		}},
+		Handler: handler,
+	}
+}
+
+// typedHandler is implemented by every TypedHandler.
+type typedHandler interface {
+	// caller returns the function decoding the Body parameter of a request, validating it
+	// with the given validator if it is not nil, and calling the handler with it.
+	caller(v *validator) func(context.Context, *http.Request) (interface{}, standard.Error)
+}
+
+func (handler TypedHandler[Req, Resp]) caller(v *validator) func(context.Context, *http.Request) (interface{}, standard.Error) {
+	return func(ctx context.Context, req *http.Request) (interface{}, standard.Error) {
+		var body Req
+		if err := decodeBody(req, &body); err != nil {
+			return nil, err
+		}
+		if v != nil {
+			if err := v.validate("", reflect.ValueOf(body)); err != nil {
+				return nil, err
+			}
+		}
+		return handler(ctx, body)
+	}
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/model"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/standard"
+)
+
+type greetRequest struct {
+	Name string `json:"Name" validate:"required,max=8"`
+}
+
+type greetResponse struct {
+	Greeting string `json:"Greeting"`
+}
+
+func greet(_ context.Context, req *greetRequest) (*greetResponse, standard.Error) {
+	if req.Name == "nobody" {
+		return nil, standard.ResourceNotFound(req.Name)
+	}
+	return &greetResponse{Greeting: "hello " + req.Name}, nil
+}
+
+func buildGreet(tb testing.TB, action model.Action) http.Handler {
+	h, err := (&Builder{}).AddActionGroup(model.ActionGroup{
+		Mutator: func(action *model.Action) {
+			action.Version = "20211206"
+		},
+		Actions: []model.Action{action},
+	}).Build()
+	if err != nil {
+		tb.Fatalf("build error: %v", err)
+	}
+	return h
+}
+
+func TestTypedAction(t *testing.T) {
+	server := httptest.NewServer(buildGreet(t, TypedAction("Greet", greet)))
+	defer server.Close()
+	c := NewClient(server.URL, nil)
+	call := func(body interface{}) (*greetResponse, string) {
+		var resp *greetResponse
+		_, err := c.Call(context.Background(), &Request{Action: "Greet", Version: "20211206", Body: body}, &resp)
+		if err == nil {
+			return resp, ""
+		}
+		callErr, ok := err.(*CallError)
+		if !ok {
+			t.Fatalf("call: %v", err)
+		}
+		return nil, callErr.Err.GetCode()
+	}
+
+	if resp, code := call(&greetRequest{Name: "world"}); code != "" || resp.Greeting != "hello world" {
+		t.Fatalf("unexpected result %+v, error %s", resp, code)
+	}
+	for _, tc := range []struct {
+		Body       interface{}
+		ExpectCode string
+	}{
+		{Body: &greetRequest{Name: "nobody"}, ExpectCode: "ResourceNotFound"},
+		{Body: &greetRequest{}, ExpectCode: "InvalidParameter"},
+		{Body: &greetRequest{Name: "everybody"}, ExpectCode: "InvalidParameter"},
+		{Body: "malformed", ExpectCode: "MalformedParameter"},
+	} {
+		if _, code := call(tc.Body); code != tc.ExpectCode {
+			t.Errorf("%+v: expecting %s; got %s", tc.Body, tc.ExpectCode, code)
+		}
+	}
+
+	// typed handlers must keep their single body parameter
+	action := TypedAction("Greet", greet)
+	action.Parameters[0].Source = model.ParameterSourceHeader
+	if _, err := NewActionHandler(&action); err == nil {
+		t.Fatal("expecting an error for a typed handler without a body parameter")
+	}
+}
+
+// BenchmarkActionHandler compares the same handler registered as a TypedAction and as a
+// model.Action called through reflection.
+func BenchmarkActionHandler(b *testing.B) {
+	for _, bc := range []struct {
+		Name   string
+		Action model.Action
+	}{
+		{Name: "Typed", Action: TypedAction("Greet", greet)},
+		{
+			Name: "Reflective",
+			Action: model.Action{
+				Name:       "Greet",
+				Parameters: []model.Parameter{{Source: model.ParameterSourceBody, Name: "Body"}},
+				Handler:    greet,
+			},
+		},
+	} {
+		b.Run(bc.Name, func(b *testing.B) {
+			h := buildGreet(b, bc.Action)
+			body := []byte(`{"Name":"world"}`)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				req := httptest.NewRequest(http.MethodPost, "/?Action=Greet&Version=20211206", bytes.NewReader(body))
+				req.Header.Set(model.HeaderContentType, model.ContentTypeJSON)
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, req)
+				if w.Code != http.StatusOK {
+					b.Fatalf("expecting status %d; got %d", http.StatusOK, w.Code)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,381 @@
+package service
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/standard"
+	"github.com/pkg/errors"
+)
+
+// TagValidate is the struct tag holding the validation rules of a field of a Body parameter; the
+// rules of a Query or Header parameter are set by model.Parameter.Validate instead. The rules are
+// separated by commas:
+//   - required: the value must not be zero, e.g. empty or nil
+//   - min=N, max=N: the bounds of a number, or of the length of a string (in characters), a slice
+//     or a map
+//   - oneof=A B C: the value must be one of the space-separated values
+//   - pattern=R: a string must match the regular expression R, which takes the rest of the
+//     rules so that it may hold commas
+//   - keys: the rules after it apply to the keys of a map
+//   - values: the rules after it apply to the values of a map or the elements of a slice
+//
+// Rules other than required are skipped for zero values, so that omitted fields stay optional.
+// The fields of nested structs are validated as well, and are named by their JSON names.
+const TagValidate = "validate"
+
+// rules are the validation rules of a value.
+type rules struct {
+	required bool
+	min, max *float64
+	oneOf    []string
+	pattern  *regexp.Regexp
+	keys     *rules
+	values   *rules
+	// key tells that the rules apply to map keys
+	key bool
+}
+
+// parseRules parses the rules in the format of TagValidate for values of the given type; it
+// returns nil if there are none.
+func parseRules(tag string, t reflect.Type) (*rules, error) {
+	if tag == "" {
+		return nil, nil
+	}
+	ret := new(rules)
+	cursor, cursorType := ret, indirect(t)
+	split := strings.Split(tag, ",")
+	for i := 0; i < len(split); i++ {
+		rule := split[i]
+		name, arg := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, arg = rule[:i], rule[i+1:]
+		}
+		var err error
+		switch name {
+		case "required":
+			cursor.required = true
+		case "min", "max":
+			var bound float64
+			if bound, err = strconv.ParseFloat(arg, 64); err != nil {
+				return nil, errors.Wrapf(err, "invalid rule %s", rule)
+			}
+			if !sized(cursorType) && !numeric(cursorType) {
+				return nil, errors.Errorf("rule %s does not apply to %s", rule, cursorType)
+			}
+			if name == "min" {
+				cursor.min = &bound
+			} else {
+				cursor.max = &bound
+			}
+		case "oneof":
+			if !numeric(cursorType) && cursorType.Kind() != reflect.String {
+				return nil, errors.Errorf("rule %s does not apply to %s", rule, cursorType)
+			}
+			cursor.oneOf = strings.Fields(arg)
+		case "pattern":
+			if cursorType.Kind() != reflect.String {
+				return nil, errors.Errorf("rule %s does not apply to %s", rule, cursorType)
+			}
+			arg, i = strings.Join(append([]string{arg}, split[i+1:]...), ","), len(split)
+			if cursor.pattern, err = regexp.Compile(arg); err != nil {
+				return nil, errors.Wrapf(err, "invalid rule %s", rule)
+			}
+		case "keys":
+			if t = indirect(t); t.Kind() != reflect.Map {
+				return nil, errors.Errorf("rule keys does not apply to %s", t)
+			}
+			ret.keys = &rules{key: true}
+			cursor, cursorType = ret.keys, indirect(t.Key())
+		case "values":
+			if t = indirect(t); t.Kind() != reflect.Map && t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+				return nil, errors.Errorf("rule values does not apply to %s", t)
+			}
+			ret.values = new(rules)
+			cursor, cursorType = ret.values, indirect(t.Elem())
+		default:
+			return nil, errors.Errorf("unknown rule %s", rule)
+		}
+	}
+	return ret, nil
+}
+
+// check appends the violations of the rules by a non-nil value.
+func (r *rules) check(value reflect.Value, name string, out *violations) {
+	var subject string
+	if r.key {
+		subject = "key "
+	}
+	if value.IsZero() {
+		if r.required {
+			out.add(name, subject+"is required", false)
+		}
+		return
+	}
+	// the bounds apply to the length of strings and collections
+	var size float64
+	verb, unit := "be", ""
+	switch value.Kind() {
+	case reflect.String:
+		size, unit = float64(utf8.RuneCountInString(value.String())), " characters long"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		size, verb, unit = float64(value.Len()), "have", " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		size = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		size = value.Float()
+	}
+	if r.min != nil && size < *r.min {
+		out.add(name, fmt.Sprintf("%smust %s at least %s%s", subject, verb, formatBound(*r.min), unit), false)
+	}
+	if r.max != nil && size > *r.max {
+		out.add(name, fmt.Sprintf("%smust %s at most %s%s", subject, verb, formatBound(*r.max), unit), false)
+	}
+	if len(r.oneOf) > 0 {
+		formatted, found := fmt.Sprint(value.Interface()), false
+		for _, candidate := range r.oneOf {
+			if candidate == formatted {
+				found = true
+				break
+			}
+		}
+		if !found {
+			out.add(name, subject+"must be one of "+strings.Join(r.oneOf, ", "), false)
+		}
+	}
+	if r.pattern != nil && !r.pattern.MatchString(value.String()) {
+		out.add(name, subject+"must match "+r.pattern.String(), true)
+	}
+}
+
+// structField is a field of a struct to be validated.
+type structField struct {
+	index int
+	name  string
+	rules *rules
+	// embedded tells that the fields of the field are fields of the struct
+	embedded bool
+}
+
+// validator validates the values of a parameter.
+type validator struct {
+	rules *rules
+	// structs are the fields of the struct types reachable from the parameter
+	structs map[reflect.Type][]structField
+}
+
+// newValidator returns a validator of a parameter of the given type; it returns nil if the
+// parameter has nothing to validate.
+func newValidator(t reflect.Type, tag string) (*validator, error) {
+	r, err := parseRules(tag, t)
+	if err != nil {
+		return nil, err
+	}
+	ret := &validator{
+		rules:   r,
+		structs: make(map[reflect.Type][]structField),
+	}
+	if err = ret.compile(t); err != nil {
+		return nil, err
+	}
+	if ret.rules != nil {
+		return ret, nil
+	}
+	for _, fields := range ret.structs {
+		for i := range fields {
+			if fields[i].rules != nil {
+				return ret, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// compile parses the rules of the fields of the struct types reachable from the given type.
+func (v *validator) compile(t reflect.Type) error {
+	t = indirect(t)
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return v.compile(t.Elem())
+	case reflect.Struct:
+	default:
+		return nil
+	}
+	if _, exists := v.structs[t]; exists {
+		return nil
+	}
+	// registered before the fields so that recursive types terminate
+	v.structs[t] = nil
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		embedded := field.Anonymous && name == "" && indirect(field.Type).Kind() == reflect.Struct
+		if field.PkgPath != "" && !embedded {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		r, err := parseRules(field.Tag.Get(TagValidate), field.Type)
+		if err != nil {
+			return errors.Wrapf(err, "field %s of %s", field.Name, t)
+		}
+		if err = v.compile(field.Type); err != nil {
+			return err
+		}
+		if r != nil || nested(field.Type) {
+			fields = append(fields, structField{index: i, name: name, rules: r, embedded: embedded})
+		}
+	}
+	v.structs[t] = fields
+	return nil
+}
+
+// nested tells if values of the given type may hold structs, whose fields may have rules.
+func nested(t reflect.Type) bool {
+	t = indirect(t)
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return nested(t.Elem())
+	case reflect.Struct:
+		return true
+	}
+	return false
+}
+
+// validate returns the error reporting every violation of the rules by the value of a parameter;
+// the fields of a Body parameter are named without the name of the parameter.
+func (v *validator) validate(name string, value reflect.Value) standard.Error {
+	var out violations
+	v.check(value, name, v.rules, &out)
+	return out.err()
+}
+
+func (v *validator) check(value reflect.Value, name string, r *rules, out *violations) {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			if r != nil && r.required {
+				out.add(name, "is required", false)
+			}
+			return
+		}
+		value = value.Elem()
+	}
+	if r != nil {
+		r.check(value, name, out)
+	}
+	var elemRules *rules
+	if r != nil {
+		elemRules = r.values
+	}
+	switch value.Kind() {
+	case reflect.Struct:
+		for _, field := range v.structs[value.Type()] {
+			fieldName := field.name
+			switch {
+			case field.embedded:
+				fieldName = name
+			case name != "":
+				fieldName = name + "." + field.name
+			}
+			v.check(value.Field(field.index), fieldName, field.rules, out)
+		}
+	case reflect.Slice, reflect.Array:
+		if elemRules == nil && !nested(value.Type().Elem()) {
+			return
+		}
+		for i := 0; i < value.Len(); i++ {
+			v.check(value.Index(i), name+"["+strconv.Itoa(i)+"]", elemRules, out)
+		}
+	case reflect.Map:
+		if elemRules == nil && (r == nil || r.keys == nil) && !nested(value.Type().Elem()) {
+			return
+		}
+		keys := value.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for _, key := range keys {
+			elemName := name + "[" + fmt.Sprint(key.Interface()) + "]"
+			if r != nil && r.keys != nil {
+				v.check(key, elemName, r.keys, out)
+			}
+			v.check(value.MapIndex(key), elemName, elemRules, out)
+		}
+	}
+}
+
+// violations are the violations of the rules of a parameter, in order.
+type violations struct {
+	names     []string
+	messages  map[string]string
+	malformed bool
+}
+
+func (out *violations) add(name, message string, malformed bool) {
+	if out.messages == nil {
+		out.messages = make(map[string]string)
+		out.malformed = true
+	}
+	if previous, exists := out.messages[name]; exists {
+		out.messages[name] = previous + "; " + message
+	} else {
+		out.names = append(out.names, name)
+		out.messages[name] = message
+	}
+	out.malformed = out.malformed && malformed
+}
+
+// err returns MalformedParameter if every violation is a pattern mismatch, InvalidParameter
+// otherwise, named after the first violation and with every violation in the Data; it returns
+// nil if there is none.
+func (out *violations) err() standard.Error {
+	if len(out.names) == 0 {
+		return nil
+	}
+	if out.malformed {
+		return standard.MalformedParameter(out.names[0]).SetData(out.messages)
+	}
+	return standard.InvalidParameter(out.names[0]).SetData(out.messages)
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+func sized(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	}
+	return false
+}
+
+func numeric(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func formatBound(bound float64) string {
+	return strconv.FormatFloat(bound, 'f', -1, 64)
+}
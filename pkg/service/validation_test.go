@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/model"
+	"github.com/lichuan0620/secret-keeper-backend/pkg/service/standard"
+)
+
+type validatedItem struct {
+	Name string `json:"Name,omitempty" validate:"required,max=4"`
+}
+
+type validatedBase struct {
+	Id string `json:"Id" validate:"required"`
+}
+
+type validated struct {
+	validatedBase
+	Kind     string            `json:"Kind,omitempty" validate:"oneof=a b"`
+	Code     string            `json:"Code,omitempty" validate:"pattern=^[a-z]{2,3}$"`
+	Count    *int              `json:"Count,omitempty" validate:"min=1,max=10"`
+	Labels   map[string]string `json:"Labels,omitempty" validate:"max=2,values,max=3,keys,pattern=^[a-z]+$"`
+	Items    []validatedItem   `json:"Items,omitempty"`
+	Parent   *validatedItem    `json:"Parent,omitempty"`
+	Ignored  string            `json:"-" validate:"required"`
+	Children []*validated      `json:"Children,omitempty"`
+}
+
+func TestValidate(t *testing.T) {
+	v, err := newValidator(reflect.TypeOf(&validated{}), "")
+	if err != nil {
+		t.Fatalf("new validator: %v", err)
+	}
+	zero, eleven := 0, 11
+	for _, tc := range []struct {
+		Name         string
+		Value        *validated
+		ExpectCode   string
+		ExpectParam  string
+		ExpectFields map[string]string
+	}{
+		{
+			Name: "Valid",
+			Value: &validated{
+				validatedBase: validatedBase{Id: "id"},
+				Kind:          "a",
+				Code:          "abc",
+				Labels:        map[string]string{"k": "v"},
+				Items:         []validatedItem{{Name: "item"}},
+				Children:      []*validated{{validatedBase: validatedBase{Id: "child"}}},
+			},
+		},
+		{
+			Name:        "Required",
+			Value:       &validated{},
+			ExpectCode:  "InvalidParameter",
+			ExpectParam: "Id",
+			ExpectFields: map[string]string{
+				"Id": "is required",
+			},
+		},
+		{
+			Name: "Every violation",
+			Value: &validated{
+				Kind:     "c",
+				Count:    &eleven,
+				Labels:   map[string]string{"K": "value", "k": "v", "l": "v"},
+				Items:    []validatedItem{{Name: "item"}, {Name: "items"}, {}},
+				Parent:   &validatedItem{},
+				Children: []*validated{{Count: &zero}},
+			},
+			ExpectCode:  "InvalidParameter",
+			ExpectParam: "Id",
+			ExpectFields: map[string]string{
+				"Id":             "is required",
+				"Kind":           "must be one of a, b",
+				"Count":          "must be at most 10",
+				"Labels":         "must have at most 2 items",
+				"Labels[K]":      "key must match ^[a-z]+$; must be at most 3 characters long",
+				"Items[1].Name":  "must be at most 4 characters long",
+				"Items[2].Name":  "is required",
+				"Parent.Name":    "is required",
+				"Children[0].Id": "is required",
+			},
+		},
+		{
+			Name: "Malformed",
+			Value: &validated{
+				validatedBase: validatedBase{Id: "id"},
+				Code:          "a,b",
+			},
+			ExpectCode:  "MalformedParameter",
+			ExpectParam: "Code",
+			ExpectFields: map[string]string{
+				"Code": "must match ^[a-z]{2,3}$",
+			},
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			err := v.validate("", reflect.ValueOf(tc.Value))
+			if tc.ExpectCode == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %+v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expecting an error")
+			}
+			data := err.GetData()
+			if err.GetCode() != tc.ExpectCode || data["ParamName"] != tc.ExpectParam {
+				t.Fatalf("expecting %s of %s; got %s of %s", tc.ExpectCode, tc.ExpectParam, err.GetCode(), data["ParamName"])
+			}
+			delete(data, "ParamName")
+			if !reflect.DeepEqual(data, tc.ExpectFields) {
+				t.Fatalf("expecting violations %v; got %v", tc.ExpectFields, data)
+			}
+		})
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	for _, tc := range []struct {
+		Tag   string
+		Value interface{}
+	}{
+		{Tag: "unknown", Value: ""},
+		{Tag: "min=a", Value: 0},
+		{Tag: "max=1", Value: true},
+		{Tag: "pattern=[", Value: ""},
+		{Tag: "pattern=a", Value: 0},
+		{Tag: "keys,required", Value: []string{}},
+		{Tag: "values,required", Value: 0},
+		{Tag: "oneof=a", Value: struct{}{}},
+	} {
+		if _, err := parseRules(tc.Tag, reflect.TypeOf(tc.Value)); err == nil {
+			t.Errorf("expecting an error for %s of %T", tc.Tag, tc.Value)
+		}
+	}
+}
+
+func TestValidateParameters(t *testing.T) {
+	h, err := NewActionHandler(&model.Action{
+		Name: "Validate",
+		Parameters: []model.Parameter{
+			{Source: model.ParameterSourceQuery, Name: "Name", Optional: true, Validate: "max=3"},
+			{Source: model.ParameterSourceBody, Name: "Body"},
+		},
+		Handler: func(context.Context, string, *validatedItem) (map[string]string, standard.Error) {
+			return nil, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("new action handler: %v", err)
+	}
+	for _, tc := range []struct {
+		Query        string
+		Body         string
+		ExpectStatus int
+	}{
+		{Body: `{"Name":"item"}`, ExpectStatus: http.StatusOK},
+		{Query: "Name=abc", Body: `{"Name":"item"}`, ExpectStatus: http.StatusOK},
+		{Query: "Name=abcd", Body: `{"Name":"item"}`, ExpectStatus: http.StatusBadRequest},
+		{Body: `{}`, ExpectStatus: http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/?"+tc.Query, strings.NewReader(tc.Body))
+		req.Header.Set(model.HeaderContentType, model.ContentTypeJSON)
+		ctx := context.WithValue(req.Context(), contextKeyQueryValue, req.URL.Query())
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req.WithContext(ctx))
+		if w.Code != tc.ExpectStatus {
+			t.Errorf("%s %s: expecting status %d; got %d: %s", tc.Query, tc.Body, tc.ExpectStatus, w.Code, w.Body)
+		}
+	}
+
+	if _, err = NewActionHandler(&model.Action{
+		Name: "Invalid",
+		Parameters: []model.Parameter{
+			{Source: model.ParameterSourceBody, Name: "Body", Validate: "required"},
+		},
+		Handler: func(context.Context, *validatedItem) (map[string]string, standard.Error) {
+			return nil, nil
+		},
+	}); err == nil {
+		t.Fatal("expecting an error for the rules of a body parameter")
+	}
+}
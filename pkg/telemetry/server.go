@@ -47,16 +47,11 @@ func NewServer(options *ServerOptions) *Server {
 	healthChecks := map[string]healthz.Checker{
 		"ping": healthz.Ping,
 	}
-	mux.HandleFunc(healthzEndpoint, func(writer http.ResponseWriter, request *http.Request) {
-		for _, check := range healthChecks {
-			if err := check(request); err != nil {
-				writer.WriteHeader(http.StatusInternalServerError)
-				_, _ = writer.Write([]byte(err.Error()))
-				return
-			}
-		}
-		writer.WriteHeader(http.StatusOK)
-	})
+	// the checks are served together at the endpoint and one by one at its subpaths; checks can be
+	// left out with the exclude query parameter, e.g. /healthz?exclude=leader
+	healthzHandler := http.StripPrefix(healthzEndpoint, &healthz.Handler{Checks: healthChecks})
+	mux.Handle(healthzEndpoint, healthzHandler)
+	mux.Handle(healthzEndpoint+"/", healthzHandler)
 	mux.HandleFunc(pprofEndpoint, pprof.Index)
 	mux.HandleFunc(pprofEndpoint+"/cmdline", pprof.Cmdline)
 	mux.HandleFunc(pprofEndpoint+"/profile", pprof.Profile)
@@ -77,5 +77,32 @@ var _ = Describe("Server", func() {
 				g.Expect(resp.StatusCode).To(Equal(http.StatusInternalServerError))
 			}).Should(Succeed())
 		})
+
+		It("can serve and exclude individual checks", func() {
+			server.SetHealthCheck("fail", func(_ *http.Request) error {
+				return errors.New("pseudo error")
+			})
+			go func() {
+				startErrCh <- server.Start(ctx)
+			}()
+			for address, code := range map[string]int{
+				healthzAddress + "/ping":         http.StatusOK,
+				healthzAddress + "/fail":         http.StatusInternalServerError,
+				healthzAddress + "?exclude=fail": http.StatusOK,
+				healthzAddress + "/nonexistent":  http.StatusNotFound,
+			} {
+				address, code := address, code
+				Eventually(func(g Gomega) {
+					req, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+					g.Expect(err).ToNot(HaveOccurred())
+					resp, err := http.DefaultClient.Do(req)
+					g.Expect(err).ToNot(HaveOccurred())
+					defer func() {
+						_ = resp.Body.Close()
+					}()
+					g.Expect(resp.StatusCode).To(Equal(code))
+				}).Should(Succeed())
+			}
+		})
 	})
 })